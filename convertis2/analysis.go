@@ -0,0 +1,33 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+// Analysis are the results of the building survey, the hotspot and the
+// cluster detection of a picture
+type Analysis struct {
+	// Building are the results of a building survey, nil without climate
+	Building *BuildingStats `json:"building,omitempty"`
+	// Hotspots are the detected hotspots, nil without hotspot options
+	Hotspots []Hotspot `json:"hotspots,omitempty"`
+	// Clusters are the hot and cold clusters of the cluster options
+	Clusters []Cluster `json:"clusters,omitempty"`
+}
+
+// analyze surveys frame with the climate, the hotspot and the cluster
+// options of opts
+func analyze(frame *Thermogram, opts Options) Analysis {
+	var a Analysis
+	if opts.Climate != nil {
+		stats := frame.Building(*opts.Climate)
+		a.Building = &stats
+	}
+	if opts.Hotspots != nil {
+		a.Hotspots = frame.Hotspots(*opts.Hotspots)
+	}
+	for _, c := range opts.Clusters {
+		a.Clusters = append(a.Clusters, frame.Clusters(c)...)
+	}
+	return a
+}
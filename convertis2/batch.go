@@ -0,0 +1,235 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ExpandTemplate returns the output path of the template for the input
+// file filename. The placeholders {dir}, {name} and {ext} are replaced with
+// the directory of the input, the name of the input without extension and
+// the file extension ext of the output without the dot.
+func ExpandTemplate(template string, filename string, ext string) string {
+	base := filepath.Base(filename)
+	return strings.NewReplacer(
+		"{dir}", filepath.Dir(filename),
+		"{name}", strings.TrimSuffix(base, filepath.Ext(base)),
+		"{ext}", strings.TrimPrefix(ext, "."),
+	).Replace(template)
+}
+
+// IsTemplate reports whether path has placeholders of ExpandTemplate
+func IsTemplate(path string) bool {
+	return strings.Contains(path, "{dir}") || strings.Contains(path, "{name}")
+}
+
+// isIS2 reports whether filename has the extension of is2 files
+func isIS2(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".is2")
+}
+
+// ExpandInputs returns the input files of paths. A path is a file, a glob
+// or a directory. Directories are searched for .is2 files, recursive
+// searches the subdirectories too. Every file is returned once.
+func ExpandInputs(paths []string, recursive bool) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	add := func(filename string) {
+		if !seen[filename] {
+			seen[filename] = true
+			files = append(files, filename)
+		}
+	}
+	for _, path := range paths {
+		matches := []string{path}
+		if strings.ContainsAny(path, "*?[") {
+			var err error
+			matches, err = filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bad pattern. %w", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no files match.", path)
+			}
+		}
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !fi.IsDir() {
+				add(match)
+				continue
+			}
+			dirfiles, err := listIS2(match, recursive)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range dirfiles {
+				add(f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// listIS2 returns the .is2 files of the directory dir in lexical order
+func listIS2(dir string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isIS2(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// BatchResult counts the files of a batch conversion
+type BatchResult struct {
+	Succeeded int
+	Failed    int
+	// Skipped files have an unknown format
+	Skipped int
+	// Canceled files were not converted because the context was canceled
+	Canceled int
+}
+
+// String returns the summary of the batch conversion
+func (r BatchResult) String() string {
+	if r.Canceled > 0 {
+		return fmt.Sprintf("%d succeeded, %d failed, %d skipped, %d canceled.", r.Succeeded, r.Failed, r.Skipped, r.Canceled)
+	}
+	return fmt.Sprintf("%d succeeded, %d failed, %d skipped.", r.Succeeded, r.Failed, r.Skipped)
+}
+
+// add counts the result of a file
+func (r *BatchResult) add(err error) {
+	switch {
+	case err == nil:
+		r.Succeeded++
+	case errors.Is(err, ErrFormat):
+		log.Println("Skipped:", err)
+		r.Skipped++
+	default:
+		log.Println("Failed:", err)
+		r.Failed++
+	}
+}
+
+// ConvertAll converts the files with the options one after another. Errors
+// are logged and the conversion continues with the next file.
+func ConvertAll(files []string, opts Options) BatchResult {
+	return ConvertAllContext(context.Background(), files, opts, 1)
+}
+
+// ConvertAllContext converts the files with the options by the given number
+// of workers in parallel. Errors are logged and the conversion continues
+// with the next file. After ctx is canceled no more files are started.
+func ConvertAllContext(ctx context.Context, files []string, opts Options, workers int) BatchResult {
+	var result BatchResult
+	ConvertEach(ctx, files, opts, workers, func(filename string, err error) {
+		result.add(err)
+	})
+	// The files are started in order, so the canceled files are the rest.
+	result.Canceled = len(files) - result.Succeeded - result.Failed - result.Skipped
+	return result
+}
+
+// ConvertEach converts the files with the options by the given number of
+// workers in parallel and calls done with the result of every file. The
+// messages of a file are collected and logged in the order of the files
+// before done is called. At most twice the number of workers are converted
+// or wait for an earlier file, so a slow file doesn't let the messages of
+// the later files pile up. After ctx is canceled no more files are started.
+func ConvertEach(ctx context.Context, files []string, opts Options, workers int, done func(filename string, err error)) {
+	type job struct {
+		index    int
+		filename string
+	}
+	type finished struct {
+		index int
+		err   error
+		log   *bytes.Buffer
+	}
+	workers = max(workers, 1)
+	jobs := make(chan job)
+	results := make(chan finished, workers)
+	// A slot is taken for every started file and given back after done.
+	slots := make(chan struct{}, 2*workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				buf := &bytes.Buffer{}
+				o := opts
+				o.Logger = log.New(buf, log.Prefix(), log.Flags())
+				o.Logger.Printf("[%d/%d] %s\n", j.index+1, len(files), j.filename)
+				results <- finished{j.index, Convert(j.filename, o), buf}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i, filename := range files {
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job{i, filename}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	pending := map[int]finished{}
+	next := 0
+	for f := range results {
+		pending[f.index] = f
+		for {
+			f, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			log.Writer().Write(f.log.Bytes())
+			done(files[next], f.err)
+			next++
+			<-slots
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		filename string
+		ext      string
+		want     string
+	}{
+		{"out/{name}.{ext}", "in/IR00012.IS2", ".png", "out/IR00012.png"},
+		{"{dir}/{name}_ir.{ext}", "in/sub/IR00012.is2", "jpg", "in/sub/IR00012_ir.jpg"},
+		{"{dir}/{name}.wav", "IR00012.IS2", ".wav", "./IR00012.wav"},
+		{"ir.jpg", "in/IR00012.IS2", ".jpg", "ir.jpg"},
+	}
+	for _, tt := range tests {
+		if got := ExpandTemplate(tt.template, tt.filename, tt.ext); got != tt.want {
+			t.Errorf("%s for %s: %s, want %s", tt.template, tt.filename, got, tt.want)
+		}
+	}
+	for path, want := range map[string]bool{"out/{name}.jpg": true, "{dir}/ir.jpg": true, "out/{ext}": false, "ir.jpg": false} {
+		if IsTemplate(path) != want {
+			t.Errorf("IsTemplate(%s) = %v", path, !want)
+		}
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.IS2", "a.is2", "notes.txt", "sub/c.IS2", "sub/deep/d.is2", "other/e.IS2"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+	tests := []struct {
+		name      string
+		paths     []string
+		recursive bool
+		want      []string
+	}{
+		{"directory", in(""), false, in("a.is2", "b.IS2")},
+		{"recursive", in(""), true, in("a.is2", "b.IS2", "other/e.IS2", "sub/c.IS2", "sub/deep/d.is2")},
+		{"file of another extension", in("notes.txt"), false, in("notes.txt")},
+		{"glob", in("*.IS2"), false, in("b.IS2")},
+		{"glob of directories", in("s*"), false, in("sub/c.IS2")},
+		{"every file once", in("b.IS2", "", "a.is2"), false, in("b.IS2", "a.is2")},
+		{"no match", in("*.jpg"), false, nil},
+		{"missing file", in("x.IS2"), false, nil},
+		{"bad pattern", in("[.IS2"), false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := ExpandInputs(tt.paths, tt.recursive)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("%v, want an error", files)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(files, tt.want) {
+				t.Errorf("%v, want %v", files, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertAll(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"old.IS2", testOldIS2(testRaw(1320, 2093))},
+		{"text.IS2", []byte("no picture")},
+		{"new.IS2", testNewIS2(t, testRaw(4716, 7263), nil)},
+		{"short.IS2", testOldIS2(testRaw(1320, 2093))[:20000]},
+	} {
+		files = append(files, writeTestFile(t, f.name, f.data))
+	}
+	files = append(files, filepath.Join(dir, "missing.IS2"))
+	opts := Options{IRFile: filepath.Join(dir, "{name}.png"), AudioFile: filepath.Join(dir, "{name}.wav")}
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	result := ConvertAll(files, opts)
+	if want := (BatchResult{Succeeded: 2, Failed: 2, Skipped: 1}); result != want {
+		t.Errorf("%v, want %v", result, want)
+	}
+	for _, name := range []string{"old.png", "old.wav", "new.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestConvertEach(t *testing.T) {
+	old := testOldIS2(testRaw(1320, 2093))
+	dir := t.TempDir()
+	var files []string
+	unknown := map[string]bool{}
+	for i := 0; i < 12; i++ {
+		data := old
+		if i%3 == 2 {
+			data = []byte("no picture")
+		}
+		filename := filepath.Join(dir, fmt.Sprintf("IR%02d.IS2", i))
+		if err := os.WriteFile(filename, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, filename)
+		unknown[filename] = i%3 == 2
+	}
+	opts := Options{IRFile: filepath.Join(dir, "{name}.png"), AudioFile: filepath.Join(dir, "{name}.wav")}
+	log.SetFlags(0)
+	defer log.SetFlags(log.LstdFlags)
+	for _, workers := range []int{0, 1, 4, 20} {
+		t.Run(fmt.Sprint(workers, " workers"), func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+			var done []string
+			ConvertEach(context.Background(), files, opts, workers, func(filename string, err error) {
+				if errors.Is(err, ErrFormat) != unknown[filename] || (err != nil && !unknown[filename]) {
+					t.Errorf("%s: %v", filename, err)
+				}
+				// The messages of the file are logged before done.
+				if !strings.Contains(buf.String(), filename) {
+					t.Errorf("%s: done before its messages", filename)
+				}
+				done = append(done, filename)
+			})
+			if !slices.Equal(done, files) {
+				t.Fatalf("done %v, want the files in order", done)
+			}
+			// The messages of the files don't interleave.
+			last := -1
+			for _, line := range strings.Split(buf.String(), "\n") {
+				var i, n int
+				var name string
+				if _, err := fmt.Sscanf(line, "[%d/%d] %s", &i, &n, &name); err != nil {
+					continue
+				}
+				if i != last+2 || name != files[i-1] {
+					t.Fatalf("file %d %s logged after file %d", i, name, last+1)
+				}
+				last = i - 1
+			}
+			if last != len(files)-1 {
+				t.Errorf("%d files logged, want %d", last+1, len(files))
+			}
+		})
+	}
+}
+
+func TestConvertAllContextCanceled(t *testing.T) {
+	files := []string{writeTestFile(t, "old.IS2", testOldIS2(testRaw(1320, 2093)))}
+	files = append(files, files[0], files[0])
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := ConvertAllContext(ctx, files, Options{Logger: discard}, 2)
+	if want := (BatchResult{Canceled: 3}); result != want {
+		t.Errorf("%v, want %v", result, want)
+	}
+}
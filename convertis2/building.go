@@ -0,0 +1,176 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"math"
+)
+
+// Render modes of the infrared picture
+const (
+	// ModeTemperature colors the temperatures
+	ModeTemperature = "temperature"
+	// ModeDewPoint colors the surface temperature minus the dew point of the
+	// indoor air in K
+	ModeDewPoint = "dewpoint"
+	// ModeFRsi colors the temperature factor fRsi of the surface
+	ModeFRsi = "frsi"
+)
+
+// FRsiCritical is the lowest temperature factor without mold risk after
+// DIN 4108-2
+const FRsiCritical = 0.7
+
+// Climate is the indoor and outdoor climate of a building survey. The
+// surfaces of the picture are inside the building.
+type Climate struct {
+	// Indoor and Outdoor air temperature in degree celsius
+	Indoor  float64 `json:"indoor"`
+	Outdoor float64 `json:"outdoor"`
+	// Humidity is the relative humidity of the indoor air in percent
+	Humidity float64 `json:"humidity"`
+}
+
+// DefaultClimate are the standard conditions of DIN 4108-2
+var DefaultClimate = Climate{Indoor: 20, Outdoor: -5, Humidity: 50}
+
+// Validate checks the climate
+func (c *Climate) Validate() error {
+	if c.Humidity <= 0 || c.Humidity > 100 {
+		return fmt.Errorf("Relative humidity must be between 0 and 100 %%.")
+	}
+	if c.Indoor <= c.Outdoor {
+		return fmt.Errorf("Indoor temperature must be above the outdoor temperature.")
+	}
+	return nil
+}
+
+// DewPoint returns the dew point of the indoor air after the Magnus formula
+func (c *Climate) DewPoint() float64 {
+	return dewPoint(c.Indoor, c.Humidity)
+}
+
+// MoldTemperature returns the surface temperature with a relative humidity
+// of 80 % at the surface. Mold grows on colder surfaces.
+func (c *Climate) MoldTemperature() float64 {
+	return dewPoint(c.Indoor, c.Humidity/0.8)
+}
+
+// FRsi returns the temperature factor of a surface temperature t, 0 at the
+// outdoor and 1 at the indoor temperature
+func (c *Climate) FRsi(t float64) float64 {
+	return (t - c.Outdoor) / (c.Indoor - c.Outdoor)
+}
+
+// dewPoint returns the temperature at which air of temperature t and the
+// relative humidity rh in percent is saturated
+func dewPoint(t float64, rh float64) float64 {
+	const a, b = 17.62, 243.12
+	gamma := math.Log(rh/100) + a*t/(b+t)
+	return b * gamma / (a - gamma)
+}
+
+// condensation reports whether water condenses on a surface of temperature t
+func (c *Climate) condensation(t float64) bool {
+	return t <= c.DewPoint()
+}
+
+// moldRisk reports whether a surface of temperature t is at risk of mold.
+// The surface humidity is 80 % or more or fRsi is below FRsiCritical.
+func (c *Climate) moldRisk(t float64) bool {
+	return t <= c.MoldTemperature() || c.FRsi(t) < FRsiCritical
+}
+
+// BuildingStats are the results of a building survey picture
+type BuildingStats struct {
+	Climate Climate `json:"climate"`
+	// DewPoint and MoldTemperature of the indoor air in degree celsius
+	DewPoint        float64 `json:"dew_point"`
+	MoldTemperature float64 `json:"mold_temperature"`
+	// MinMargin is the min. surface temperature minus the dew point in K
+	MinMargin float64 `json:"min_dew_point_margin"`
+	// MinFRsi is the temperature factor of the coldest surface
+	MinFRsi float64 `json:"min_frsi"`
+	// Condensation and MoldRisk are the shares of the picture in percent
+	Condensation float64 `json:"condensation_percent"`
+	MoldRisk     float64 `json:"mold_risk_percent"`
+}
+
+// Building returns the building survey results of the picture in the
+// climate c
+func (t *Thermogram) Building(c Climate) BuildingStats {
+	var condensation, mold int
+	for _, temp := range t.Temperatures {
+		if c.condensation(temp) {
+			condensation++
+		}
+		if c.moldRisk(temp) {
+			mold++
+		}
+	}
+	n := float64(max(len(t.Temperatures), 1))
+	return BuildingStats{
+		Climate:         c,
+		DewPoint:        round2(c.DewPoint()),
+		MoldTemperature: round2(c.MoldTemperature()),
+		MinMargin:       round2(t.Min() - c.DewPoint()),
+		MinFRsi:         round2(c.FRsi(t.Min())),
+		Condensation:    round2(float64(condensation) * 100 / n),
+		MoldRisk:        round2(float64(mold) * 100 / n),
+	}
+}
+
+// String returns the results as text
+func (s BuildingStats) String() string {
+	return fmt.Sprintf("dew point %.1f °C, mold %.1f °C, min. margin %.1f K, min. fRsi %.2f, condensation %.1f %%, mold risk %.1f %%",
+		s.DewPoint, s.MoldTemperature, s.MinMargin, s.MinFRsi, s.Condensation, s.MoldRisk)
+}
+
+// validMode reports whether name is a known render mode
+func validMode(name string) bool {
+	switch name {
+	case "", ModeTemperature, ModeDewPoint, ModeFRsi:
+		return true
+	}
+	return false
+}
+
+// modeScale returns the colorscale of the render mode. The dew point
+// margin has an automatic scale, fRsi the scale 0 to 1.
+func modeScale(frame *Thermogram, opts Options, cs colorscale) colorscale {
+	c := opts.Climate
+	switch opts.Mode {
+	case ModeDewPoint:
+		td := c.DewPoint()
+		cs.value = func(t float64) float64 { return t - td }
+		cs.min, cs.max = frame.Min()-td, frame.Max()-td
+		cs.unit, cs.ticks = "K", "%.1f"
+	case ModeFRsi:
+		cs.value = c.FRsi
+		cs.min, cs.max = 0, 1
+		cs.unit, cs.ticks = "fRsi", "%.2f"
+	}
+	return cs
+}
+
+// Colors of the building overlays
+var (
+	condensationColor = [3]uint8{0, 80, 255}
+	moldColor         = [3]uint8{255, 0, 255}
+)
+
+// overlay paints the condensation areas of the climate c solid and the
+// mold risk areas striped like an isotherm. x and y are the pixel at the
+// output scale s.
+func (c *Climate) overlay(t float64, x int, y int, s float64, r uint8, g uint8, b uint8) (uint8, uint8, uint8) {
+	switch {
+	case c.condensation(t):
+		return condensationColor[0], condensationColor[1], condensationColor[2]
+	case c.moldRisk(t) && int(float64(x+y)/(3*s))%2 == 0:
+		return moldColor[0], moldColor[1], moldColor[2]
+	}
+	return r, g, b
+}
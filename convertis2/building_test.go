@@ -0,0 +1,142 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDewPoint(t *testing.T) {
+	tests := []struct {
+		t, rh float64
+		want  float64
+	}{
+		{20, 50, 9.255},
+		{20, 65, 13.217},
+		{0, 100, 0},
+		{25, 60, 16.693},
+		{-5, 80, -7.917},
+		{20, 100, 20},
+	}
+	for _, tt := range tests {
+		if got := dewPoint(tt.t, tt.rh); math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("%.1f °C %.0f %%: %.3f °C, want %.3f °C", tt.t, tt.rh, got, tt.want)
+		}
+	}
+}
+
+func TestClimate(t *testing.T) {
+	tests := []struct {
+		name    string
+		climate Climate
+		ok      bool
+		dew     float64
+		mold    float64
+		frsi    float64
+	}{
+		{"din 4108-2", DefaultClimate, true, 9.255, 12.617, 0.7047},
+		{"humid", Climate{Indoor: 22, Outdoor: 2, Humidity: 70}, true, 16.274, 19.827, 0.8913},
+		{"no humidity", Climate{Indoor: 20, Outdoor: -5, Humidity: 0}, false, 0, 0, 0},
+		{"humidity above 100 %", Climate{Indoor: 20, Outdoor: -5, Humidity: 101}, false, 0, 0, 0},
+		{"outdoor as warm as indoor", Climate{Indoor: 20, Outdoor: 20, Humidity: 50}, false, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.climate.Validate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("error %v", err)
+			}
+			if !tt.ok {
+				return
+			}
+			c := tt.climate
+			if d := c.DewPoint(); math.Abs(d-tt.dew) > 0.001 {
+				t.Errorf("dew point %.3f °C, want %.3f °C", d, tt.dew)
+			}
+			if m := c.MoldTemperature(); math.Abs(m-tt.mold) > 0.001 {
+				t.Errorf("mold temperature %.3f °C, want %.3f °C", m, tt.mold)
+			}
+			if f := c.FRsi(c.MoldTemperature()); math.Abs(f-tt.frsi) > 0.0001 {
+				t.Errorf("fRsi of the mold temperature %.4f, want %.4f", f, tt.frsi)
+			}
+			if c.FRsi(c.Outdoor) != 0 || c.FRsi(c.Indoor) != 1 {
+				t.Errorf("fRsi %v outdoor, %v indoor", c.FRsi(c.Outdoor), c.FRsi(c.Indoor))
+			}
+		})
+	}
+}
+
+func TestClimateRisks(t *testing.T) {
+	c := DefaultClimate
+	tests := []struct {
+		t            float64
+		condensation bool
+		mold         bool
+	}{
+		{5, true, true},
+		{9.2, true, true},
+		{9.3, false, true},
+		{12.6, false, true},
+		// fRsi 0.68 is below 0.7, the surface humidity is below 80 %.
+		{12, false, true},
+		{12.7, false, false},
+		{18, false, false},
+	}
+	for _, tt := range tests {
+		if got := c.condensation(tt.t); got != tt.condensation {
+			t.Errorf("%.1f °C: condensation %v", tt.t, got)
+		}
+		if got := c.moldRisk(tt.t); got != tt.mold {
+			t.Errorf("%.1f °C: mold risk %v", tt.t, got)
+		}
+	}
+}
+
+func TestBuilding(t *testing.T) {
+	// A wall of 18 °C with a cold corner of 11 °C and a wet spot of 5 °C
+	frame := testTemperatures(100, 50, func(x, y int) float64 {
+		switch {
+		case x < 10:
+			return 5
+		case x < 40:
+			return 11
+		}
+		return 18
+	})
+	stats := frame.Building(DefaultClimate)
+	want := BuildingStats{
+		Climate:         DefaultClimate,
+		DewPoint:        9.26,
+		MoldTemperature: 12.62,
+		MinMargin:       -4.26,
+		MinFRsi:         0.4,
+		Condensation:    10,
+		MoldRisk:        40,
+	}
+	if stats != want {
+		t.Errorf("%+v, want %+v", stats, want)
+	}
+}
+
+func TestModeScale(t *testing.T) {
+	frame := testTemperatures(10, 10, func(x, y int) float64 { return 10 + float64(x) })
+	c := DefaultClimate
+	tests := []struct {
+		mode     string
+		min, max float64
+		value    float64
+	}{
+		{ModeDewPoint, 10 - c.DewPoint(), 19 - c.DewPoint(), 15 - c.DewPoint()},
+		{ModeFRsi, 0, 1, 0.8},
+	}
+	for _, tt := range tests {
+		opts := Options{Climate: &c, Mode: tt.mode}
+		cs := modeScale(frame, opts, newColorscale(frame, opts))
+		if cs.min != tt.min || cs.max != tt.max || cs.value(15) != tt.value {
+			t.Errorf("%s: scale %.2f..%.2f, value of 15 °C %.2f, want %.2f..%.2f, %.2f", tt.mode, cs.min, cs.max, cs.value(15), tt.min, tt.max, tt.value)
+		}
+	}
+}
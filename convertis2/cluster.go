@@ -0,0 +1,282 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// Kinds of the clusters
+const (
+	ClusterHot  = "hot"
+	ClusterCold = "cold"
+)
+
+// Shapes of the cluster markers
+const (
+	MarkerCross  = "cross"
+	MarkerCircle = "circle"
+	MarkerBox    = "box"
+)
+
+// ClusterOptions are the parameters of the search for hot or cold clusters
+type ClusterOptions struct {
+	// Kind is hot or cold
+	Kind string
+	// Threshold in degree celsius. Hot clusters are above it, cold
+	// clusters below it.
+	Threshold float64
+	// MinArea is the min. area of a cluster in pixels. 0 selects 4.
+	MinArea int
+	// Radius of the non-maximum suppression in pixels. A cluster with its
+	// peak in the radius around the peak of a higher ranked cluster is
+	// dropped. 0 disables the suppression.
+	Radius float64
+	// Top is the number of clusters returned and drawn. 0 selects all.
+	Top int
+	// Style of the markers drawn onto the infrared picture
+	Style MarkerStyle
+}
+
+// MarkerStyle is the look of the cluster markers
+type MarkerStyle struct {
+	// Shape is cross, circle or box. Empty selects cross.
+	Shape string
+	// Color as #RRGGBB. Empty selects red for hot and blue for cold
+	// clusters.
+	Color string
+	// Size of cross and circle in camera pixels. 0 selects 6.
+	Size float64
+	// Labels draws the rank and the peak temperature next to the marker
+	Labels bool
+}
+
+// ParseMarkerStyle parses a marker style of the form
+// "shape[,#RRGGBB[,size[,label|nolabel]]]". Labels are drawn by default.
+func ParseMarkerStyle(s string) (MarkerStyle, error) {
+	fields := strings.Split(s, ",")
+	style := MarkerStyle{Shape: strings.TrimSpace(fields[0]), Labels: true}
+	if len(fields) > 4 {
+		return style, fmt.Errorf("%s: marker must be shape[,color[,size[,label|nolabel]]].", s)
+	}
+	if len(fields) > 1 {
+		style.Color = strings.TrimSpace(fields[1])
+	}
+	if len(fields) > 2 && strings.TrimSpace(fields[2]) != "" {
+		size, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err != nil {
+			return style, fmt.Errorf("%s: bad marker size. %w", s, err)
+		}
+		style.Size = size
+	}
+	if len(fields) > 3 {
+		switch strings.TrimSpace(fields[3]) {
+		case "label":
+		case "nolabel":
+			style.Labels = false
+		default:
+			return style, fmt.Errorf("%s: marker labels must be label or nolabel.", s)
+		}
+	}
+	return style, style.Validate()
+}
+
+// Validate checks the marker style
+func (m MarkerStyle) Validate() error {
+	switch m.Shape {
+	case "", MarkerCross, MarkerCircle, MarkerBox:
+	default:
+		return fmt.Errorf("%s: unknown marker shape.", m.Shape)
+	}
+	if m.Color != "" {
+		hex := strings.TrimPrefix(m.Color, "#")
+		if _, err := strconv.ParseUint(hex, 16, 32); err != nil || len(hex) != 6 {
+			return fmt.Errorf("%s: marker color must be #RRGGBB.", m.Color)
+		}
+	}
+	if m.Size < 0 {
+		return fmt.Errorf("Marker size must not be negative.")
+	}
+	return nil
+}
+
+// Validate checks the cluster options
+func (o *ClusterOptions) Validate() error {
+	if o.Kind != ClusterHot && o.Kind != ClusterCold {
+		return fmt.Errorf("%s: cluster kind must be hot or cold.", o.Kind)
+	}
+	if o.MinArea < 0 || o.Radius < 0 || o.Top < 0 {
+		return fmt.Errorf("Cluster area, radius and top must not be negative.")
+	}
+	return o.Style.Validate()
+}
+
+// minArea returns the min. area of a cluster
+func (o *ClusterOptions) minArea() int {
+	if o.MinArea <= 0 {
+		return 4
+	}
+	return o.MinArea
+}
+
+// in reports whether the temperature t belongs to a cluster
+func (o *ClusterOptions) in(t float64) bool {
+	if o.Kind == ClusterCold {
+		return t < o.Threshold
+	}
+	return t > o.Threshold
+}
+
+// beyond reports whether the temperature a is hotter than b for hot
+// clusters or colder for cold clusters
+func (o *ClusterOptions) beyond(a float64, b float64) bool {
+	if o.Kind == ClusterCold {
+		return a < b
+	}
+	return a > b
+}
+
+// Cluster is a connected region above or below a threshold
+type Cluster struct {
+	// Rank of the cluster, 1 for the hottest or coldest peak
+	Rank int    `json:"rank"`
+	Kind string `json:"kind"`
+	// Peak is the hottest or coldest pixel
+	Peak Spot `json:"peak"`
+	// Centroid is the mean position of the pixels of the cluster
+	CentroidX float64 `json:"centroid_x"`
+	CentroidY float64 `json:"centroid_y"`
+	// Bounding box and area in camera pixels
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	Area   int `json:"area"`
+	// Mean temperature of the cluster
+	Mean float64 `json:"mean"`
+}
+
+// Clusters finds the hot or cold clusters of the picture. The clusters
+// are ranked by their peak, the hottest or coldest first, and thinned by
+// the non-maximum suppression.
+func (t *Thermogram) Clusters(o ClusterOptions) []Cluster {
+	_, comps := components(t.Width, t.Height, func(i int) bool {
+		return o.in(t.Temperatures[i])
+	})
+	var clusters []Cluster
+	for _, c := range comps {
+		if len(c.Pixels) < o.minArea() {
+			continue
+		}
+		cl := Cluster{Kind: o.Kind, X: c.X0, Y: c.Y0, Width: c.X1 - c.X0, Height: c.Y1 - c.Y0, Area: len(c.Pixels)}
+		peak := c.Pixels[0]
+		var sum, sx, sy float64
+		for _, i := range c.Pixels {
+			v := t.Temperatures[i]
+			sum += v
+			sx += float64(i % t.Width)
+			sy += float64(i / t.Width)
+			if o.beyond(v, t.Temperatures[peak]) {
+				peak = i
+			}
+		}
+		n := float64(len(c.Pixels))
+		cl.Peak = Spot{Name: o.Kind, X: peak % t.Width, Y: peak / t.Width, Temperature: round2(t.Temperatures[peak])}
+		cl.CentroidX, cl.CentroidY = round2(sx/n), round2(sy/n)
+		cl.Mean = round2(sum / n)
+		clusters = append(clusters, cl)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return o.beyond(clusters[i].Peak.Temperature, clusters[j].Peak.Temperature)
+	})
+	var kept []Cluster
+	for _, cl := range clusters {
+		if o.Top > 0 && len(kept) == o.Top {
+			break
+		}
+		if o.Radius > 0 && suppressed(cl, kept, o.Radius) {
+			continue
+		}
+		cl.Rank = len(kept) + 1
+		kept = append(kept, cl)
+	}
+	return kept
+}
+
+// suppressed reports whether the peak of cl is in the radius around the
+// peak of one of the clusters
+func suppressed(cl Cluster, clusters []Cluster, radius float64) bool {
+	for _, k := range clusters {
+		if math.Hypot(float64(cl.Peak.X-k.Peak.X), float64(cl.Peak.Y-k.Peak.Y)) < radius {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the cluster as text
+func (c Cluster) String() string {
+	return fmt.Sprintf("%s %d peak %.2f °C at %d,%d, centroid %.1f,%.1f, size %dx%d, %d px",
+		c.Kind, c.Rank, c.Peak.Temperature, c.Peak.X, c.Peak.Y, c.CentroidX, c.CentroidY, c.Width, c.Height, c.Area)
+}
+
+// drawClusters draws the markers of the clusters at the output scale s.
+// The labels stay in the width x height temperature field.
+func drawClusters(dc *gg.Context, clusters []Cluster, style MarkerStyle, s float64, width float64, height float64) {
+	color := style.Color
+	if color == "" {
+		color = "#ff2020"
+		if len(clusters) > 0 && clusters[0].Kind == ClusterCold {
+			color = "#20a0ff"
+		}
+	}
+	r, g, b := HTMLColorToRGB(color)
+	size := style.Size
+	if size == 0 {
+		size = 6
+	}
+	size *= s
+	prefix := map[string]string{ClusterHot: "H", ClusterCold: "C"}
+	for _, c := range clusters {
+		x, y := (float64(c.Peak.X)+0.5)*s-0.5, (float64(c.Peak.Y)+0.5)*s-0.5
+		// The marker is drawn twice, a black outline below the color.
+		for _, pass := range []struct {
+			width   float64
+			r, g, b uint8
+		}{{3 * s, 0, 0, 0}, {s, r, g, b}} {
+			dc.SetRGB255(int(pass.r), int(pass.g), int(pass.b))
+			dc.SetLineWidth(pass.width)
+			switch style.Shape {
+			case MarkerCircle:
+				dc.DrawCircle(x, y, size)
+			case MarkerBox:
+				dc.DrawRectangle(float64(c.X)*s, float64(c.Y)*s, float64(c.Width)*s, float64(c.Height)*s)
+			default:
+				dc.DrawLine(x-size, y, x+size, y)
+				dc.DrawLine(x, y-size, x, y+size)
+			}
+			dc.Stroke()
+			if style.Labels {
+				label := fmt.Sprintf("%s%d %.1f", prefix[c.Kind], c.Rank, c.Peak.Temperature)
+				w, h := dc.MeasureString(label)
+				lx, ly := x+size+2*s, y-2*s
+				if lx+w > width {
+					lx = x - size - 2*s - w
+				}
+				ly = min(max(ly, h), height-2*s)
+				if pass.width > s {
+					lx, ly = lx+s, ly+s
+				}
+				dc.DrawString(label, lx, ly)
+			}
+		}
+	}
+}
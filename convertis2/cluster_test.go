@@ -0,0 +1,172 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"strings"
+	"testing"
+)
+
+// gridTemperatures returns a thermogram of the rows of the grid. A digit
+// is its temperature times 10, other characters are 0 °C.
+func gridTemperatures(rows ...string) *Thermogram {
+	return testTemperatures(len(rows[0]), len(rows), func(x, y int) float64 {
+		if c := rows[y][x]; c >= '0' && c <= '9' {
+			return float64(c-'0') * 10
+		}
+		return 0
+	})
+}
+
+func TestComponents(t *testing.T) {
+	grid := []string{
+		"##..#.",
+		"#...#.",
+		".#....",
+		"....##",
+		"#..##.",
+	}
+	labels, comps := components(6, 5, func(i int) bool {
+		return grid[i/6][i%6] == '#'
+	})
+	want := []component{
+		{X0: 0, Y0: 0, X1: 2, Y1: 3, Pixels: []int{0, 1, 6, 13}},
+		{X0: 4, Y0: 0, X1: 5, Y1: 2, Pixels: []int{4, 10}},
+		{X0: 3, Y0: 3, X1: 6, Y1: 5, Pixels: []int{22, 23, 28, 27}},
+		{X0: 0, Y0: 4, X1: 1, Y1: 5, Pixels: []int{24}},
+	}
+	if len(comps) != len(want) {
+		t.Fatalf("%d components %v, want %d", len(comps), comps, len(want))
+	}
+	for i, c := range comps {
+		w := want[i]
+		if c.X0 != w.X0 || c.Y0 != w.Y0 || c.X1 != w.X1 || c.Y1 != w.Y1 || len(c.Pixels) != len(w.Pixels) {
+			t.Errorf("component %d: %+v, want %+v", i+1, c, w)
+			continue
+		}
+		for _, p := range w.Pixels {
+			if labels[p] != i+1 {
+				t.Errorf("pixel %d has the label %d, want %d", p, labels[p], i+1)
+			}
+		}
+	}
+	for i, l := range labels {
+		if (l == 0) != (grid[i/6][i%6] != '#') {
+			t.Errorf("pixel %d has the label %d", i, l)
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{3}, 3},
+		{[]float64{5, 1, 3}, 3},
+		{[]float64{4, 1, 3, 2}, 2.5},
+		{[]float64{7, 7, 1, 7}, 7},
+	}
+	for _, tt := range tests {
+		if got := median(tt.values); got != tt.want {
+			t.Errorf("median of %v: %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestClusters(t *testing.T) {
+	frame := gridTemperatures(
+		"9811....5.",
+		"88.1.6655.",
+		"..........",
+		"........11",
+		"11.....111",
+		"11.....1.1",
+	)
+	tests := []struct {
+		name  string
+		opts  ClusterOptions
+		peaks []Spot
+		areas []int
+	}{
+		{"hot", ClusterOptions{Kind: ClusterHot, Threshold: 40}, []Spot{{Name: ClusterHot, X: 0, Y: 0, Temperature: 90}, {Name: ClusterHot, X: 5, Y: 1, Temperature: 60}}, []int{4, 5}},
+		{"min. area 5", ClusterOptions{Kind: ClusterHot, Threshold: 40, MinArea: 5}, []Spot{{Name: ClusterHot, X: 5, Y: 1, Temperature: 60}}, []int{5}},
+		{"top 1", ClusterOptions{Kind: ClusterHot, Threshold: 40, Top: 1}, []Spot{{Name: ClusterHot, X: 0, Y: 0, Temperature: 90}}, []int{4}},
+		{"suppressed", ClusterOptions{Kind: ClusterHot, Threshold: 40, Radius: 6}, []Spot{{Name: ClusterHot, X: 0, Y: 0, Temperature: 90}}, []int{4}},
+		{"outside of the radius", ClusterOptions{Kind: ClusterHot, Threshold: 40, Radius: 5}, []Spot{{Name: ClusterHot, X: 0, Y: 0, Temperature: 90}, {Name: ClusterHot, X: 5, Y: 1, Temperature: 60}}, []int{4, 5}},
+		// Clusters of the same peak keep the order of their first pixel
+		{"warm", ClusterOptions{Kind: ClusterHot, Threshold: 5}, []Spot{{Name: ClusterHot, X: 0, Y: 0, Temperature: 90}, {Name: ClusterHot, X: 5, Y: 1, Temperature: 60}, {Name: ClusterHot, X: 8, Y: 3, Temperature: 10}, {Name: ClusterHot, X: 0, Y: 4, Temperature: 10}}, []int{7, 5, 7, 4}},
+		{"cold", ClusterOptions{Kind: ClusterCold, Threshold: 5, MinArea: 10}, []Spot{{Name: ClusterCold, X: 4, Y: 0, Temperature: 0}}, []int{36}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusters := frame.Clusters(tt.opts)
+			if len(clusters) != len(tt.peaks) {
+				t.Fatalf("%d clusters %v, want %d", len(clusters), clusters, len(tt.peaks))
+			}
+			for i, c := range clusters {
+				if c.Rank != i+1 || c.Kind != tt.opts.Kind || c.Peak != tt.peaks[i] || c.Area != tt.areas[i] {
+					t.Errorf("cluster %d: %v, want the peak %+v and %d px", i+1, c, tt.peaks[i], tt.areas[i])
+				}
+			}
+		})
+	}
+	c := frame.Clusters(ClusterOptions{Kind: ClusterHot, Threshold: 40})[0]
+	if c.CentroidX != 0.5 || c.CentroidY != 0.5 || c.Mean != 82.5 || c.Width != 2 || c.Height != 2 {
+		t.Errorf("%v mean %.2f, want the centroid 0.5,0.5, the mean 82.5 and the size 2x2", c, c.Mean)
+	}
+}
+
+func TestParseMarkerStyle(t *testing.T) {
+	tests := []struct {
+		s    string
+		want MarkerStyle
+		err  string
+	}{
+		{"cross", MarkerStyle{Shape: MarkerCross, Labels: true}, ""},
+		{"circle,#00ff00", MarkerStyle{Shape: MarkerCircle, Color: "#00ff00", Labels: true}, ""},
+		{"box,,8,nolabel", MarkerStyle{Shape: MarkerBox, Size: 8}, ""},
+		{"cross,#ff0000,,label", MarkerStyle{Shape: MarkerCross, Color: "#ff0000", Labels: true}, ""},
+		{"", MarkerStyle{Labels: true}, ""},
+		{"star", MarkerStyle{}, "unknown marker shape"},
+		{"cross,red", MarkerStyle{}, "#RRGGBB"},
+		{"cross,#ff00", MarkerStyle{}, "#RRGGBB"},
+		{"cross,,big", MarkerStyle{}, "bad marker size"},
+		{"cross,,-2", MarkerStyle{}, "negative"},
+		{"cross,,2,yes", MarkerStyle{}, "label or nolabel"},
+		{"cross,,2,label,x", MarkerStyle{}, "shape[,color"},
+	}
+	for _, tt := range tests {
+		style, err := ParseMarkerStyle(tt.s)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: error %v, want %q", tt.s, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || style != tt.want {
+			t.Errorf("%q: %+v %v, want %+v", tt.s, style, err, tt.want)
+		}
+	}
+}
+
+func TestClusterOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts ClusterOptions
+		ok   bool
+	}{
+		{ClusterOptions{Kind: ClusterHot, Threshold: 40}, true},
+		{ClusterOptions{Kind: ClusterCold, Threshold: -10, MinArea: 2, Radius: 5, Top: 3}, true},
+		{ClusterOptions{Kind: "warm"}, false},
+		{ClusterOptions{Kind: ClusterHot, Top: -1}, false},
+		{ClusterOptions{Kind: ClusterHot, Style: MarkerStyle{Shape: "star"}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v: error %v", tt.opts, err)
+		}
+	}
+}
@@ -6,575 +6,524 @@ package convertis2
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"image"
 	"image/jpeg"
 	"io"
+	"io/fs"
 	"log"
 	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-
-	"github.com/cryptix/wav"
-	"github.com/fogleman/gg"
-	"github.com/golang/freetype/truetype"
-	"golang.org/x/image/font/gofont/gobold"
-	"golang.org/x/image/font/gofont/goregular"
 )
 
+// Options holds the parameters of a conversion
+type Options struct {
+	// Output files of the infrared and the visual picture. An empty path
+	// skips the output. All output paths are templates for ExpandTemplate.
+	IRFile  string
+	VisFile string
+	// AudioFile is the output of the audio annotation. An empty path writes
+	// the audio to the input file with .wav appended.
+	AudioFile string
+	// Background temperature in degree celsius and the emission factor
+	Background float64
+	Emission   float64
+	// EmissionMask is a grayscale mask of the emission factors of every
+	// file, see ReadEmissionMask. It replaces the mask of the sidecar.
+	EmissionMask string
+	// Manual scale of the colortable. Both 0 selects the automatic scale.
+	MinTemp float64
+	MaxTemp float64
+	// ScaleFactor upscales the infrared picture. Width sets the width of the
+	// infrared picture with its scale in pixels and takes precedence over
+	// ScaleFactor.
+	ScaleFactor float64
+	Width       int
+	// Interpolation of the temperature field: nearest, bilinear or bicubic
+	Interpolation string
+	// Palette of the colortable, see PaletteNames. Empty selects iron.
+	Palette string
+	// FusionFile is the output of the fused visual and infrared picture.
+	// An empty path skips the output.
+	FusionFile string
+	// FusionMode is one of blend, pip, above or below
+	FusionMode string
+	// FusionAlpha is the opacity of the infrared picture in the blend mode.
+	// 0 selects 0.5.
+	FusionAlpha float64
+	// FusionThreshold is the temperature of the above and below modes
+	FusionThreshold float64
+	// Alignment of the infrared picture in the visual picture. nil selects
+	// the alignment of the file.
+	Alignment *Alignment
+	// Format of the outputs: jpeg, png, tiff or bmp. Empty selects the
+	// format from the file extension.
+	Format string
+	// Quality of jpeg outputs from 1 to 100. 0 selects 100.
+	Quality int
+	// RadiometricFile is the output of a FLIR radiometric jpeg with the
+	// raw values and the Planck constants. An empty path skips the output.
+	RadiometricFile string
+	// EdgeStrength embosses the edges of the visual picture onto the
+	// infrared picture. 0 disables the edge enhancement.
+	EdgeStrength float64
+	// Climate of a building survey. The infrared pictures get the overlays
+	// of the condensation and the mold risk areas. nil disables the
+	// building survey.
+	Climate *Climate
+	// Ambient is the reference temperature of the delta-T rules for the
+	// pictures without a ROI named ref, nil has none
+	Ambient *float64
+	// Mode colors the infrared picture by temperature, dew point margin or
+	// fRsi. The building modes need a climate. Empty selects temperature.
+	Mode string
+	// Hotspots draws the numbered boxes of the hotspots onto the infrared
+	// picture. nil disables the hotspot detection.
+	Hotspots *HotspotOptions
+	// Clusters draws the markers of the hot and cold clusters onto the
+	// infrared picture
+	Clusters []ClusterOptions
+	// Logger receives the messages of the conversion. nil selects the
+	// standard logger.
+	Logger *log.Logger
+}
+
+// scale returns the factor between the camera resolution of frame and the
+// output
+func (o Options) scale(frame *Thermogram) float64 {
+	if o.Width > 0 {
+		return float64(o.Width) / layoutWidth(frame)
+	}
+	if o.ScaleFactor > 0 {
+		return o.ScaleFactor
+	}
+	return 1
+}
+
+// manualScale reports whether the colortable has a manual scale
+func (o Options) manualScale() bool {
+	return !(o.MinTemp == 0.0 && o.MaxTemp == 0.0)
+}
+
+// needsVisual reports whether the infrared outputs need the decoded visual
+// picture
+func (o Options) needsVisual() bool {
+	return o.FusionFile != "" || o.EdgeStrength > 0
+}
+
+// palette returns the name of the palette, iron by default
+func (o Options) palette() string {
+	if o.Palette == "" {
+		return PaletteIron
+	}
+	return o.Palette
+}
+
+// logger returns the logger of the conversion
+func (o Options) logger() *log.Logger {
+	if o.Logger == nil {
+		return log.Default()
+	}
+	return o.Logger
+}
+
+// interpolation returns the interpolation method, nearest by default
+func (o Options) interpolation() string {
+	if o.Interpolation == "" {
+		return InterpolationNearest
+	}
+	return o.Interpolation
+}
+
+// mode returns the render mode, temperature by default
+func (o Options) mode() string {
+	if o.Mode == "" {
+		return ModeTemperature
+	}
+	return o.Mode
+}
+
 // Audio 784080
 // ConvertIS2 converts FLUKE .IS2 files in a infrared picture and a visual picture (.jpg)
 func ConvertIS2(filename string, irfilepath string, visfilepath string, bgtemp float64, emission float64, mintemp float64, maxtemp float64) {
-	// Fileformat is2
-	// 0 unknown
-	// 1 Old is2 format (raw,uncompressed,binary)
-	// 2 New is2 format (zip based format)
-	// fileversion := 0
-
-	err := decodeNewIS2(filename, irfilepath, visfilepath, bgtemp, emission, mintemp, maxtemp)
+	err := Convert(filename, Options{
+		IRFile:     irfilepath,
+		VisFile:    visfilepath,
+		Background: bgtemp,
+		Emission:   emission,
+		MinTemp:    mintemp,
+		MaxTemp:    maxtemp,
+	})
 	if err != nil {
-		err2 := decodeOldIS2(filename, irfilepath, visfilepath, bgtemp, emission, mintemp, maxtemp)
-		if err2 == nil {
-			//fileversion = 1
-			log.Println("Fileversion 1 detected.")
-		} else {
-			log.Fatalln("Unknown is2 format.", err2)
-		}
-	} else {
-		//fileversion = 2
-		log.Println("Fileversion 2 detected.")
+		log.Fatalln(err)
 	}
-
 }
 
-func decodeIS2IRBinaryData2JPG(offset int64, file *os.File, filename string, bgtemp float64, emission float64, mintemp float64, maxtemp float64) error {
-	_, err := file.Seek(offset, 0)
-	if err != nil {
-		return err
+// Validate checks the options
+func (o Options) Validate() error {
+	if !validInterpolation(o.Interpolation) {
+		return fmt.Errorf("%s: unknown interpolation.", o.Interpolation)
 	}
-	var w uint16
-	var r, g, b uint8
-	// fluke hot iron palette
-	ironpalette := []string{"#00000a", "#000014", "#00001e", "#000025", "#00002a", "#00002e", "#000032", "#000036", "#00003a", "#00003e", "#000042", "#000046", "#00004a", "#00004f", "#000052", "#010055", "#010057", "#020059", "#02005c", "#03005e", "#040061", "#040063", "#050065", "#060067", "#070069", "#08006b", "#09006e", "#0a0070", "#0b0073", "#0c0074", "#0d0075", "#0d0076", "#0e0077", "#100078", "#120079", "#13007b", "#15007c", "#17007d", "#19007e", "#1b0080", "#1c0081", "#1e0083", "#200084", "#220085", "#240086", "#260087", "#280089", "#2a0089", "#2c008a", "#2e008b", "#30008c", "#32008d", "#34008e", "#36008e", "#38008f", "#390090", "#3b0091", "#3c0092", "#3e0093", "#3f0093", "#410094", "#420095", "#440095", "#450096", "#470096", "#490096", "#4a0096", "#4c0097", "#4e0097", "#4f0097", "#510097", "#520098", "#540098", "#560098", "#580099", "#5a0099", "#5c0099", "#5d009a", "#5f009a", "#61009b", "#63009b", "#64009b", "#66009b", "#68009b", "#6a009b", "#6c009c", "#6d009c", "#6f009c", "#70009c", "#71009d", "#73009d", "#75009d", "#77009d", "#78009d", "#7a009d", "#7c009d", "#7e009d", "#7f009d", "#81009d", "#83009d", "#84009d", "#86009d", "#87009d", "#89009d", "#8a009d", "#8b009d", "#8d009d", "#8f009c", "#91009c", "#93009c", "#95009c", "#96009b", "#98009b", "#99009b", "#9b009b", "#9c009b", "#9d009b", "#9f009b", "#a0009b", "#a2009b", "#a3009b", "#a4009b", "#a6009a", "#a7009a", "#a8009a", "#a90099", "#aa0099", "#ab0099", "#ad0099", "#ae0198", "#af0198", "#b00198", "#b00198", "#b10197", "#b20197", "#b30196", "#b40296", "#b50295", "#b60295", "#b70395", "#b80395", "#b90495", "#ba0495", "#ba0494", "#bb0593", "#bc0593", "#bd0593", "#be0692", "#bf0692", "#bf0692", "#c00791", "#c00791", "#c10890", "#c10990", "#c20a8f", "#c30a8e", "#c30b8e", "#c40c8d", "#c50c8c", "#c60d8b", "#c60e8a", "#c70f89", "#c81088", "#c91187", "#ca1286", "#ca1385", "#cb1385", "#cb1484", "#cc1582", "#cd1681", "#ce1780", "#ce187e", "#cf187c", "#cf197b", "#d01a79", "#d11b78", "#d11c76", "#d21c75", "#d21d74", "#d31e72", "#d32071", "#d4216f", "#d4226e", "#d5236b", "#d52469", "#d62567", "#d72665", "#d82764", "#d82862", "#d92a60", "#da2b5e", "#da2c5c", "#db2e5a", "#db2f57", "#dc2f54", "#dd3051", "#dd314e", "#de324a", "#de3347", "#df3444", "#df3541", "#df363d", "#e0373a", "#e03837", "#e03933", "#e13a30", "#e23b2d", "#e23c2a", "#e33d26", "#e33e23", "#e43f20", "#e4411d", "#e4421c", "#e5431b", "#e54419", "#e54518", "#e64616", "#e74715", "#e74814", "#e74913", "#e84a12", "#e84c10", "#e84c0f", "#e94d0e", "#e94d0d", "#ea4e0c", "#ea4f0c", "#eb500b", "#eb510a", "#eb520a", "#eb5309", "#ec5409", "#ec5608", "#ec5708", "#ec5808", "#ed5907", "#ed5a07", "#ed5b06", "#ee5c06", "#ee5c05", "#ee5d05", "#ee5e05", "#ef5f04", "#ef6004", "#ef6104", "#ef6204", "#f06303", "#f06403", "#f06503", "#f16603", "#f16603", "#f16703", "#f16803", "#f16902", "#f16a02", "#f16b02", "#f16b02", "#f26c01", "#f26d01", "#f26e01", "#f36f01", "#f37001", "#f37101", "#f37201", "#f47300", "#f47400", "#f47500", "#f47600", "#f47700", "#f47800", "#f47a00", "#f57b00", "#f57c00", "#f57e00", "#f57f00", "#f68000", "#f68100", "#f68200", "#f78300", "#f78400", "#f78500", "#f78600", "#f88700", "#f88800", "#f88800", "#f88900", "#f88a00", "#f88b00", "#f88c00", "#f98d00", "#f98d00", "#f98e00", "#f98f00", "#f99000", "#f99100", "#f99200", "#f99300", "#fa9400", "#fa9500", "#fa9600", "#fb9800", "#fb9900", "#fb9a00", "#fb9c00", "#fc9d00", "#fc9f00", "#fca000", "#fca100", "#fda200", "#fda300", "#fda400", "#fda600", "#fda700", "#fda800", "#fdaa00", "#fdab00", "#fdac00", "#fdad00", "#fdae00", "#feaf00", "#feb000", "#feb100", "#feb200", "#feb300", "#feb400", "#feb500", "#feb600", "#feb800", "#feb900", "#feb900", "#feba00", "#febb00", "#febc00", "#febd00", "#febe00", "#fec000", "#fec100", "#fec200", "#fec300", "#fec400", "#fec500", "#fec600", "#fec700", "#fec800", "#fec901", "#feca01", "#feca01", "#fecb01", "#fecc02", "#fecd02", "#fece03", "#fecf04", "#fecf04", "#fed005", "#fed106", "#fed308", "#fed409", "#fed50a", "#fed60a", "#fed70b", "#fed80c", "#fed90d", "#ffda0e", "#ffda0e", "#ffdb10", "#ffdc12", "#ffdc14", "#ffdd16", "#ffde19", "#ffde1b", "#ffdf1e", "#ffe020", "#ffe122", "#ffe224", "#ffe226", "#ffe328", "#ffe42b", "#ffe42e", "#ffe531", "#ffe635", "#ffe638", "#ffe73c", "#ffe83f", "#ffe943", "#ffea46", "#ffeb49", "#ffeb4d", "#ffec50", "#ffed54", "#ffee57", "#ffee5b", "#ffee5f", "#ffef63", "#ffef67", "#fff06a", "#fff06e", "#fff172", "#fff177", "#fff17b", "#fff280", "#fff285", "#fff28a", "#fff38e", "#fff492", "#fff496", "#fff49a", "#fff59e", "#fff5a2", "#fff5a6", "#fff6aa", "#fff6af", "#fff7b3", "#fff7b6", "#fff8ba", "#fff8bd", "#fff8c1", "#fff8c4", "#fff9c7", "#fff9ca", "#fff9cd", "#fffad1", "#fffad4", "#fffbd8", "#fffcdb", "#fffcdf", "#fffde2", "#fffde5", "#fffde8", "#fffeeb", "#fffeee", "#fffef1", "#fffef4", "#fffff6"}
-	minvalue := uint16(65535)
-	maxvalue := uint16(0)
-	var mintemppointx int
-	var mintemppointy int
-	var maxtemppointx int
-	var maxtemppointy int
-	for y := 0; y < 240; y++ {
-		for x := 0; x < 320; x++ {
-			err := binary.Read(file, binary.LittleEndian, &w)
-			if err != nil {
-				return err
-			}
-			if minvalue > w {
-				minvalue = w
-				mintemppointx = x
-				mintemppointy = y
-			}
-			if maxvalue < w {
-				maxvalue = w
-				maxtemppointx = x
-				maxtemppointy = y
-			}
+	if o.ScaleFactor < 0 || o.Width < 0 {
+		return fmt.Errorf("Scale factor and width must not be negative.")
+	}
+	if Palette(o.palette()) == nil {
+		return fmt.Errorf("%s: unknown palette.", o.Palette)
+	}
+	if !validFusion(o.FusionMode) {
+		return fmt.Errorf("%s: unknown fusion mode.", o.FusionMode)
+	}
+	if o.FusionAlpha < 0 || o.FusionAlpha > 1 {
+		return fmt.Errorf("Fusion alpha must be between 0 and 1.")
+	}
+	if !validFormat(o.Format) {
+		return fmt.Errorf("%s: unknown output format.", o.Format)
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("Quality must be between 1 and 100, 0 selects 100.")
+	}
+	if o.EdgeStrength < 0 {
+		return fmt.Errorf("Edge strength must not be negative.")
+	}
+	if !validMode(o.Mode) {
+		return fmt.Errorf("%s: unknown mode.", o.Mode)
+	}
+	if o.Climate != nil {
+		err := o.Climate.Validate()
+		if err != nil {
+			return err
 		}
+	} else if o.mode() != ModeTemperature {
+		return fmt.Errorf("%s: the mode needs the indoor and outdoor climate.", o.Mode)
 	}
-	mintemperature := raypower2degrees(uint16(float64(minvalue)*0.662+228), bgtemp, emission)
-	maxtemperature := raypower2degrees(uint16(float64(maxvalue)*0.662+228), bgtemp, emission)
-	log.Printf("Min. and Max. temperature in the file:\n")
-	log.Printf("Temperature min=%.2f °C\n", mintemperature)
-	log.Printf("Temperature max=%.2f °C\n", maxtemperature)
-
-	mintemperaturescale := mintemperature
-	maxtemperaturescale := maxtemperature
-	if !(mintemp == 0.0 && maxtemp == 0.0) {
-		mintemperaturescale = mintemp
-		maxtemperaturescale = maxtemp
-		log.Printf("Manuel scale of colortable:\n")
-		log.Printf("Temperature min=%.2f °C\n", mintemperaturescale)
-		log.Printf("Temperature max=%.2f °C\n", maxtemperaturescale)
-	} else {
-		log.Printf("Automatic scale of the colortable.\n")
+	if o.Hotspots != nil {
+		err := o.Hotspots.Validate()
+		if err != nil {
+			return err
+		}
 	}
-	colorstep := 433 / (maxtemperaturescale - mintemperaturescale)
+	for _, c := range o.Clusters {
+		err := c.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	log.Printf("Backgroundtemperature=%.2f °C\n", bgtemp)
-	log.Printf("Emission factor=%.2f\n", emission)
-	irImage := gg.NewContext(390, 240)
-	font, err := truetype.Parse(goregular.TTF)
+// Convert converts FLUKE .IS2 files in a infrared picture and a visual
+// picture (.jpg) with the given options.
+func Convert(filename string, opts Options) error {
+	err := opts.Validate()
 	if err != nil {
-		//log.Fatal(err)
 		return err
 	}
-	fontbold, err := truetype.Parse(gobold.TTF)
+	frame, err := decodeOptions(filename, opts)
 	if err != nil {
-		//log.Fatal(err)
 		return err
 	}
-	face := truetype.NewFace(font, &truetype.Options{Size: 14})
-	irImage.SetFontFace(face)
-	_, err = file.Seek(offset, 0)
-	if err != nil {
-		return err
+	switch frame.Format {
+	case FormatOldIS2:
+		opts.logger().Println("Fileversion 1 detected.")
+	case FormatNewIS2:
+		opts.logger().Println("Fileversion 2 detected.")
+	default:
+		opts.logger().Println(frame.Format, "format detected.")
 	}
-	irImage.SetRGBA(1, 1, 1, 1)
-	irImage.Clear()
-	for y := 0; y < 240; y++ {
-		for x := 0; x < 320; x++ {
-			err = binary.Read(file, binary.LittleEndian, &w)
-			if err != nil {
-				return err
-			}
-			temperature := raypower2degrees(uint16(float64(w)*0.662+228), bgtemp, emission)
-			ci := AbsFloat64(mintemperaturescale-temperature) * colorstep
-			if ci > 432 {
-				ci = 432
-			}
-			r, g, b = HTMLColorToRGB(ironpalette[int64(ci)])
-			irImage.SetRGB255(int(r), int(g), int(b))
-			irImage.SetPixel(x, y)
+	return writeOutputs(frame, filename, opts)
+}
+
+// writeOutputs writes the outputs of the options for the decoded file
+func writeOutputs(frame *Thermogram, filename string, opts Options) error {
+	if frame.Visual == nil && opts.needsVisual() {
+		return fmt.Errorf("%s: The file has no visual picture.", filename)
+	}
+	meta := frame.Metadata.measurement(frame, opts)
+	if opts.IRFile != "" {
+		irfilepath := outputPath(opts.IRFile, filename, opts.extension(), opts)
+		err := writeIRImage(frame, frame.Visual, irfilepath, opts, meta)
+		if err != nil {
+			return fmt.Errorf("Can't encode infrared data. %w %s", err, irfilepath)
 		}
 	}
-	colorstep = 433.0 / 221.0
-	for y := 0; y < 221; y++ {
-		ci := 432 - colorstep*float64(y)
-		if ci >= 433 {
-			ci = 432
+	if opts.VisFile != "" {
+		err := writeVisualImage(frame, outputPath(opts.VisFile, filename, opts.extension(), opts), opts, meta)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.FusionFile != "" {
+		fusionfilepath := outputPath(opts.FusionFile, filename, opts.extension(), opts)
+		err := writeFusedImage(frame, frame.Visual, fusionfilepath, opts, meta)
+		if err != nil {
+			return fmt.Errorf("Can't encode fused picture. %w %s", err, fusionfilepath)
+		}
+	}
+	if opts.RadiometricFile != "" {
+		radiometricfilepath := outputPath(opts.RadiometricFile, filename, ".jpg", opts)
+		err := writeRadiometricJPEG(frame, radiometricfilepath, opts, meta)
+		if err != nil {
+			return fmt.Errorf("Can't encode radiometric jpeg. %w %s", err, radiometricfilepath)
+		}
+	}
+	if len(frame.Audio) > 0 {
+		audiofilepath := filename + ".wav"
+		if opts.AudioFile != "" {
+			audiofilepath = outputPath(opts.AudioFile, filename, ".wav", opts)
+		}
+		err := writeWAV(audiofilepath, frame.Audio, frame.AudioRate)
+		if err != nil {
+			return fmt.Errorf("Error while writing. %w %s", err, audiofilepath)
 		}
-		r, g, b = HTMLColorToRGB(ironpalette[int(ci)])
-		irImage.SetLineWidth(1)
-		irImage.SetRGB255(int(r), int(g), int(b))
-		irImage.DrawLine(320, float64(y), 335, float64(y))
-		irImage.Stroke()
-	}
-	irImage.SetRGB255(0, 0, 0)
-	irImage.DrawRectangle(320, 0, 15, 220)
-	irImage.Stroke()
-	irImage.DrawLine(320, 8, 335, 8)
-	irImage.DrawString(fmt.Sprintf("%.1f", maxtemperaturescale), 353, 13)
-	irImage.DrawLine(320, 213, 335, 213)
-	irImage.DrawString(fmt.Sprintf("%.1f", mintemperaturescale), 353, 219)
-	irImage.DrawLine(344, 8, 344, 213)
-	irImage.DrawLine(344, 8, 350, 8)
-	tempstep := (maxtemperaturescale - mintemperaturescale) / 9
-	for i := 24; i < 224; i = i + 25 {
-		temp := (tempstep * ((((224 - float64(i)) - 24) / 25) + 1)) + mintemperaturescale
-		irImage.DrawLine(344, float64(i), 350, float64(i))
-		irImage.DrawString(fmt.Sprintf("%.0f", temp), 353, float64(i)+4)
-	}
-	irImage.DrawLine(344, 213, 350, 213)
-	irImage.DrawString("°C", 346, 234)
-	irImage.Stroke()
-	irImage.SetRGB255(0, 0, 0)
-	face2 := truetype.NewFace(fontbold, &truetype.Options{Size: 13})
-	irImage.SetFontFace(face2)
-	irImage.SetLineWidth(4)
-	irImage.DrawLine(float64(mintemppointx)-4, float64(mintemppointy), float64(mintemppointx)+4, float64(mintemppointy))
-	irImage.DrawLine(float64(mintemppointx), float64(mintemppointy)-4, float64(mintemppointx), float64(mintemppointy)+4)
-	irImage.DrawString(fmt.Sprintf("%.1f", mintemperature), float64(mintemppointx)-12, float64(mintemppointy)-6)
-	irImage.Stroke()
-	irImage.DrawLine(float64(maxtemppointx)-4, float64(maxtemppointy), float64(maxtemppointx)+4, float64(maxtemppointy))
-	irImage.DrawLine(float64(maxtemppointx), float64(maxtemppointy)-4, float64(maxtemppointx), float64(maxtemppointy)+4)
-	irImage.DrawString(fmt.Sprintf("%.1f", maxtemperature), float64(maxtemppointx)-12, float64(maxtemppointy)-6)
-	irImage.Stroke()
-	irImage.SetRGBA255(200, 200, 255, 230)
-	face = truetype.NewFace(font, &truetype.Options{Size: 12})
-	irImage.SetFontFace(face)
-	irImage.SetLineWidth(1)
-	irImage.DrawLine(float64(mintemppointx)-3, float64(mintemppointy), float64(mintemppointx)+3, float64(mintemppointy))
-	irImage.DrawLine(float64(mintemppointx), float64(mintemppointy)-3, float64(mintemppointx), float64(mintemppointy)+3)
-	irImage.DrawString(fmt.Sprintf("%.1f", mintemperature), float64(mintemppointx)-12, float64(mintemppointy)-6)
-	irImage.Stroke()
-	irImage.SetRGBA255(255, 200, 200, 230)
-	irImage.DrawLine(float64(maxtemppointx)-2, float64(maxtemppointy), float64(maxtemppointx)+2, float64(maxtemppointy))
-	irImage.DrawLine(float64(maxtemppointx), float64(maxtemppointy)-2, float64(maxtemppointx), float64(maxtemppointy)+2)
-	irImage.DrawString(fmt.Sprintf("%.1f", maxtemperature), float64(maxtemppointx)-12, float64(maxtemppointy)-6)
-	irImage.Stroke()
-	outFile, _ := os.Create(filename)
-	defer outFile.Close()
-	jpegerr := jpeg.Encode(outFile, irImage.Image(), &jpeg.Options{Quality: 100})
-	if jpegerr != nil {
-		log.Fatalln("Can't encode jpeg format.", jpegerr, filename)
 	}
 	return nil
 }
 
-func decodeNEWIS2IRBinaryData2JPG(offset int64, file *os.File, filename string, bgtemp float64, emission float64, mintemp float64, maxtemp float64) error {
-	_, err := file.Seek(offset, 0)
+// outputPath returns the path of an output. The path is a template for
+// ExpandTemplate with the file extension ext of the output format. Outputs
+// into a directory are named after the input file.
+func outputPath(path string, filename string, ext string, opts Options) string {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		opts.logger().Println(path, "is a directory.")
+		path = filepath.Join(path, "{name}.{ext}")
+	}
+	path = ExpandTemplate(path, filename, ext)
+	if _, err := os.Stat(path); err == nil {
+		opts.logger().Println("Overwrite:", path)
+	} else {
+		opts.logger().Println("Create:", path)
+	}
+	return path
+}
+
+// writeVisualImage writes the visual picture to filename. A jpeg of the
+// camera is copied with the measurement parameters added, other pictures
+// are encoded.
+func writeVisualImage(frame *Thermogram, filename string, opts Options, meta *Metadata) error {
+	if frame.Visual == nil && frame.VisualJPEG == nil {
+		opts.logger().Println("The file has no visual picture.")
+		return nil
+	}
+	visdata, err := encodeVisual(frame, opts.formatOf(filename), opts, meta)
 	if err != nil {
-		return err
+		return fmt.Errorf("Can't encode visual picture. %w %s", err, filename)
 	}
-	var w uint16
-	var r, g, b uint8
-	// fluke hot iron palette
-	ironpalette := []string{"#00000a", "#000014", "#00001e", "#000025", "#00002a", "#00002e", "#000032", "#000036", "#00003a", "#00003e", "#000042", "#000046", "#00004a", "#00004f", "#000052", "#010055", "#010057", "#020059", "#02005c", "#03005e", "#040061", "#040063", "#050065", "#060067", "#070069", "#08006b", "#09006e", "#0a0070", "#0b0073", "#0c0074", "#0d0075", "#0d0076", "#0e0077", "#100078", "#120079", "#13007b", "#15007c", "#17007d", "#19007e", "#1b0080", "#1c0081", "#1e0083", "#200084", "#220085", "#240086", "#260087", "#280089", "#2a0089", "#2c008a", "#2e008b", "#30008c", "#32008d", "#34008e", "#36008e", "#38008f", "#390090", "#3b0091", "#3c0092", "#3e0093", "#3f0093", "#410094", "#420095", "#440095", "#450096", "#470096", "#490096", "#4a0096", "#4c0097", "#4e0097", "#4f0097", "#510097", "#520098", "#540098", "#560098", "#580099", "#5a0099", "#5c0099", "#5d009a", "#5f009a", "#61009b", "#63009b", "#64009b", "#66009b", "#68009b", "#6a009b", "#6c009c", "#6d009c", "#6f009c", "#70009c", "#71009d", "#73009d", "#75009d", "#77009d", "#78009d", "#7a009d", "#7c009d", "#7e009d", "#7f009d", "#81009d", "#83009d", "#84009d", "#86009d", "#87009d", "#89009d", "#8a009d", "#8b009d", "#8d009d", "#8f009c", "#91009c", "#93009c", "#95009c", "#96009b", "#98009b", "#99009b", "#9b009b", "#9c009b", "#9d009b", "#9f009b", "#a0009b", "#a2009b", "#a3009b", "#a4009b", "#a6009a", "#a7009a", "#a8009a", "#a90099", "#aa0099", "#ab0099", "#ad0099", "#ae0198", "#af0198", "#b00198", "#b00198", "#b10197", "#b20197", "#b30196", "#b40296", "#b50295", "#b60295", "#b70395", "#b80395", "#b90495", "#ba0495", "#ba0494", "#bb0593", "#bc0593", "#bd0593", "#be0692", "#bf0692", "#bf0692", "#c00791", "#c00791", "#c10890", "#c10990", "#c20a8f", "#c30a8e", "#c30b8e", "#c40c8d", "#c50c8c", "#c60d8b", "#c60e8a", "#c70f89", "#c81088", "#c91187", "#ca1286", "#ca1385", "#cb1385", "#cb1484", "#cc1582", "#cd1681", "#ce1780", "#ce187e", "#cf187c", "#cf197b", "#d01a79", "#d11b78", "#d11c76", "#d21c75", "#d21d74", "#d31e72", "#d32071", "#d4216f", "#d4226e", "#d5236b", "#d52469", "#d62567", "#d72665", "#d82764", "#d82862", "#d92a60", "#da2b5e", "#da2c5c", "#db2e5a", "#db2f57", "#dc2f54", "#dd3051", "#dd314e", "#de324a", "#de3347", "#df3444", "#df3541", "#df363d", "#e0373a", "#e03837", "#e03933", "#e13a30", "#e23b2d", "#e23c2a", "#e33d26", "#e33e23", "#e43f20", "#e4411d", "#e4421c", "#e5431b", "#e54419", "#e54518", "#e64616", "#e74715", "#e74814", "#e74913", "#e84a12", "#e84c10", "#e84c0f", "#e94d0e", "#e94d0d", "#ea4e0c", "#ea4f0c", "#eb500b", "#eb510a", "#eb520a", "#eb5309", "#ec5409", "#ec5608", "#ec5708", "#ec5808", "#ed5907", "#ed5a07", "#ed5b06", "#ee5c06", "#ee5c05", "#ee5d05", "#ee5e05", "#ef5f04", "#ef6004", "#ef6104", "#ef6204", "#f06303", "#f06403", "#f06503", "#f16603", "#f16603", "#f16703", "#f16803", "#f16902", "#f16a02", "#f16b02", "#f16b02", "#f26c01", "#f26d01", "#f26e01", "#f36f01", "#f37001", "#f37101", "#f37201", "#f47300", "#f47400", "#f47500", "#f47600", "#f47700", "#f47800", "#f47a00", "#f57b00", "#f57c00", "#f57e00", "#f57f00", "#f68000", "#f68100", "#f68200", "#f78300", "#f78400", "#f78500", "#f78600", "#f88700", "#f88800", "#f88800", "#f88900", "#f88a00", "#f88b00", "#f88c00", "#f98d00", "#f98d00", "#f98e00", "#f98f00", "#f99000", "#f99100", "#f99200", "#f99300", "#fa9400", "#fa9500", "#fa9600", "#fb9800", "#fb9900", "#fb9a00", "#fb9c00", "#fc9d00", "#fc9f00", "#fca000", "#fca100", "#fda200", "#fda300", "#fda400", "#fda600", "#fda700", "#fda800", "#fdaa00", "#fdab00", "#fdac00", "#fdad00", "#fdae00", "#feaf00", "#feb000", "#feb100", "#feb200", "#feb300", "#feb400", "#feb500", "#feb600", "#feb800", "#feb900", "#feb900", "#feba00", "#febb00", "#febc00", "#febd00", "#febe00", "#fec000", "#fec100", "#fec200", "#fec300", "#fec400", "#fec500", "#fec600", "#fec700", "#fec800", "#fec901", "#feca01", "#feca01", "#fecb01", "#fecc02", "#fecd02", "#fece03", "#fecf04", "#fecf04", "#fed005", "#fed106", "#fed308", "#fed409", "#fed50a", "#fed60a", "#fed70b", "#fed80c", "#fed90d", "#ffda0e", "#ffda0e", "#ffdb10", "#ffdc12", "#ffdc14", "#ffdd16", "#ffde19", "#ffde1b", "#ffdf1e", "#ffe020", "#ffe122", "#ffe224", "#ffe226", "#ffe328", "#ffe42b", "#ffe42e", "#ffe531", "#ffe635", "#ffe638", "#ffe73c", "#ffe83f", "#ffe943", "#ffea46", "#ffeb49", "#ffeb4d", "#ffec50", "#ffed54", "#ffee57", "#ffee5b", "#ffee5f", "#ffef63", "#ffef67", "#fff06a", "#fff06e", "#fff172", "#fff177", "#fff17b", "#fff280", "#fff285", "#fff28a", "#fff38e", "#fff492", "#fff496", "#fff49a", "#fff59e", "#fff5a2", "#fff5a6", "#fff6aa", "#fff6af", "#fff7b3", "#fff7b6", "#fff8ba", "#fff8bd", "#fff8c1", "#fff8c4", "#fff9c7", "#fff9ca", "#fff9cd", "#fffad1", "#fffad4", "#fffbd8", "#fffcdb", "#fffcdf", "#fffde2", "#fffde5", "#fffde8", "#fffeeb", "#fffeee", "#fffef1", "#fffef4", "#fffff6"}
-	minvalue := uint16(65535)
-	maxvalue := uint16(0)
-	var mintemppointx int
-	var mintemppointy int
-	var maxtemppointx int
-	var maxtemppointy int
-	for y := 0; y < 240; y++ {
-		for x := 0; x < 320; x++ {
-			err := binary.Read(file, binary.LittleEndian, &w)
-			if err != nil {
-				return err
-			}
-			if minvalue > w {
-				minvalue = w
-				mintemppointx = x
-				mintemppointy = y
-			}
-			if maxvalue < w {
-				maxvalue = w
-				maxtemppointx = x
-				maxtemppointy = y
-			}
+	return os.WriteFile(filename, visdata, 0666)
+}
+
+// encodeVisual encodes the visual picture of the frame in format
+func encodeVisual(frame *Thermogram, format string, opts Options, meta *Metadata) ([]byte, error) {
+	if frame.VisualJPEG != nil && format == FormatJPEG {
+		if meta == nil {
+			return frame.VisualJPEG, nil
 		}
+		return embedJPEG(frame.VisualJPEG, meta)
 	}
-	//
-	// DEBUG
-	// For calibrationa a picture with min temp of 9.9 and a max temp of 18.9
-	// For example:
-	// calibrate(9.9, 18.9, float64(minvalue), float64(maxvalue), bgtemp, emission)
-	// Result = 0.20100000000000015 154.0349999999324
-	// The resulting function with calibrated values:
-	// raypower2degrees(uint16(float64(minvalue)*0.201+154.035), bgtemp, emission)
-	//
-	mintemperature := raypower2degrees(uint16(float64(minvalue)*0.201+154.035), bgtemp, emission)
-	maxtemperature := raypower2degrees(uint16(float64(maxvalue)*0.201+154.035), bgtemp, emission)
-	log.Printf("Min. and Max. temperature in the file:\n")
-	log.Printf("Temperature min=%.2f °C\n", mintemperature)
-	log.Printf("Temperature max=%.2f °C\n", maxtemperature)
-
-	mintemperaturescale := mintemperature
-	maxtemperaturescale := maxtemperature
-	if !(mintemp == 0.0 && maxtemp == 0.0) {
-		mintemperaturescale = mintemp
-		maxtemperaturescale = maxtemp
-		log.Printf("Manual scale of the colortable:\n")
-		log.Printf("Temperature min=%.2f °C\n", mintemperaturescale)
-		log.Printf("Temperature max=%.2f °C\n", maxtemperaturescale)
-	} else {
-		log.Printf("Automatic scale of the colortable.\n")
+	if frame.Visual == nil {
+		return nil, fmt.Errorf("The file has no visual picture.")
 	}
-	colorstep := 433 / (maxtemperaturescale - mintemperaturescale)
+	return encodeImage(frame.Visual, format, opts, meta)
+}
 
-	log.Printf("Backgroundtemperature=%.2f °C\n", bgtemp)
-	log.Printf("Emission factor=%.2f\n", emission)
+// writeWAV writes 16 bit little endian mono samples as wav file
+func writeWAV(filename string, samples []byte, rate int) error {
+	return os.WriteFile(filename, wavData(samples, rate), 0666)
+}
 
-	/*mintemperature := raypower2degrees(uint16(float64(minvalue)*0.201+154.035), bgtemp, emission)
-	maxtemperature := raypower2degrees(uint16(float64(maxvalue)*0.201+154.035), bgtemp, emission)
-	mintemperaturescale := mintemperature
-	maxtemperaturescale := maxtemperature
-	if !(mintemp == 0.0 && maxtemp == 0.0) {
-		mintemperaturescale = mintemp
-		maxtemperaturescale = maxtemp
-	}
-	colorstep := 433 / (maxtemperaturescale - mintemperaturescale)
-	log.Printf("Temperature min=%.2f °C\n", mintemperature)
-	log.Printf("Temperature max=%.2f °C\n", maxtemperature)
-	log.Printf("Hintergrundtemperatur=%.2f °C\n", bgtemp)
-	log.Printf("Emissionsgrad=%.2f\n", emission)*/
+// Names of the is2 formats
+const (
+	FormatOldIS2 = "is2-old"
+	FormatNewIS2 = "is2-new"
+)
 
-	irImage := gg.NewContext(390, 240)
-	font, err := truetype.Parse(goregular.TTF)
-	if err != nil {
-		return err
-	}
-	fontbold, err := truetype.Parse(gobold.TTF)
+// Calibration values of the cameras. A raw value of the infrared data is
+// converted with value*gain+bias to the ray power.
+//
+// DEBUG
+// For calibrationa a picture with min temp of 9.9 and a max temp of 18.9
+// For example:
+// calibrate(9.9, 18.9, float64(minvalue), float64(maxvalue), bgtemp, emission)
+// Result = 0.20100000000000015 154.0349999999324
+// The resulting function with calibrated values:
+// raypower2degrees(uint16(float64(minvalue)*0.201+154.035), bgtemp, emission)
+const (
+	oldIS2Gain = 0.662
+	oldIS2Bias = 228
+	newIS2Gain = 0.201
+	newIS2Bias = 154.035
+)
+
+// readIRFrame reads the 320x240 raw infrared values at offset. The raw
+// values are converted with the calibration values gain and bias.
+func readIRFrame(file io.ReadSeeker, offset int64, format string, gain float64, bias float64, p Params) (*Thermogram, error) {
+	_, err := file.Seek(offset, 0)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	face := truetype.NewFace(font, &truetype.Options{Size: 14})
-	irImage.SetFontFace(face)
-	_, err = file.Seek(offset, 0)
+	raw, err := readUint16s(file, 320*240)
 	if err != nil {
-		return err
-	}
-	irImage.SetRGBA(1, 1, 1, 1)
-	irImage.Clear()
-	for y := 0; y < 240; y++ {
-		for x := 0; x < 320; x++ {
-			err = binary.Read(file, binary.LittleEndian, &w)
-			if err != nil {
-				return err
-			}
-			temperature := raypower2degrees(uint16(float64(w)*0.201+154.035), bgtemp, emission)
-			ci := AbsFloat64(mintemperaturescale-temperature) * colorstep
-			if ci > 432 {
-				ci = 432
-			}
-			r, g, b = HTMLColorToRGB(ironpalette[int64(ci)])
-			irImage.SetRGB255(int(r), int(g), int(b))
-			irImage.SetPixel(x, y)
-		}
+		return nil, err
 	}
-	colorstep = 433.0 / 221.0
-	for y := 0; y < 221; y++ {
-		ci := 432 - colorstep*float64(y)
-		if ci >= 433 {
-			ci = 432
-		}
-		r, g, b = HTMLColorToRGB(ironpalette[int(ci)])
-		irImage.SetLineWidth(1)
-		irImage.SetRGB255(int(r), int(g), int(b))
-		irImage.DrawLine(320, float64(y), 335, float64(y))
-		irImage.Stroke()
-	}
-	irImage.SetRGB255(0, 0, 0)
-	irImage.DrawRectangle(320, 0, 15, 220)
-	irImage.Stroke()
-	irImage.DrawLine(320, 8, 335, 8)
-	irImage.DrawString(fmt.Sprintf("%.1f", maxtemperaturescale), 353, 13)
-	irImage.DrawLine(320, 213, 335, 213)
-	irImage.DrawString(fmt.Sprintf("%.1f", mintemperaturescale), 353, 219)
-	irImage.DrawLine(344, 8, 344, 213)
-	irImage.DrawLine(344, 8, 350, 8)
-	tempstep := (maxtemperaturescale - mintemperaturescale) / 9
-	for i := 24; i < 224; i = i + 25 {
-		temp := (tempstep * ((((224 - float64(i)) - 24) / 25) + 1)) + mintemperaturescale
-		irImage.DrawLine(344, float64(i), 350, float64(i))
-		irImage.DrawString(fmt.Sprintf("%.0f", temp), 353, float64(i)+4)
-	}
-	irImage.DrawLine(344, 213, 350, 213)
-	irImage.DrawString("°C", 346, 234)
-	irImage.Stroke()
-	irImage.SetRGB255(0, 0, 0)
-	face2 := truetype.NewFace(fontbold, &truetype.Options{Size: 13})
-	irImage.SetFontFace(face2)
-	irImage.SetLineWidth(4)
-	irImage.DrawLine(float64(mintemppointx)-4, float64(mintemppointy), float64(mintemppointx)+4, float64(mintemppointy))
-	irImage.DrawLine(float64(mintemppointx), float64(mintemppointy)-4, float64(mintemppointx), float64(mintemppointy)+4)
-	irImage.DrawString(fmt.Sprintf("%.1f", mintemperature), float64(mintemppointx)-12, float64(mintemppointy)-6)
-	irImage.Stroke()
-	irImage.DrawLine(float64(maxtemppointx)-4, float64(maxtemppointy), float64(maxtemppointx)+4, float64(maxtemppointy))
-	irImage.DrawLine(float64(maxtemppointx), float64(maxtemppointy)-4, float64(maxtemppointx), float64(maxtemppointy)+4)
-	irImage.DrawString(fmt.Sprintf("%.1f", maxtemperature), float64(maxtemppointx)-12, float64(maxtemppointy)-6)
-	irImage.Stroke()
-	irImage.SetRGBA255(200, 200, 255, 230)
-	face = truetype.NewFace(font, &truetype.Options{Size: 12})
-	irImage.SetFontFace(face)
-	irImage.SetLineWidth(1)
-	irImage.DrawLine(float64(mintemppointx)-3, float64(mintemppointy), float64(mintemppointx)+3, float64(mintemppointy))
-	irImage.DrawLine(float64(mintemppointx), float64(mintemppointy)-3, float64(mintemppointx), float64(mintemppointy)+3)
-	irImage.DrawString(fmt.Sprintf("%.1f", mintemperature), float64(mintemppointx)-12, float64(mintemppointy)-6)
-	irImage.Stroke()
-	irImage.SetRGBA255(255, 200, 200, 230)
-	irImage.DrawLine(float64(maxtemppointx)-2, float64(maxtemppointy), float64(maxtemppointx)+2, float64(maxtemppointy))
-	irImage.DrawLine(float64(maxtemppointx), float64(maxtemppointy)-2, float64(maxtemppointx), float64(maxtemppointy)+2)
-	irImage.DrawString(fmt.Sprintf("%.1f", maxtemperature), float64(maxtemppointx)-12, float64(maxtemppointy)-6)
-	irImage.Stroke()
-	outFile, _ := os.Create(filename)
-	defer outFile.Close()
-	jpegerr := jpeg.Encode(outFile, irImage.Image(), &jpeg.Options{Quality: 100})
-	if jpegerr != nil {
-		log.Fatalln("Can't encode jpeg data.", jpegerr, filename)
+	convert := func(w uint16, p Params) float64 {
+		return raypower2degrees(uint16(float64(w)*gain+bias), p.Background, p.Emission)
 	}
-	return nil
+	return newThermogram(format, 320, 240, raw, p, convert), nil
 }
 
-// Decode old fileformat
-func decodeOldIS2(filename string, irfilepath string, visfilepath string, bgtemp float64, emission float64, mintemp float64, maxtemp float64) error {
-	file, err := os.Open(filename)
+// writeIRImage renders the frame and writes it to filename. vis is the
+// visual picture for the edge enhancement and may be nil.
+func writeIRImage(frame *Thermogram, vis image.Image, filename string, opts Options, meta *Metadata) error {
+	irImage, err := renderIR(frame, vis, opts)
 	if err != nil {
-		log.Println("Error while opening file.", err)
 		return err
 	}
-	defer file.Close()
-	var bval uint8
-	c := 0
-	i := 0
-	for {
-		i = i + 1
-		err = binary.Read(file, binary.LittleEndian, &bval)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		if bval == 0xFF {
-			c = c + 1
-		} else {
-			c = 0
-		}
-		if c >= 20 {
-			break
-		}
-		if i == 1000 {
-			return fmt.Errorf("%s Offset not found. Unknown file structure!", filename)
-		}
+	return writeImage(filename, irImage, opts, meta)
+}
+
+// oldIS2Decoder decodes the old is2 format (raw,uncompressed,binary)
+type oldIS2Decoder struct{}
+
+// Name returns the name of the format
+func (oldIS2Decoder) Name() string {
+	return FormatOldIS2
+}
+
+// Decode decodes the old fileformat
+func (oldIS2Decoder) Decode(filename string, p Params, logger *log.Logger) (*Thermogram, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
 	}
-	offset := int64(i)
-	if irfilepath != "" {
-		fi, err := os.Stat(irfilepath)
-		if err != nil {
-			log.Println("Create:", irfilepath)
-		} else {
-			switch mode := fi.Mode(); {
-			case mode.IsDir():
-				log.Println(irfilepath, "is a directory.")
-				friendlyname := strings.Replace(filepath.Base(filename), ".IS2", ".jpg", -1)
-				friendlyname = strings.Replace(friendlyname, ".is2", ".jpg", -1)
-				irfilepath = irfilepath + "/" + friendlyname
-				log.Println(irfilepath)
-			case mode.IsRegular():
-				log.Println("Overwrite:", irfilepath)
-			}
-		}
-		errdecir := decodeIS2IRBinaryData2JPG(offset+15828, file, irfilepath, bgtemp, emission, mintemp, maxtemp)
-		if errdecir != nil {
-			log.Fatalln("Can't encode infrared data.", errdecir, irfilepath)
-		}
+	offset, err := oldIS2Offset(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
 	}
-	if visfilepath != "" {
-		var w uint16
-		var r, g, b uint8
-		fi, err := os.Stat(visfilepath)
-		if err != nil {
-			log.Println("Create:", visfilepath)
-		} else {
-			switch mode := fi.Mode(); {
-			case mode.IsDir():
-				log.Println(visfilepath, "is a directory.")
-				visfilepath = visfilepath + "/" + strings.Replace(filepath.Base(filename), ".IS2", ".jpg", -1)
-			case mode.IsRegular():
-				log.Println("Overwrite:", visfilepath)
-			}
-		}
-		_, seekerr := file.Seek(offset+169484, 0)
-		if seekerr != nil {
-			log.Fatalln("File corrupt. Position [offset+169484 vissual picture data] not found.", seekerr, filepath.Base(filename))
-		}
-		visImage := gg.NewContext(640, 480)
-		for y := 0; y < 480; y++ {
-			for x := 0; x < 640; x++ {
-				readerr := binary.Read(file, binary.LittleEndian, &w)
-				if readerr != nil {
-					log.Fatalln("Error while reading file.", readerr, filepath.Base(filename))
-				}
-				r = uint8(((w >> 11) & 0x1F) * 8)
-				g = uint8(((w >> 5) & 0x3F) * 4)
-				b = uint8((w & 0x1F) * 8)
-				visImage.SetRGB255(int(r), int(g), int(b))
-				visImage.SetPixel(x, y)
-			}
-		}
-		outFile2, _ := os.Create(visfilepath)
-		defer outFile2.Close()
-		jpegerr := jpeg.Encode(outFile2, visImage.Image(), &jpeg.Options{Quality: 100})
-		if jpegerr != nil {
-			log.Fatalln("Can't encode jpeg.", jpegerr, visfilepath)
-		}
+	file := bytes.NewReader(data)
+	frame, err := readIRFrame(file, offset+15828, FormatOldIS2, oldIS2Gain, oldIS2Bias, p.resolve(nil))
+	if err != nil {
+		return nil, fmt.Errorf("Can't decode infrared data. %w", err)
 	}
-	fi, err := file.Stat()
+	frame.Visual, err = readVisual565(file, offset+169484, 640, 480)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("File corrupt. Position [offset+169484 vissual picture data] not found. %w", err)
 	}
-	if fi.Size() > 784080 {
-		var w uint16
-		_, seekerr := file.Seek(784080, 0)
-		if seekerr != nil {
-			log.Fatalln("File corrupt. Position [offset+784080 audiodata] not found.", seekerr, filepath.Base(filename))
-		}
-		wavOut, _ := os.Create(filename + ".wav")
-		defer wavOut.Close()
-		meta := wav.File{
-			Channels:        1,
-			SampleRate:      8000,
-			SignificantBits: 16,
-		}
-		writer, _ := meta.NewWriter(wavOut)
-		defer writer.Close()
-		for {
-			err = binary.Read(file, binary.LittleEndian, &w)
-			if err != nil {
-				if err != io.EOF {
-					fmt.Println("read error:", err)
-				}
-				break
-			}
-			b := make([]byte, 2)
-			binary.LittleEndian.PutUint16(b, uint16(w))
-			_, writeerr := writer.Write(b)
-			if writeerr != nil {
-				log.Fatalln("Error while writing.", writeerr, filename+".wav")
-			}
-		}
+	// The old format stores no capture time. The time of the file is not
+	// taken, it changes with every copy.
+	frame.Metadata = &Metadata{}
+	if len(data) > oldIS2AudioOffset {
+		frame.Audio = data[oldIS2AudioOffset:]
+		frame.AudioRate = 8000
 	}
-	return nil
+	return frame, nil
 }
 
-// Decode new fileformat
-func decodeNewIS2(filename string, irfilepath string, visfilepath string, bgtemp float64, emission float64, mintemp float64, maxtemp float64) error {
-	tempdir := strings.Replace(filepath.Base(filename), ".IS2", "", -1)
-	tempdir = strings.Replace(tempdir, ".is2", "", -1)
-	tempdir = "./temp_" + tempdir
-	_, err := Unzip(filename, tempdir)
+// newIS2Decoder decodes the new is2 format (zip based format)
+type newIS2Decoder struct{}
+
+// Name returns the name of the format
+func (newIS2Decoder) Name() string {
+	return FormatNewIS2
+}
+
+// Decode decodes the new fileformat. The entries are read from the zip
+// without unpacking it.
+func (newIS2Decoder) Decode(filename string, p Params, logger *log.Logger) (*Thermogram, error) {
+	zr, err := zip.OpenReader(filename)
+	if errors.Is(err, zip.ErrFormat) {
+		return nil, ErrFormat
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer zr.Close()
 	// 028001E0.jpg
 	// 028001E1.jpg
 	// IR.data
-	file, err := os.Open(tempdir + "/Images/Main/" + "IR.data")
+	irdata, err := readZipEntry(&zr.Reader, "Images/Main/IR.data")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrFormat
+	}
 	if err != nil {
-		log.Println("Error while opening IR.data", err)
-		return err
+		return nil, err
+	}
+	frame, err := readIRFrame(bytes.NewReader(irdata), 640, FormatNewIS2, newIS2Gain, newIS2Bias, p.resolve(nil))
+	if err != nil {
+		return nil, fmt.Errorf("Error while decoding ir data. %w", err)
 	}
-	defer file.Close()
-	fi, err := os.Stat(irfilepath)
+	// The visual jpeg of the camera carries the EXIF data of the capture.
+	frame.Metadata = &Metadata{}
+	visdata, err := readZipEntry(&zr.Reader, "Images/Main/028001E0.jpg")
 	if err != nil {
-		log.Println("Erstelle:", irfilepath)
+		return frame, nil
+	}
+	frame.VisualJPEG = visdata
+	frame.Visual, err = jpeg.Decode(bytes.NewReader(visdata))
+	if err != nil {
+		return nil, fmt.Errorf("Can't decode visual picture. %w", err)
+	}
+	meta, err := readEXIF(visdata)
+	if err != nil {
+		logger.Println("Can't read EXIF data of the visual picture.", err)
 	} else {
-		switch mode := fi.Mode(); {
-		case mode.IsDir():
-			log.Println(irfilepath, "ist ein Verzeichnis.")
-			friendlyname := strings.Replace(filepath.Base(filename), ".IS2", ".jpg", -1)
-			friendlyname = strings.Replace(friendlyname, ".is2", ".jpg", -1)
-			irfilepath = irfilepath + "/" + friendlyname
-			log.Println(irfilepath)
-		case mode.IsRegular():
-			log.Println("Overwrite:", irfilepath)
-		}
+		frame.Metadata = meta
 	}
-	decbinerr := decodeNEWIS2IRBinaryData2JPG(640, file, irfilepath, bgtemp, emission, mintemp, maxtemp)
-	if decbinerr != nil {
-		file.Close()
-		err = os.RemoveAll(tempdir)
-		if err != nil {
-			log.Println("Error while deleting the temporary directory.", err)
-		}
-		log.Fatalln("Error while decoding ir data.", decbinerr, irfilepath)
+	return frame, nil
+}
+
+// readZipEntry reads the entry name of the zip. A missing entry is
+// fs.ErrNotExist.
+func readZipEntry(zr *zip.Reader, name string) ([]byte, error) {
+	rc, err := zr.Open(name)
+	if err != nil {
+		return nil, err
 	}
-	file.Close()
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
 
-	if visfilepath != "" {
-		fi, err := os.Stat(visfilepath)
-		if err != nil {
-			log.Println("Create:", visfilepath)
-		} else {
-			switch mode := fi.Mode(); {
-			case mode.IsDir():
-				log.Println(visfilepath, "is a directory.")
-				visfilepath = visfilepath + "/" + strings.Replace(filepath.Base(filename), ".IS2", ".jpg", -1)
-			case mode.IsRegular():
-				log.Println("Overwrite:", visfilepath)
-			}
-		}
-		_, err = Copyfile(tempdir+"/Images/Main/"+"028001E0.jpg", visfilepath)
-		if err != nil {
-			log.Println("File:", tempdir+"/Images/Main/"+"028001E0.jpg", ".Can't copy file.")
-		}
+// readVisual565 reads a visual picture of 16 bit RGB565 pixels at offset
+func readVisual565(file io.ReadSeeker, offset int64, width int, height int) (image.Image, error) {
+	_, err := file.Seek(offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	pixels, err := readUint16s(file, width*height)
+	if err != nil {
+		return nil, err
+	}
+	visImage := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, w := range pixels {
+		visImage.Pix[4*i] = uint8(((w >> 11) & 0x1F) * 8)
+		visImage.Pix[4*i+1] = uint8(((w >> 5) & 0x3F) * 4)
+		visImage.Pix[4*i+2] = uint8((w & 0x1F) * 8)
+		visImage.Pix[4*i+3] = 255
 	}
+	return visImage, nil
+}
 
-	err = os.RemoveAll(tempdir)
+// readUint16s reads n 16 bit little endian values at once
+func readUint16s(r io.Reader, n int) ([]uint16, error) {
+	buf := make([]byte, 2*n)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		log.Println("Error while deleting the temporary directory.", err)
+		return nil, err
 	}
-	return nil
+	values := make([]uint16, n)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint16(buf[2*i:])
+	}
+	return values, nil
+}
+
+// writeFusedImage renders the fused picture and writes it to filename
+func writeFusedImage(frame *Thermogram, vis image.Image, filename string, opts Options, meta *Metadata) error {
+	return writeImage(filename, renderFusion(frame, vis, opts), opts, meta)
 }
 
 // Abs returns the absolute value of x.
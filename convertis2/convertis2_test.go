@@ -0,0 +1,301 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// discard is the logger of the tests
+var discard = log.New(io.Discard, "", 0)
+
+// testRaw returns the raw values of a 320x240 picture between lo and hi
+// with a gradient, a hot spot at 200,90 and a cold spot at 60,180
+func testRaw(lo uint16, hi uint16) []uint16 {
+	raw := make([]uint16, 320*240)
+	span := float64(hi - lo)
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			v := float64(lo) + span*0.3*float64(x)/320 + span*0.2*float64(y)/240
+			d := math.Hypot(float64(x-200), float64(y-90))
+			v += span * 0.5 * math.Exp(-d*d/300)
+			d = math.Hypot(float64(x-60), float64(y-180))
+			v -= span * 0.1 * math.Exp(-d*d/200)
+			raw[y*320+x] = uint16(v)
+		}
+	}
+	return raw
+}
+
+// rawBytes returns the raw values as 16 bit little endian values
+func rawBytes(raw []uint16) []byte {
+	data := make([]byte, 0, 2*len(raw))
+	for _, v := range raw {
+		data = binary.LittleEndian.AppendUint16(data, v)
+	}
+	return data
+}
+
+// testOldIS2 returns a file of the old format with the raw values and 0.5 s
+// of audio
+func testOldIS2(raw []uint16) []byte {
+	data := bytes.Repeat([]byte{0x11}, 100)
+	data = append(data, bytes.Repeat([]byte{0xFF}, 20)...)
+	offset := len(data)
+	data = append(data, make([]byte, offset+15828-len(data))...)
+	data = append(data, rawBytes(raw)...)
+	data = append(data, make([]byte, offset+169484-len(data))...)
+	data = append(data, make([]byte, 640*480*2)...)
+	data = append(data, make([]byte, oldIS2AudioOffset-len(data))...)
+	for i := 0; i < 4000; i++ {
+		data = binary.LittleEndian.AppendUint16(data, uint16(int16(8000*math.Sin(float64(i)/5))))
+	}
+	return data
+}
+
+// testNewIS2 returns a file of the new format with the raw values. vis is
+// the visual jpeg, nil leaves it out.
+func testNewIS2(tb testing.TB, raw []uint16, vis []byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("Images/Main/IR.data")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w.Write(append(make([]byte, 640), rawBytes(raw)...))
+	if vis != nil {
+		w, err = zw.Create("Images/Main/028001E0.jpg")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		w.Write(vis)
+	}
+	w, err = zw.Create("CameraInfo.gpbenc")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w.Write([]byte{1, 2, 3})
+	err = zw.Close()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestFile writes data to name in a temporary directory of the test
+func writeTestFile(tb testing.TB, name string, data []byte) string {
+	filename := filepath.Join(tb.TempDir(), name)
+	err := os.WriteFile(filename, data, 0666)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return filename
+}
+
+// readIRFramePerPixel is the former decoding of the infrared data: a
+// binary.Read and a conversion per pixel
+func readIRFramePerPixel(r io.ReadSeeker, offset int64, gain float64, bias float64, p Params) ([]float64, error) {
+	_, err := r.Seek(offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	temperatures := make([]float64, 320*240)
+	var w uint16
+	for i := range temperatures {
+		err := binary.Read(r, binary.LittleEndian, &w)
+		if err != nil {
+			return nil, err
+		}
+		temperatures[i] = raypower2degrees(uint16(float64(w)*gain+bias), p.Background, p.Emission)
+	}
+	return temperatures, nil
+}
+
+// irFrameTests are the formats of readIRFrame with their raw data
+var irFrameTests = []struct {
+	name   string
+	data   []byte
+	offset int64
+	gain   float64
+	bias   float64
+}{
+	{FormatOldIS2, testOldIS2(testRaw(1320, 2093)), 120 + 15828, oldIS2Gain, oldIS2Bias},
+	{FormatNewIS2, append(make([]byte, 640), rawBytes(testRaw(4716, 7263))...), 640, newIS2Gain, newIS2Bias},
+}
+
+func TestReadIRFrame(t *testing.T) {
+	for _, tt := range irFrameTests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Params{Background: 18, Emission: 0.9}
+			frame, err := readIRFrame(bytes.NewReader(tt.data), tt.offset, tt.name, tt.gain, tt.bias, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := readIRFramePerPixel(bytes.NewReader(tt.data), tt.offset, tt.gain, tt.bias, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range want {
+				if frame.Temperatures[i] != want[i] {
+					t.Fatalf("pixel %d: got %v, want %v", i, frame.Temperatures[i], want[i])
+				}
+			}
+			if frame.MaxX != 200 || frame.MaxY != 90 {
+				t.Errorf("hottest pixel at %d,%d, want 200,90", frame.MaxX, frame.MaxY)
+			}
+		})
+	}
+}
+
+func TestReadIRFrameShort(t *testing.T) {
+	_, err := readIRFrame(bytes.NewReader(make([]byte, 1000)), 640, FormatNewIS2, newIS2Gain, newIS2Bias, DefaultParams)
+	if err == nil {
+		t.Error("short infrared data decoded")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		audio  bool
+	}{
+		{"old.IS2", testOldIS2(testRaw(1320, 2093)), FormatOldIS2, true},
+		{"new.IS2", testNewIS2(t, testRaw(4716, 7263), nil), FormatNewIS2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := Decode(writeTestFile(t, tt.name, tt.data), Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame.Format != tt.format {
+				t.Errorf("format %s, want %s", frame.Format, tt.format)
+			}
+			if frame.Width != 320 || frame.Height != 240 {
+				t.Errorf("size %dx%d, want 320x240", frame.Width, frame.Height)
+			}
+			if frame.Params != DefaultParams {
+				t.Errorf("params %+v, want the default params", frame.Params)
+			}
+			if frame.Max() <= frame.Min() {
+				t.Errorf("max %.2f not above min %.2f", frame.Max(), frame.Min())
+			}
+			if (len(frame.Audio) > 0) != tt.audio {
+				t.Errorf("audio %d bytes", len(frame.Audio))
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownFormat(t *testing.T) {
+	_, err := Decode(writeTestFile(t, "text.IS2", []byte("no picture")), Params{})
+	if err == nil {
+		t.Error("a text file decoded")
+	}
+}
+
+// badEXIFJPEG returns a jpeg with EXIF data of an unknown byte order
+func badEXIFJPEG(tb testing.TB) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 48)), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	data := buf.Bytes()
+	app1 := []byte{0xFF, 0xE1, 0, 16}
+	app1 = append(app1, "Exif\x00\x00XX\x00\x2A\x00\x00\x00\x08"...)
+	return append(append(data[:2:2], app1...), data[2:]...)
+}
+
+func TestDecodeLog(t *testing.T) {
+	filename := writeTestFile(t, "new.IS2", testNewIS2(t, testRaw(4716, 7263), badEXIFJPEG(t)))
+	var std, file bytes.Buffer
+	log.SetOutput(&std)
+	defer log.SetOutput(os.Stderr)
+	frame, err := DecodeLog(filename, Params{}, log.New(&file, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Visual == nil {
+		t.Error("no visual picture")
+	}
+	if !strings.Contains(file.String(), "Can't read EXIF data") {
+		t.Errorf("file log %q, want the EXIF message", file.String())
+	}
+	if std.Len() > 0 {
+		t.Errorf("standard log %q, want nothing", std.String())
+	}
+}
+
+// BenchmarkReadIRFrame compares the bulk read with the lookup table to a
+// binary.Read and a conversion per pixel
+func BenchmarkReadIRFrame(b *testing.B) {
+	for _, tt := range irFrameTests {
+		b.Run(tt.name+"/bulk", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := readIRFrame(bytes.NewReader(tt.data), tt.offset, tt.name, tt.gain, tt.bias, DefaultParams)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(tt.name+"/per-pixel", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := readIRFramePerPixel(bytes.NewReader(tt.data), tt.offset, tt.gain, tt.bias, DefaultParams)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDecode decodes whole files of both formats
+func BenchmarkDecode(b *testing.B) {
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"old.IS2", testOldIS2(testRaw(1320, 2093))},
+		{"new.IS2", testNewIS2(b, testRaw(4716, 7263), nil)},
+	}
+	for _, f := range files {
+		filename := writeTestFile(b, f.name, f.data)
+		b.Run(f.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := Decode(filename, Params{})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// testTemperatures returns a thermogram without raw values with the
+// temperatures of f
+func testTemperatures(width int, height int, f func(x, y int) float64) *Thermogram {
+	t := &Thermogram{Format: FormatOldIS2, Width: width, Height: height, Params: DefaultParams, Temperatures: make([]float64, width*height)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			t.Temperatures[y*width+x] = f(x, y)
+		}
+	}
+	t.findExtremes()
+	return t
+}
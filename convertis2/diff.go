@@ -0,0 +1,160 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// FormatDiff is the format of the difference of two thermograms. Its
+// temperatures are deltas in K.
+const FormatDiff = "diff"
+
+// DiffOptions are the parameters of a comparison
+type DiffOptions struct {
+	// OffsetX and OffsetY is the shift of the scene in b against a. The
+	// pixel x,y of a is compared with the pixel x+OffsetX,y+OffsetY of b.
+	OffsetX int
+	OffsetY int
+	// Threshold of a changed pixel in K. 0 selects 1 K.
+	Threshold float64
+	// MinArea of a changed region in pixels. 0 selects 4.
+	MinArea int
+}
+
+// threshold returns the threshold of a changed pixel
+func (o DiffOptions) threshold() float64 {
+	if o.Threshold <= 0 {
+		return 1
+	}
+	return o.Threshold
+}
+
+// Diff is the difference b minus a of two thermograms
+type Diff struct {
+	// Frame holds the deltas in K of the overlap of a and b in the pixels
+	// of a starting at X, Y
+	Frame   *Thermogram `json:"-"`
+	X       int         `json:"x"`
+	Y       int         `json:"y"`
+	Width   int         `json:"width"`
+	Height  int         `json:"height"`
+	OffsetX int         `json:"offset_x"`
+	OffsetY int         `json:"offset_y"`
+	// Min, Max and Mean delta in K, the positions are in the pixels of a
+	Min  Spot    `json:"min"`
+	Max  Spot    `json:"max"`
+	Mean float64 `json:"mean"`
+	// Threshold of a changed pixel in K. Warmer and Cooler are the shares of
+	// the changed pixels of the overlap in percent.
+	Threshold float64 `json:"threshold"`
+	Warmer    float64 `json:"warmer_percent"`
+	Cooler    float64 `json:"cooler_percent"`
+	// Regions are the connected regions of the changed pixels, the warmer
+	// regions first. Their positions are in the pixels of a.
+	Regions []Cluster `json:"regions,omitempty"`
+}
+
+// Compare computes the per-pixel difference b minus a in the overlap of
+// both thermograms
+func Compare(a *Thermogram, b *Thermogram, o DiffOptions) (*Diff, error) {
+	x0, y0 := max(0, -o.OffsetX), max(0, -o.OffsetY)
+	x1, y1 := min(a.Width, b.Width-o.OffsetX), min(a.Height, b.Height-o.OffsetY)
+	if x1-x0 <= 0 || y1-y0 <= 0 {
+		return nil, fmt.Errorf("%d,%d: the offset leaves no overlap.", o.OffsetX, o.OffsetY)
+	}
+	d := &Diff{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0, OffsetX: o.OffsetX, OffsetY: o.OffsetY, Threshold: o.threshold()}
+	frame := &Thermogram{Format: FormatDiff, Width: d.Width, Height: d.Height, Params: b.Params, Temperatures: make([]float64, d.Width*d.Height)}
+	var sum float64
+	var warmer, cooler int
+	for y := 0; y < d.Height; y++ {
+		for x := 0; x < d.Width; x++ {
+			ax, ay := x+x0, y+y0
+			delta := b.At(ax+o.OffsetX, ay+o.OffsetY) - a.At(ax, ay)
+			frame.Temperatures[y*d.Width+x] = delta
+			sum += delta
+			if delta > d.Threshold {
+				warmer++
+			} else if delta < -d.Threshold {
+				cooler++
+			}
+		}
+	}
+	frame.findExtremes()
+	d.Frame = frame
+	n := float64(len(frame.Temperatures))
+	d.Min = Spot{Name: "min", X: frame.MinX + x0, Y: frame.MinY + y0, Temperature: round2(frame.Min())}
+	d.Max = Spot{Name: "max", X: frame.MaxX + x0, Y: frame.MaxY + y0, Temperature: round2(frame.Max())}
+	d.Mean = round2(sum / n)
+	d.Warmer = round2(float64(warmer) * 100 / n)
+	d.Cooler = round2(float64(cooler) * 100 / n)
+	for _, c := range []ClusterOptions{
+		{Kind: ClusterHot, Threshold: d.Threshold, MinArea: o.MinArea},
+		{Kind: ClusterCold, Threshold: -d.Threshold, MinArea: o.MinArea},
+	} {
+		for _, r := range frame.Clusters(c) {
+			r.Peak.X, r.Peak.Y = r.Peak.X+x0, r.Peak.Y+y0
+			r.CentroidX, r.CentroidY = r.CentroidX+float64(x0), r.CentroidY+float64(y0)
+			r.X, r.Y = r.X+x0, r.Y+y0
+			d.Regions = append(d.Regions, r)
+		}
+	}
+	return d, nil
+}
+
+// Render draws the deltas with a symmetric scale around 0 K. limit is the
+// end of the scale in K, 0 selects the largest delta. The palette of opts
+// defaults to the diverging palette.
+func (d *Diff) Render(opts Options, limit float64) (image.Image, error) {
+	if limit <= 0 {
+		limit = math.Max(math.Abs(d.Frame.Min()), math.Abs(d.Frame.Max()))
+	}
+	if limit == 0 {
+		limit = 1
+	}
+	opts.MinTemp, opts.MaxTemp = -limit, limit
+	if opts.Palette == "" {
+		opts.Palette = PaletteDiverging
+	}
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return renderIR(d.Frame, nil, opts)
+}
+
+// WriteImage renders the deltas like Render and writes them to filename
+func (d *Diff) WriteImage(filename string, opts Options, limit float64) error {
+	img, err := d.Render(opts, limit)
+	if err != nil {
+		return err
+	}
+	return writeImage(filename, img, opts, nil)
+}
+
+// String returns the statistics of the difference as text
+func (d *Diff) String() string {
+	var b strings.Builder
+	line := func(name string, format string, a ...any) {
+		fmt.Fprintf(&b, "%-13s "+format+"\n", append([]any{name + ":"}, a...)...)
+	}
+	line("Overlap", "%dx%d at %d,%d, offset %d,%d", d.Width, d.Height, d.X, d.Y, d.OffsetX, d.OffsetY)
+	line("Min", "%.2f K at %d,%d", d.Min.Temperature, d.Min.X, d.Min.Y)
+	line("Max", "%.2f K at %d,%d", d.Max.Temperature, d.Max.X, d.Max.Y)
+	line("Mean", "%.2f K", d.Mean)
+	line("Changed", "warmer %.1f %%, cooler %.1f %% (threshold %.1f K)", d.Warmer, d.Cooler, d.Threshold)
+	for _, r := range d.Regions {
+		kind := "warmer"
+		if r.Kind == ClusterCold {
+			kind = "cooler"
+		}
+		line("Region", "%s %d at %d,%d size %dx%d, %d px, peak %.2f K at %d,%d, mean %.2f K",
+			kind, r.Rank, r.X, r.Y, r.Width, r.Height, r.Area, r.Peak.Temperature, r.Peak.X, r.Peak.Y, r.Mean)
+	}
+	return b.String()
+}
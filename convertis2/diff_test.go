@@ -0,0 +1,92 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	// scene is a gradient with a warm block at 20,10 of 4x3 pixels
+	scene := func(x, y int) float64 {
+		v := 20 + float64(x)/10
+		if x >= 20 && x < 24 && y >= 10 && y < 13 {
+			v += 5
+		}
+		return v
+	}
+	a := testTemperatures(40, 30, scene)
+	tests := []struct {
+		name       string
+		b          *Thermogram
+		o          DiffOptions
+		width      int
+		max        float64
+		mean       float64
+		regions    int
+		regionX    int
+		regionY    int
+		regionArea int
+	}{
+		{"identical", a, DiffOptions{}, 40, 0, 0, 0, 0, 0, 0},
+		{"warmer block", testTemperatures(40, 30, func(x, y int) float64 {
+			if x >= 5 && x < 8 && y >= 5 && y < 8 {
+				return scene(x, y) + 3
+			}
+			return scene(x, y)
+		}), DiffOptions{}, 40, 3, 0.02, 1, 5, 5, 9},
+		{"small block below the min. area", testTemperatures(40, 30, func(x, y int) float64 {
+			if x == 5 && y == 5 {
+				return scene(x, y) + 3
+			}
+			return scene(x, y)
+		}), DiffOptions{}, 40, 3, 0, 0, 0, 0, 0},
+		{"shifted scene", testTemperatures(40, 30, func(x, y int) float64 {
+			return scene(x-2, y-1)
+		}), DiffOptions{OffsetX: 2, OffsetY: 1}, 38, 0, 0, 0, 0, 0, 0},
+		{"threshold above the change", testTemperatures(40, 30, func(x, y int) float64 {
+			return scene(x, y) + 2
+		}), DiffOptions{Threshold: 2.5}, 40, 2, 2, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Compare(a, tt.b, tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Width != tt.width {
+				t.Errorf("overlap width %d, want %d", d.Width, tt.width)
+			}
+			if d.Max.Temperature != tt.max {
+				t.Errorf("max %.2f K, want %.2f K", d.Max.Temperature, tt.max)
+			}
+			if d.Mean != tt.mean {
+				t.Errorf("mean %.2f K, want %.2f K", d.Mean, tt.mean)
+			}
+			if len(d.Regions) != tt.regions {
+				t.Fatalf("%d regions, want %d", len(d.Regions), tt.regions)
+			}
+			if tt.regions > 0 {
+				r := d.Regions[0]
+				if r.Kind != ClusterHot || r.X != tt.regionX || r.Y != tt.regionY || r.Area != tt.regionArea {
+					t.Errorf("region %s at %d,%d with %d px, want hot at %d,%d with %d px", r.Kind, r.X, r.Y, r.Area, tt.regionX, tt.regionY, tt.regionArea)
+				}
+			}
+			// A difference without change is a uniform picture.
+			_, err = d.Render(Options{Logger: discard}, 0)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCompareNoOverlap(t *testing.T) {
+	a := testTemperatures(40, 30, func(x, y int) float64 { return 20 })
+	_, err := Compare(a, a, DiffOptions{OffsetX: 40})
+	if err == nil {
+		t.Error("an offset without overlap compared")
+	}
+}
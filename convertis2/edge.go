@@ -0,0 +1,71 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"image"
+	"math"
+)
+
+// detailmap holds the high frequency detail of the visual picture. A value
+// is the luminance of a pixel minus the mean luminance of its neighbourhood.
+type detailmap struct {
+	width  int
+	height int
+	values []float64
+	// alignment of the infrared picture in the visual picture
+	align Alignment
+}
+
+// newDetailmap extracts the detail of the visual picture with a high pass
+// of the given radius
+func newDetailmap(vis image.Image, align Alignment, radius int) *detailmap {
+	bounds := vis.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	luma := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := vis.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			luma[y*w+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+	// box blur with a summed area table
+	sums := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sums[(y+1)*(w+1)+x+1] = luma[y*w+x] + sums[y*(w+1)+x+1] + sums[(y+1)*(w+1)+x] - sums[y*(w+1)+x]
+		}
+	}
+	d := &detailmap{width: w, height: h, values: make([]float64, w*h), align: align}
+	for y := 0; y < h; y++ {
+		y0, y1 := max(y-radius, 0), min(y+radius+1, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(x-radius, 0), min(x+radius+1, w)
+			sum := sums[y1*(w+1)+x1] - sums[y0*(w+1)+x1] - sums[y1*(w+1)+x0] + sums[y0*(w+1)+x0]
+			mean := sum / float64((x1-x0)*(y1-y0))
+			d.values[y*w+x] = luma[y*w+x] - mean
+		}
+	}
+	return d
+}
+
+// at returns the detail at the infrared position x, y
+func (d *detailmap) at(x float64, y float64) float64 {
+	vx := (x+0.5)*d.align.Scale + d.align.OffsetX - 0.5
+	vy := (y+0.5)*d.align.Scale + d.align.OffsetY + d.align.Parallax - 0.5
+	ix, iy := int(math.Round(vx)), int(math.Round(vy))
+	if ix < 0 || iy < 0 || ix >= d.width || iy >= d.height {
+		return 0
+	}
+	return d.values[iy*d.width+ix]
+}
+
+// emboss adds the detail with the given strength to the color r, g, b
+func emboss(r uint8, g uint8, b uint8, detail float64, strength float64) (uint8, uint8, uint8) {
+	add := func(v uint8) uint8 {
+		return uint8(math.Min(math.Max(float64(v)+detail*strength, 0), 255))
+	}
+	return add(r), add(g), add(b)
+}
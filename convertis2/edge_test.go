@@ -0,0 +1,66 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestDetailmap(t *testing.T) {
+	// A visual picture of 40x20 pixels, dark left of x 20 and bright right
+	vis := image.NewGray(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 20; x < 40; x++ {
+			vis.SetGray(x, y, color.Gray{Y: 200})
+		}
+	}
+	d := newDetailmap(vis, Alignment{Scale: 2}, 2)
+	tests := []struct {
+		name string
+		x, y float64
+		sign int
+	}{
+		{"dark area", 2, 5, 0},
+		{"bright area", 17, 5, 0},
+		{"dark side of the edge", 9.25, 5, -1},
+		{"bright side of the edge", 9.75, 5, 1},
+		{"left of the picture", -3, 5, 0},
+		{"below the picture", 12, 11, 0},
+	}
+	for _, tt := range tests {
+		v := d.at(tt.x, tt.y)
+		if (tt.sign == 0 && math.Abs(v) > 1e-9) || (tt.sign < 0 && v >= 0) || (tt.sign > 0 && v <= 0) {
+			t.Errorf("%s at %v,%v: detail %.2f, want the sign %d", tt.name, tt.x, tt.y, v, tt.sign)
+		}
+	}
+	if v := d.at(9.25, 5); math.Abs(v+d.at(9.75, 5)) > 1e-9 {
+		t.Errorf("detail %.2f on the dark side, %.2f on the bright side, want the same amount", v, d.at(9.75, 5))
+	}
+}
+
+func TestEmboss(t *testing.T) {
+	tests := []struct {
+		r, g, b  uint8
+		detail   float64
+		strength float64
+		want     [3]uint8
+	}{
+		{100, 150, 200, 0, 1, [3]uint8{100, 150, 200}},
+		{100, 150, 200, 10, 1, [3]uint8{110, 160, 210}},
+		{100, 150, 200, 10, 2, [3]uint8{120, 170, 220}},
+		{100, 150, 200, -30, 0.5, [3]uint8{85, 135, 185}},
+		{100, 150, 200, 100, 1, [3]uint8{200, 250, 255}},
+		{10, 150, 200, -50, 1, [3]uint8{0, 100, 150}},
+	}
+	for _, tt := range tests {
+		r, g, b := emboss(tt.r, tt.g, tt.b, tt.detail, tt.strength)
+		if got := [3]uint8{r, g, b}; got != tt.want {
+			t.Errorf("%d,%d,%d with %v*%v: %v, want %v", tt.r, tt.g, tt.b, tt.detail, tt.strength, got, tt.want)
+		}
+	}
+}
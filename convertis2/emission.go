@@ -0,0 +1,118 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+)
+
+// minMaskGray is the lowest gray value of a mask with an emission factor.
+// It is an emission factor of about 0.1, darker pixels keep the emission
+// factor of the picture. The near-black values would give emission factors
+// below 0.05 and temperatures far off.
+const minMaskGray = 26
+
+// ReadEmissionMask reads a grayscale mask of the emission factors (.png,
+// .tif, .bmp). The gray value divided by 255 is the emission factor of a
+// pixel, pixels below the gray value 26 keep the emission factor of the
+// picture. JPEG masks are rejected, their compression changes the gray
+// values at the edges of the surfaces.
+func ReadEmissionMask(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mask, format, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad emission mask. %w", filename, err)
+	}
+	if format == "jpeg" {
+		return nil, fmt.Errorf("%s: JPEG masks are lossy, use a png, tif or bmp mask.", filename)
+	}
+	return mask, nil
+}
+
+// SetEmissionMask builds the emission map of the picture from the mask and
+// the ROIs with an emission factor and converts the raw values again. The
+// mask is scaled to the picture, nil selects no mask. The ROIs are painted
+// over the mask in their order.
+func (t *Thermogram) SetEmissionMask(mask image.Image) {
+	var m []float64
+	set := func(i int, e float64) {
+		if m == nil {
+			m = make([]float64, t.Width*t.Height)
+		}
+		m[i] = e
+	}
+	if mask != nil {
+		b := mask.Bounds()
+		for y := 0; y < t.Height; y++ {
+			for x := 0; x < t.Width; x++ {
+				mx := b.Min.X + x*b.Dx()/t.Width
+				my := b.Min.Y + y*b.Dy()/t.Height
+				if gray := color.GrayModel.Convert(mask.At(mx, my)).(color.Gray).Y; gray >= minMaskGray {
+					set(y*t.Width+x, float64(gray)/255)
+				}
+			}
+		}
+	}
+	for _, roi := range t.ROIs {
+		if roi.Emission == 0 {
+			continue
+		}
+		x0, y0 := max(roi.X, 0), max(roi.Y, 0)
+		x1 := min(roi.X+max(roi.Width, 1), t.Width)
+		y1 := min(roi.Y+max(roi.Height, 1), t.Height)
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				set(y*t.Width+x, roi.Emission)
+			}
+		}
+	}
+	if m == nil && t.EmissionMap == nil {
+		return
+	}
+	t.EmissionMap = m
+	t.SetParams(t.Params)
+}
+
+// EmissionMapShare returns the share of the pixels with an emission factor
+// of the emission map in percent
+func (t *Thermogram) EmissionMapShare() float64 {
+	n := 0
+	for _, e := range t.EmissionMap {
+		if e != 0 {
+			n++
+		}
+	}
+	return float64(n) * 100 / float64(t.Width*t.Height)
+}
+
+// emission returns the emission factor of the pixel at index i
+func (t *Thermogram) emission(i int) float64 {
+	if t.EmissionMap != nil && t.EmissionMap[i] != 0 {
+		return t.EmissionMap[i]
+	}
+	return t.Params.Emission
+}
+
+// decodeOptions decodes filename with the parameters and the logger of
+// opts and applies the emission mask of opts
+func decodeOptions(filename string, opts Options) (*Thermogram, error) {
+	frame, err := DecodeLog(filename, Params{Background: opts.Background, Emission: opts.Emission}, opts.logger())
+	if err != nil || opts.EmissionMask == "" {
+		return frame, err
+	}
+	mask, err := ReadEmissionMask(opts.EmissionMask)
+	if err != nil {
+		return nil, err
+	}
+	frame.SetEmissionMask(mask)
+	return frame, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// grayMask returns a mask of 32x24 pixels with the gray value g
+func grayMask(g uint8) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, 32, 24))
+	for i := range mask.Pix {
+		mask.Pix[i] = g
+	}
+	return mask
+}
+
+func TestSetEmissionMask(t *testing.T) {
+	tests := []struct {
+		name     string
+		gray     uint8
+		rois     []ROI
+		emission float64
+		pixel    float64
+	}{
+		{"black", 0, nil, 0.95, 0},
+		{"near black", 10, nil, 0.95, 0},
+		{"below the minimum", minMaskGray - 1, nil, 0.95, 0},
+		{"minimum", minMaskGray, nil, float64(minMaskGray) / 255, float64(minMaskGray) / 255},
+		{"gray", 153, nil, 0.6, 0.6},
+		{"roi over the mask", 153, []ROI{{Name: "copper", X: 0, Y: 0, Width: 10, Height: 10, Emission: 0.3}}, 0.3, 0.3},
+		{"roi without mask", 0, []ROI{{Name: "copper", X: 0, Y: 0, Width: 10, Height: 10, Emission: 0.3}}, 0.3, 0.3},
+	}
+	old := testOldIS2(testRaw(1320, 2093))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := Decode(writeTestFile(t, "old.IS2", old), Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := frame.Temperatures[0]
+			frame.ROIs = tt.rois
+			frame.SetEmissionMask(grayMask(tt.gray))
+			if e := frame.emission(0); e != tt.emission {
+				t.Errorf("emission %v, want %v", e, tt.emission)
+			}
+			var pixel float64
+			if frame.EmissionMap != nil {
+				pixel = frame.EmissionMap[0]
+			}
+			if pixel != tt.pixel {
+				t.Errorf("emission map %v, want %v", pixel, tt.pixel)
+			}
+			if tt.pixel == 0 && frame.Temperatures[0] != before {
+				t.Errorf("temperature %.2f changed from %.2f", frame.Temperatures[0], before)
+			}
+			if tt.pixel != 0 && frame.Temperatures[0] == before {
+				t.Errorf("temperature %.2f not converted again", before)
+			}
+		})
+	}
+}
+
+func TestReadEmissionMask(t *testing.T) {
+	mask := grayMask(153)
+	mask.Set(0, 0, color.Gray{Y: 0})
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, mask); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, mask, nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"mask.png", pngData.Bytes(), ""},
+		{"mask.jpg", jpegData.Bytes(), "JPEG masks are lossy"},
+		{"mask.txt", []byte("no mask"), "bad emission mask"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ReadEmissionMask(writeTestFile(t, tt.name, tt.data))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Bounds() != mask.Bounds() {
+				t.Errorf("bounds %v, want %v", m.Bounds(), mask.Bounds())
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// Output formats of the pictures
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatTIFF = "tiff"
+	FormatBMP  = "bmp"
+)
+
+// validFormat reports whether format is a known output format
+func validFormat(format string) bool {
+	switch format {
+	case "", FormatJPEG, FormatPNG, FormatTIFF, FormatBMP:
+		return true
+	}
+	return false
+}
+
+// FormatFromExtension returns the output format of the file extension of
+// filename. Unknown extensions are written as jpeg.
+func FormatFromExtension(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".png":
+		return FormatPNG
+	case ".tif", ".tiff":
+		return FormatTIFF
+	case ".bmp":
+		return FormatBMP
+	}
+	return FormatJPEG
+}
+
+// formatOf returns the output format of filename. The format of the options
+// takes precedence over the file extension.
+func (o Options) formatOf(filename string) string {
+	if o.Format != "" {
+		return o.Format
+	}
+	return FormatFromExtension(filename)
+}
+
+// extension returns the file extension for outputs into a directory
+func (o Options) extension() string {
+	switch o.Format {
+	case FormatPNG:
+		return ".png"
+	case FormatTIFF:
+		return ".tif"
+	case FormatBMP:
+		return ".bmp"
+	}
+	return ".jpg"
+}
+
+// quality returns the jpeg quality, 100 by default
+func (o Options) quality() int {
+	if o.Quality == 0 {
+		return 100
+	}
+	return o.Quality
+}
+
+// writeImage encodes img in the output format of filename. The metadata
+// is embedded into jpeg and png files, meta may be nil.
+func writeImage(filename string, img image.Image, opts Options, meta *Metadata) error {
+	data, err := encodeImage(img, opts.formatOf(filename), opts, meta)
+	if err != nil {
+		return fmt.Errorf("%w %s", err, filename)
+	}
+	return os.WriteFile(filename, data, 0666)
+}
+
+// encodeImage encodes img in format. The metadata is embedded into jpeg
+// and png data, meta may be nil.
+func encodeImage(img image.Image, format string, opts Options, meta *Metadata) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatPNG:
+		err = png.Encode(&buf, img)
+	case FormatTIFF:
+		err = tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+	case FormatBMP:
+		err = bmp.Encode(&buf, img)
+	default:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.quality()})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Can't encode %s format. %w", format, err)
+	}
+	data := buf.Bytes()
+	if meta != nil {
+		switch format {
+		case FormatJPEG:
+			data, err = embedJPEG(data, meta)
+		case FormatPNG:
+			data, err = embedPNG(data, meta)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// ContentType returns the MIME type of the output format
+func ContentType(format string) string {
+	switch format {
+	case FormatPNG:
+		return "image/png"
+	case FormatTIFF:
+		return "image/tiff"
+	case FormatBMP:
+		return "image/bmp"
+	}
+	return "image/jpeg"
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFormatFromExtension(t *testing.T) {
+	tests := []struct {
+		filename string
+		format   string
+		options  string
+	}{
+		{"ir.jpg", FormatJPEG, FormatPNG},
+		{"ir.JPEG", FormatJPEG, FormatPNG},
+		{"ir.png", FormatPNG, FormatPNG},
+		{"dir/ir.PNG", FormatPNG, FormatTIFF},
+		{"ir.tif", FormatTIFF, FormatBMP},
+		{"ir.tiff", FormatTIFF, FormatJPEG},
+		{"ir.bmp", FormatBMP, FormatPNG},
+		{"ir.webp", FormatJPEG, FormatPNG},
+		{"ir", FormatJPEG, FormatBMP},
+	}
+	for _, tt := range tests {
+		if got := FormatFromExtension(tt.filename); got != tt.format {
+			t.Errorf("%s: %s, want %s", tt.filename, got, tt.format)
+		}
+		if got := (Options{}).formatOf(tt.filename); got != tt.format {
+			t.Errorf("%s without format: %s, want %s", tt.filename, got, tt.format)
+		}
+		if got := (Options{Format: tt.options}).formatOf(tt.filename); got != tt.options {
+			t.Errorf("%s with format %s: %s", tt.filename, tt.options, got)
+		}
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 48, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 48; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(5 * x), uint8(7 * y), uint8(x ^ y), 255})
+		}
+	}
+	tests := []struct {
+		format   string
+		decoded  string
+		lossless bool
+	}{
+		{FormatJPEG, "jpeg", false},
+		{FormatPNG, "png", true},
+		{FormatTIFF, "tiff", true},
+		{FormatBMP, "bmp", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := encodeImage(img, tt.format, Options{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, format, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tt.decoded {
+				t.Errorf("format %s, want %s", format, tt.decoded)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Fatalf("bounds %v, want %v", decoded.Bounds(), img.Bounds())
+			}
+			if !tt.lossless {
+				return
+			}
+			for y := 0; y < 32; y++ {
+				for x := 0; x < 48; x++ {
+					if got := color.RGBAModel.Convert(decoded.At(x, y)); got != img.RGBAAt(x, y) {
+						t.Fatalf("pixel %d,%d: %v, want %v", x, y, got, img.RGBAAt(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeImageQuality(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 37)
+	}
+	low, err := encodeImage(img, FormatJPEG, Options{Quality: 20}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	best, err := encodeImage(img, FormatJPEG, Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(low) >= len(best) {
+		t.Errorf("quality 20 has %d bytes, the default quality %d bytes", len(low), len(best))
+	}
+}
+
+func TestValidateQuality(t *testing.T) {
+	for _, tt := range []struct {
+		quality int
+		ok      bool
+	}{{0, true}, {1, true}, {100, true}, {-1, false}, {101, false}} {
+		if err := (Options{Quality: tt.quality}).Validate(); (err == nil) != tt.ok {
+			t.Errorf("quality %d: %v", tt.quality, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes the temperatures in degree celsius as comma separated
+// values, one row of the picture per line
+func (t *Thermogram) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var line []byte
+	for y := 0; y < t.Height; y++ {
+		line = line[:0]
+		for x := 0; x < t.Width; x++ {
+			if x > 0 {
+				line = append(line, ',')
+			}
+			line = strconv.AppendFloat(line, t.At(x, y), 'f', 2, 64)
+		}
+		line = append(line, '\n')
+		_, err := bw.Write(line)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// temperatureData is the JSON document of WriteJSON
+type temperatureData struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Params Params `json:"params"`
+	Min    Spot   `json:"min"`
+	Max    Spot   `json:"max"`
+	Analysis
+	Temperatures [][]float64 `json:"temperatures"`
+}
+
+// WriteJSON writes the dimensions, the parameters, the min and max spots
+// and the temperatures in degree celsius row by row as JSON document. The
+// options add their Analysis.
+func (t *Thermogram) WriteJSON(w io.Writer, opts Options) error {
+	return json.NewEncoder(w).Encode(t.temperatureData(opts))
+}
+
+// temperatureData returns the JSON document of the temperatures rounded to
+// 0.01 degree
+func (t *Thermogram) temperatureData(opts Options) temperatureData {
+	data := temperatureData{
+		Format: t.Format,
+		Width:  t.Width,
+		Height: t.Height,
+		Params: t.Params,
+		Min:    Spot{Name: "min", X: t.MinX, Y: t.MinY, Temperature: round2(t.Min())},
+		Max:    Spot{Name: "max", X: t.MaxX, Y: t.MaxY, Temperature: round2(t.Max())},
+	}
+	data.Analysis = analyze(t, opts)
+	data.Temperatures = make([][]float64, t.Height)
+	for y := range data.Temperatures {
+		row := make([]float64, t.Width)
+		for x := range row {
+			row[x] = round2(t.At(x, y))
+		}
+		data.Temperatures[y] = row
+	}
+	return data
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Fusion modes of the visual and the infrared picture
+const (
+	// FusionBlend blends the infrared picture over the visual picture
+	FusionBlend = "blend"
+	// FusionPIP shows the center of the infrared picture inside of the
+	// visual picture
+	FusionPIP = "pip"
+	// FusionAbove shows the infrared colors above the threshold temperature
+	FusionAbove = "above"
+	// FusionBelow shows the infrared colors below the threshold temperature
+	FusionBelow = "below"
+)
+
+// Alignment describes where the infrared picture lies in the visual
+// picture. The visual pixel vx, vy shows the infrared pixel
+// (vx-OffsetX)/Scale, (vy-OffsetY-Parallax)/Scale.
+type Alignment struct {
+	OffsetX float64 `json:"offset_x" yaml:"offset_x"`
+	OffsetY float64 `json:"offset_y" yaml:"offset_y"`
+	// Visual pixels per infrared pixel
+	Scale float64 `json:"scale" yaml:"scale"`
+	// Vertical shift in visual pixels between the two lenses
+	Parallax float64 `json:"parallax" yaml:"parallax"`
+}
+
+// ParseAlignment parses an alignment of the form "x,y,scale[,parallax]"
+func ParseAlignment(s string) (*Alignment, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) < 3 || len(fields) > 4 {
+		return nil, fmt.Errorf("%s: alignment must be x,y,scale[,parallax].", s)
+	}
+	var values [4]float64
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad alignment. %w", s, err)
+		}
+		values[i] = v
+	}
+	if values[2] <= 0 {
+		return nil, fmt.Errorf("%s: alignment scale must be greater than 0.", s)
+	}
+	return &Alignment{OffsetX: values[0], OffsetY: values[1], Scale: values[2], Parallax: values[3]}, nil
+}
+
+// defaultAlignment stretches the infrared picture over the width of the
+// visual picture and centers it vertically. The alignment data of the
+// cameras is not known in the IS2 files, so it is not read.
+func defaultAlignment(frame *Thermogram, vis image.Image) Alignment {
+	bounds := vis.Bounds()
+	scale := float64(bounds.Dx()) / float64(frame.Width)
+	return Alignment{
+		OffsetX: 0,
+		OffsetY: (float64(bounds.Dy()) - float64(frame.Height)*scale) / 2,
+		Scale:   scale,
+	}
+}
+
+// alignment returns the manual alignment of the options, the alignment of
+// the sidecar or the default alignment
+func (o Options) alignment(frame *Thermogram, vis image.Image) Alignment {
+	if o.Alignment != nil {
+		return *o.Alignment
+	}
+	if frame.Alignment != nil {
+		return *frame.Alignment
+	}
+	return defaultAlignment(frame, vis)
+}
+
+// validFusion reports whether mode is a known fusion mode
+func validFusion(mode string) bool {
+	switch mode {
+	case "", FusionBlend, FusionPIP, FusionAbove, FusionBelow:
+		return true
+	}
+	return false
+}
+
+// irPosition returns the infrared position of the visual pixel vx, vy
+func (a Alignment) irPosition(vx int, vy int) (float64, float64) {
+	x := (float64(vx)+0.5-a.OffsetX)/a.Scale - 0.5
+	y := (float64(vy)+0.5-a.OffsetY-a.Parallax)/a.Scale - 0.5
+	return x, y
+}
+
+// renderFusion combines the visual picture with the colored temperature
+// field. The result has the size of the visual picture.
+func renderFusion(frame *Thermogram, vis image.Image, opts Options) image.Image {
+	cs := newColorscale(frame, opts)
+	align := opts.alignment(frame, vis)
+	alpha := opts.FusionAlpha
+	if alpha == 0 {
+		alpha = 0.5
+	}
+	mode := opts.FusionMode
+	if mode == "" {
+		mode = FusionBlend
+	}
+	bounds := vis.Bounds()
+	fused := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	w := float64(frame.Width)
+	h := float64(frame.Height)
+	for vy := 0; vy < bounds.Dy(); vy++ {
+		for vx := 0; vx < bounds.Dx(); vx++ {
+			vr, vg, vb, _ := vis.At(bounds.Min.X+vx, bounds.Min.Y+vy).RGBA()
+			c := color.RGBA{uint8(vr >> 8), uint8(vg >> 8), uint8(vb >> 8), 255}
+			x, y := align.irPosition(vx, vy)
+			inside := x >= -0.5 && y >= -0.5 && x < w-0.5 && y < h-0.5
+			if inside {
+				t := frame.sample(x, y, opts.interpolation())
+				r, g, b := cs.color(t)
+				switch mode {
+				case FusionBlend:
+					c = blend(c, r, g, b, alpha)
+				case FusionPIP:
+					if x >= w/4 && x < w*3/4 && y >= h/4 && y < h*3/4 {
+						c = color.RGBA{r, g, b, 255}
+					}
+				case FusionAbove:
+					if t >= opts.FusionThreshold {
+						c = color.RGBA{r, g, b, 255}
+					}
+				case FusionBelow:
+					if t <= opts.FusionThreshold {
+						c = color.RGBA{r, g, b, 255}
+					}
+				}
+			}
+			fused.SetRGBA(vx, vy, c)
+		}
+	}
+	return fused
+}
+
+// blend mixes the color r, g, b with the opacity alpha over c
+func blend(c color.RGBA, r uint8, g uint8, b uint8, alpha float64) color.RGBA {
+	mix := func(v uint8, ir uint8) uint8 {
+		return uint8(float64(ir)*alpha + float64(v)*(1-alpha) + 0.5)
+	}
+	return color.RGBA{mix(c.R, r), mix(c.G, g), mix(c.B, b), 255}
+}
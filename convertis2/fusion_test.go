@@ -0,0 +1,146 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParseAlignment(t *testing.T) {
+	tests := []struct {
+		s    string
+		want *Alignment
+	}{
+		{"10,20,2", &Alignment{OffsetX: 10, OffsetY: 20, Scale: 2}},
+		{" -4.5, 0 ,1.8,12", &Alignment{OffsetX: -4.5, Scale: 1.8, Parallax: 12}},
+		{"10,20", nil},
+		{"10,20,2,3,4", nil},
+		{"10,20,0", nil},
+		{"10,20,-1", nil},
+		{"a,20,2", nil},
+	}
+	for _, tt := range tests {
+		a, err := ParseAlignment(tt.s)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q: got %+v, want an error", tt.s, a)
+			}
+			continue
+		}
+		if err != nil || *a != *tt.want {
+			t.Errorf("%q: got %+v %v, want %+v", tt.s, a, err, tt.want)
+		}
+	}
+}
+
+func TestAlignment(t *testing.T) {
+	vis := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	manual := &Alignment{OffsetX: 1, OffsetY: 2, Scale: 3}
+	sidecar := &Alignment{OffsetX: 4, OffsetY: 5, Scale: 6}
+	tests := []struct {
+		name    string
+		opts    *Alignment
+		sidecar *Alignment
+		want    Alignment
+	}{
+		{"default", nil, nil, Alignment{OffsetX: 0, OffsetY: 0, Scale: 2}},
+		{"sidecar", nil, sidecar, *sidecar},
+		{"manual", manual, nil, *manual},
+		{"manual over sidecar", manual, sidecar, *manual},
+	}
+	for _, tt := range tests {
+		frame := testTemperatures(320, 240, func(x, y int) float64 { return 20 })
+		frame.Alignment = tt.sidecar
+		if got := (Options{Alignment: tt.opts}).alignment(frame, vis); got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	frame := testTemperatures(320, 200, func(x, y int) float64 { return 20 })
+	if got := defaultAlignment(frame, vis); got.OffsetY != 40 || got.Scale != 2 {
+		t.Errorf("default alignment of 320x200 in 640x480: %+v, want offset 40 and scale 2", got)
+	}
+}
+
+func TestIRPosition(t *testing.T) {
+	a := Alignment{OffsetX: 10, OffsetY: 20, Scale: 2, Parallax: 4}
+	tests := []struct {
+		vx, vy int
+		x, y   float64
+	}{
+		{10, 24, -0.25, -0.25},
+		{11, 25, 0.25, 0.25},
+		{12, 26, 0.75, 0.75},
+		{0, 0, -5.25, -12.25},
+	}
+	for _, tt := range tests {
+		if x, y := a.irPosition(tt.vx, tt.vy); x != tt.x || y != tt.y {
+			t.Errorf("%d,%d: %v,%v, want %v,%v", tt.vx, tt.vy, x, y, tt.x, tt.y)
+		}
+	}
+}
+
+func TestRenderFusion(t *testing.T) {
+	// The left half is 10 °C, the right half 30 °C.
+	frame := testTemperatures(320, 240, func(x, y int) float64 {
+		if x < 160 {
+			return 10
+		}
+		return 30
+	})
+	vis := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	gray := color.RGBA{100, 100, 100, 255}
+	for i := 0; i < len(vis.Pix); i += 4 {
+		copy(vis.Pix[i:], []uint8{gray.R, gray.G, gray.B, gray.A})
+	}
+	cold := func(opts Options) color.RGBA {
+		r, g, b := newColorscale(frame, opts).color(10)
+		return color.RGBA{r, g, b, 255}
+	}
+	hot := func(opts Options) color.RGBA {
+		r, g, b := newColorscale(frame, opts).color(30)
+		return color.RGBA{r, g, b, 255}
+	}
+	tests := []struct {
+		name string
+		opts Options
+		// colors at the left edge, the left center, the right center and
+		// the right edge
+		want func(opts Options) [4]color.RGBA
+	}{
+		{"blend", Options{}, func(o Options) [4]color.RGBA {
+			b := blend(gray, cold(o).R, cold(o).G, cold(o).B, 0.5)
+			h := blend(gray, hot(o).R, hot(o).G, hot(o).B, 0.5)
+			return [4]color.RGBA{b, b, h, h}
+		}},
+		{"opaque", Options{FusionAlpha: 1}, func(o Options) [4]color.RGBA {
+			return [4]color.RGBA{cold(o), cold(o), hot(o), hot(o)}
+		}},
+		{"pip", Options{FusionMode: FusionPIP}, func(o Options) [4]color.RGBA {
+			return [4]color.RGBA{gray, cold(o), hot(o), gray}
+		}},
+		{"above", Options{FusionMode: FusionAbove, FusionThreshold: 20}, func(o Options) [4]color.RGBA {
+			return [4]color.RGBA{gray, gray, hot(o), hot(o)}
+		}},
+		{"below", Options{FusionMode: FusionBelow, FusionThreshold: 20}, func(o Options) [4]color.RGBA {
+			return [4]color.RGBA{cold(o), cold(o), gray, gray}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := renderFusion(frame, vis, tt.opts).(*image.RGBA)
+			if img.Bounds() != vis.Bounds() {
+				t.Fatalf("bounds %v, want %v", img.Bounds(), vis.Bounds())
+			}
+			want := tt.want(tt.opts)
+			for i, x := range []int{2, 300, 340, 637} {
+				if got := img.RGBAAt(x, 240); got != want[i] {
+					t.Errorf("pixel %d,240: %v, want %v", x, got, want[i])
+				}
+			}
+		})
+	}
+}
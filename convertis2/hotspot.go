@@ -0,0 +1,205 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Patterns of the hotspots of photovoltaic modules
+const (
+	// PatternCell is a single hot cell, e.g. a cracked or shaded cell
+	PatternCell = "cell"
+	// PatternBypassDiode is a uniformly hot strip of cells, a substring
+	// bypassed by its diode
+	PatternBypassDiode = "bypass diode"
+	// PatternString is a large uniformly hot area, e.g. a disconnected
+	// module or string
+	PatternString = "string"
+)
+
+// hotspotTile is the side of the tiles of the local reference in pixels
+const hotspotTile = 8
+
+// HotspotOptions are the parameters of the hotspot detection
+type HotspotOptions struct {
+	// Threshold of the hot pixels in K above the median of their
+	// neighbourhood
+	Threshold float64
+	// MinArea is the min. area of a hotspot in pixels. 0 selects 4.
+	MinArea int
+	// Window is the side of the neighbourhood in pixels. It should be at
+	// least twice as wide as the largest hot area, a hot area of more than
+	// half of the neighbourhood is taken for its background. 0 selects 160.
+	Window int
+}
+
+// minArea returns the min. area of a hotspot
+func (o *HotspotOptions) minArea() int {
+	if o.MinArea <= 0 {
+		return 4
+	}
+	return o.MinArea
+}
+
+// window returns the side of the neighbourhood
+func (o *HotspotOptions) window() int {
+	if o.Window <= 0 {
+		return 160
+	}
+	return o.Window
+}
+
+// Validate checks the hotspot options
+func (o *HotspotOptions) Validate() error {
+	if o.Threshold <= 0 {
+		return fmt.Errorf("Hotspot threshold must be above 0 K.")
+	}
+	if o.Window < 0 {
+		return fmt.Errorf("Hotspot window must not be negative.")
+	}
+	return nil
+}
+
+// Hotspot is a connected region above the threshold
+type Hotspot struct {
+	// Number of the hotspot, 1 for the largest delta T
+	Number int `json:"number"`
+	// Bounding box in camera pixels
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Area in pixels
+	Area int `json:"area"`
+	// Peak is the hottest pixel, Mean the mean temperature of the region
+	Peak Spot    `json:"peak"`
+	Mean float64 `json:"mean"`
+	// Surrounding is the median temperature around the region, DeltaT the
+	// peak minus the surrounding
+	Surrounding float64 `json:"surrounding"`
+	DeltaT      float64 `json:"delta_t"`
+	// Pattern is one of cell, bypass diode and string
+	Pattern string `json:"pattern"`
+}
+
+// Hotspots segments the picture into the connected regions of the pixels
+// above the threshold over the median of their neighbourhood. The local
+// reference keeps the modules apart from a colder or hotter background,
+// e.g. the ground or a roof. The regions are numbered by their delta T, the
+// largest first.
+func (t *Thermogram) Hotspots(o HotspotOptions) []Hotspot {
+	reference := t.localReference(o.window())
+	labels, comps := components(t.Width, t.Height, func(i int) bool {
+		return t.Temperatures[i] > reference[i]+o.Threshold
+	})
+	var spots []Hotspot
+	for _, c := range comps {
+		if len(c.Pixels) < o.minArea() {
+			continue
+		}
+		h := Hotspot{X: c.X0, Y: c.Y0, Width: c.X1 - c.X0, Height: c.Y1 - c.Y0, Area: len(c.Pixels)}
+		peak, sum := c.Pixels[0], 0.0
+		for _, i := range c.Pixels {
+			sum += t.Temperatures[i]
+			if t.Temperatures[i] > t.Temperatures[peak] {
+				peak = i
+			}
+		}
+		h.Peak = Spot{Name: "peak", X: peak % t.Width, Y: peak / t.Width, Temperature: round2(t.Temperatures[peak])}
+		h.Mean = round2(sum / float64(len(c.Pixels)))
+		h.Surrounding = round2(t.surrounding(c, labels, reference[peak]))
+		h.DeltaT = round2(t.Temperatures[peak] - h.Surrounding)
+		h.Pattern = hotspotPattern(c, t.Width, t.Height)
+		spots = append(spots, h)
+	}
+	sort.SliceStable(spots, func(i, j int) bool {
+		return spots[i].DeltaT > spots[j].DeltaT
+	})
+	for i := range spots {
+		spots[i].Number = i + 1
+	}
+	return spots
+}
+
+// localReference returns the reference temperature of every pixel. The
+// picture is divided into tiles of hotspotTile pixels, the reference is the
+// median of the tile medians in the window around the tile of the pixel.
+func (t *Thermogram) localReference(window int) []float64 {
+	nx := (t.Width + hotspotTile - 1) / hotspotTile
+	ny := (t.Height + hotspotTile - 1) / hotspotTile
+	tiles := make([]float64, nx*ny)
+	var values []float64
+	for ty := 0; ty < ny; ty++ {
+		for tx := 0; tx < nx; tx++ {
+			values = values[:0]
+			for y := ty * hotspotTile; y < min((ty+1)*hotspotTile, t.Height); y++ {
+				for x := tx * hotspotTile; x < min((tx+1)*hotspotTile, t.Width); x++ {
+					values = append(values, t.Temperatures[y*t.Width+x])
+				}
+			}
+			tiles[ty*nx+tx] = median(values)
+		}
+	}
+	r := max(window/hotspotTile/2, 1)
+	local := make([]float64, nx*ny)
+	for ty := 0; ty < ny; ty++ {
+		for tx := 0; tx < nx; tx++ {
+			values = values[:0]
+			for y := max(ty-r, 0); y < min(ty+r+1, ny); y++ {
+				values = append(values, tiles[y*nx+max(tx-r, 0):y*nx+min(tx+r+1, nx)]...)
+			}
+			local[ty*nx+tx] = median(values)
+		}
+	}
+	reference := make([]float64, t.Width*t.Height)
+	for i := range reference {
+		reference[i] = local[(i/t.Width/hotspotTile)*nx+i%t.Width/hotspotTile]
+	}
+	return reference
+}
+
+// surrounding returns the median of the pixels outside of all regions in
+// the bounding box of c grown by its size. Without such pixels it returns
+// the reference.
+func (t *Thermogram) surrounding(c component, labels []int, reference float64) float64 {
+	margin := max(c.X1-c.X0, c.Y1-c.Y0, 3)
+	var values []float64
+	for y := max(c.Y0-margin, 0); y < min(c.Y1+margin, t.Height); y++ {
+		for x := max(c.X0-margin, 0); x < min(c.X1+margin, t.Width); x++ {
+			if i := y*t.Width + x; labels[i] == 0 {
+				values = append(values, t.Temperatures[i])
+			}
+		}
+	}
+	if len(values) == 0 {
+		return reference
+	}
+	return median(values)
+}
+
+// hotspotPattern classifies a region of a width x height picture by its
+// shape. A region of a tenth of the picture or more is a string, an
+// elongated and well filled region a bypass diode, every other region a
+// cell.
+func hotspotPattern(c component, width int, height int) string {
+	w, h := c.X1-c.X0, c.Y1-c.Y0
+	fill := float64(len(c.Pixels)) / float64(w*h)
+	aspect := float64(max(w, h)) / float64(min(w, h))
+	switch {
+	case len(c.Pixels)*10 >= width*height && fill >= 0.5:
+		return PatternString
+	case aspect >= 2 && fill >= 0.6:
+		return PatternBypassDiode
+	}
+	return PatternCell
+}
+
+// String returns the hotspot as text
+func (h Hotspot) String() string {
+	return fmt.Sprintf("%d %s at %d,%d size %dx%d, %d px, peak %.2f °C, delta %.2f K",
+		h.Number, h.Pattern, h.X, h.Y, h.Width, h.Height, h.Area, h.Peak.Temperature, h.DeltaT)
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"testing"
+)
+
+// moduleField returns the temperature of a picture with modules of 40 °C
+// right of x 200 on a ground of 20 °C and hot cells of 50 °C in the
+// rectangles of cells
+func moduleField(cells ...[4]int) func(x, y int) float64 {
+	return func(x, y int) float64 {
+		for _, c := range cells {
+			if x >= c[0] && y >= c[1] && x < c[0]+c[2] && y < c[1]+c[3] {
+				return 50
+			}
+		}
+		if x >= 200 {
+			return 40
+		}
+		return 20
+	}
+}
+
+func TestHotspots(t *testing.T) {
+	tests := []struct {
+		name     string
+		f        func(x, y int) float64
+		opts     HotspotOptions
+		patterns []string
+		peak     [2]int
+		deltaT   float64
+	}{
+		{"uniform", func(x, y int) float64 { return 25 }, HotspotOptions{Threshold: 5}, nil, [2]int{}, 0},
+		{"modules without hot cell", moduleField(), HotspotOptions{Threshold: 5}, nil, [2]int{}, 0},
+		{"hot cell on the modules", moduleField([4]int{280, 120, 6, 6}), HotspotOptions{Threshold: 5}, []string{PatternCell}, [2]int{280, 120}, 10},
+		{"hot cell on the ground", moduleField([4]int{60, 40, 6, 6}), HotspotOptions{Threshold: 5}, []string{PatternCell}, [2]int{60, 40}, 30},
+		{"below the min. area", moduleField([4]int{280, 120, 1, 3}), HotspotOptions{Threshold: 5}, nil, [2]int{}, 0},
+		{"bypass diode", moduleField([4]int{240, 40, 10, 40}), HotspotOptions{Threshold: 5}, []string{PatternBypassDiode}, [2]int{240, 40}, 10},
+		// The surrounding of the string reaches into the ground.
+		{"string", moduleField([4]int{210, 10, 90, 100}), HotspotOptions{Threshold: 5, Window: 320}, []string{PatternString}, [2]int{210, 10}, 30},
+		{"two cells", moduleField([4]int{280, 120, 6, 6}, [4]int{220, 200, 4, 4}), HotspotOptions{Threshold: 5}, []string{PatternCell, PatternCell}, [2]int{280, 120}, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spots := testTemperatures(320, 240, tt.f).Hotspots(tt.opts)
+			if len(spots) != len(tt.patterns) {
+				t.Fatalf("%d hotspots %v, want %d", len(spots), spots, len(tt.patterns))
+			}
+			for i, h := range spots {
+				if h.Number != i+1 {
+					t.Errorf("hotspot %d has the number %d", i+1, h.Number)
+				}
+				if h.Pattern != tt.patterns[i] {
+					t.Errorf("hotspot %d: pattern %s, want %s", i+1, h.Pattern, tt.patterns[i])
+				}
+			}
+			if len(spots) == 0 {
+				return
+			}
+			if h := spots[0]; h.Peak.X != tt.peak[0] || h.Peak.Y != tt.peak[1] || h.DeltaT != tt.deltaT {
+				t.Errorf("peak at %d,%d delta %.2f K, want %d,%d delta %.2f K", h.Peak.X, h.Peak.Y, h.DeltaT, tt.peak[0], tt.peak[1], tt.deltaT)
+			}
+		})
+	}
+}
+
+func TestHotspotOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts HotspotOptions
+		ok   bool
+	}{
+		{HotspotOptions{Threshold: 5}, true},
+		{HotspotOptions{Threshold: 5, MinArea: 10, Window: 64}, true},
+		{HotspotOptions{}, false},
+		{HotspotOptions{Threshold: -1}, false},
+		{HotspotOptions{Threshold: 5, Window: -8}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v: error %v", tt.opts, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"archive/zip"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Info describes a file without converting it
+type Info struct {
+	File string `json:"file"`
+	// Format is the name of the decoder. Version is the is2 file version,
+	// 0 for other formats.
+	Format  string `json:"format"`
+	Version int    `json:"version,omitempty"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	// Capture of the picture
+	Captured *time.Time `json:"captured,omitempty"`
+	Make     string     `json:"make,omitempty"`
+	Model    string     `json:"model,omitempty"`
+	Serial   string     `json:"serial,omitempty"`
+	GPS      *GPS       `json:"gps,omitempty"`
+	// Params of the temperatures. Stored is false for the default
+	// parameters of files without stored parameters.
+	Params Params `json:"params"`
+	Stored bool   `json:"params_stored"`
+	// Sidecar is the path of the applied sidecar, Asset its asset ID.
+	// SidecarParams reports parameters overridden by the sidecar.
+	Sidecar       string `json:"sidecar,omitempty"`
+	SidecarParams bool   `json:"params_sidecar,omitempty"`
+	Asset         string `json:"asset,omitempty"`
+	// EmissionMap is the share of the pixels with an emission factor of
+	// the emission map in percent
+	EmissionMap float64 `json:"emission_map_percent,omitempty"`
+	// Min, Max and Mean temperature in degree celsius
+	Min  Spot    `json:"min"`
+	Max  Spot    `json:"max"`
+	Mean float64 `json:"mean"`
+	// Visual and Audio report the visual picture and the voice annotation
+	Visual       bool     `json:"visual"`
+	Audio        bool     `json:"audio"`
+	AudioSeconds float64  `json:"audio_seconds,omitempty"`
+	ROIs         []ROI    `json:"rois,omitempty"`
+	Annotations  []string `json:"annotations,omitempty"`
+	Analysis
+	// Classification by the rule set
+	Classification *Classification `json:"classification,omitempty"`
+	// Entries of the zip of the new is2 format
+	Entries []ZipEntry `json:"entries,omitempty"`
+}
+
+// ZipEntry is a file in the zip of the new is2 format
+type ZipEntry struct {
+	Name string `json:"name"`
+	// Size and CompressedSize in bytes
+	Size           uint64 `json:"size"`
+	CompressedSize uint64 `json:"compressed_size"`
+}
+
+// ReadInfo decodes filename with the stored parameters, describes it and
+// classifies it by the rules. nil selects DefaultRuleSet. The options add
+// their Analysis. The emission mask of opts replaces the mask of the
+// sidecar. No file is written.
+func ReadInfo(filename string, opts Options, rules *RuleSet) (*Info, error) {
+	frame, err := decodeOptions(filename, Options{EmissionMask: opts.EmissionMask, Logger: opts.Logger})
+	if err != nil {
+		return nil, err
+	}
+	info, err := newInfo(filename, frame)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = DefaultRuleSet
+	}
+	c := rules.Classify(frame, opts.Ambient)
+	info.Classification = &c
+	info.Analysis = analyze(frame, opts)
+	return info, nil
+}
+
+// newInfo describes the decoded file
+func newInfo(filename string, frame *Thermogram) (*Info, error) {
+	info := &Info{
+		File:        filename,
+		Format:      frame.Format,
+		Width:       frame.Width,
+		Height:      frame.Height,
+		Params:      frame.Params,
+		Stored:      frame.StoredParams != nil,
+		Min:         Spot{Name: "min", X: frame.MinX, Y: frame.MinY, Temperature: round2(frame.Min())},
+		Max:         Spot{Name: "max", X: frame.MaxX, Y: frame.MaxY, Temperature: round2(frame.Max())},
+		Mean:        round2(frame.Mean()),
+		Visual:      frame.Visual != nil || frame.VisualJPEG != nil,
+		Audio:       len(frame.Audio) > 0,
+		ROIs:        frame.ROIs,
+		Annotations: frame.Annotations,
+		Asset:       frame.Asset,
+		EmissionMap: round2(frame.EmissionMapShare()),
+	}
+	if frame.Sidecar != nil {
+		info.Sidecar = SidecarPath(filename)
+		info.SidecarParams = frame.Sidecar.overridesParams()
+	}
+	switch frame.Format {
+	case FormatOldIS2:
+		info.Version = 1
+	case FormatNewIS2:
+		info.Version = 2
+	}
+	if frame.AudioRate > 0 {
+		info.AudioSeconds = round2(float64(len(frame.Audio)/2) / float64(frame.AudioRate))
+	}
+	if m := frame.Metadata; m != nil {
+		if !m.DateTimeOriginal.IsZero() {
+			captured := m.DateTimeOriginal
+			info.Captured = &captured
+		}
+		info.Make, info.Model, info.Serial, info.GPS = m.Make, m.Model, m.Serial, m.GPS
+	}
+	if frame.Format == FormatNewIS2 {
+		zr, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			info.Entries = append(info.Entries, ZipEntry{Name: f.Name, Size: f.UncompressedSize64, CompressedSize: f.CompressedSize64})
+		}
+	}
+	return info, nil
+}
+
+// String returns the info as text
+func (i *Info) String() string {
+	var b strings.Builder
+	line := func(name string, format string, a ...any) {
+		fmt.Fprintf(&b, "%-13s "+format+"\n", append([]any{name + ":"}, a...)...)
+	}
+	line("File", "%s", i.File)
+	if i.Version > 0 {
+		line("Format", "%s (fileversion %d)", i.Format, i.Version)
+	} else {
+		line("Format", "%s", i.Format)
+	}
+	line("Size", "%dx%d", i.Width, i.Height)
+	if i.Captured != nil {
+		line("Captured", "%s", i.Captured.Format("2006-01-02 15:04:05"))
+	}
+	if camera := strings.TrimSpace(i.Make + " " + i.Model); camera != "" {
+		line("Camera", "%s", camera)
+	}
+	if i.Serial != "" {
+		line("Serial", "%s", i.Serial)
+	}
+	if i.GPS != nil {
+		line("GPS", "%.6f, %.6f, %.1f m", i.GPS.Latitude, i.GPS.Longitude, i.GPS.Altitude)
+	}
+	if i.Sidecar != "" {
+		line("Sidecar", "%s", i.Sidecar)
+	}
+	if i.Asset != "" {
+		line("Asset", "%s", i.Asset)
+	}
+	source := "default"
+	if i.SidecarParams {
+		source = "sidecar"
+	} else if i.Stored {
+		source = "stored"
+	}
+	line("Parameters", "background %.2f °C, emission %.2f (%s)", i.Params.Background, i.Params.Emission, source)
+	if i.EmissionMap > 0 {
+		line("Emission map", "%.1f %% of the pixels", i.EmissionMap)
+	}
+	line("Min", "%.2f °C at %d,%d", i.Min.Temperature, i.Min.X, i.Min.Y)
+	line("Max", "%.2f °C at %d,%d", i.Max.Temperature, i.Max.X, i.Max.Y)
+	line("Mean", "%.2f °C", i.Mean)
+	line("Visual", "%s", yesNo(i.Visual))
+	if i.Audio {
+		line("Audio", "yes, %.1f s", i.AudioSeconds)
+	} else {
+		line("Audio", "no")
+	}
+	for _, roi := range i.ROIs {
+		if roi.Emission != 0 {
+			line("ROI", "%s at %d,%d size %dx%d, emission %.2f", roi.Name, roi.X, roi.Y, roi.Width, roi.Height, roi.Emission)
+		} else {
+			line("ROI", "%s at %d,%d size %dx%d", roi.Name, roi.X, roi.Y, roi.Width, roi.Height)
+		}
+	}
+	for _, note := range i.Annotations {
+		line("Note", "%s", note)
+	}
+	if b := i.Building; b != nil {
+		line("Climate", "indoor %.1f °C, humidity %.0f %%, outdoor %.1f °C", b.Climate.Indoor, b.Climate.Humidity, b.Climate.Outdoor)
+		line("Building", "%s", b)
+	}
+	for _, h := range i.Hotspots {
+		line("Hotspot", "%s", h)
+	}
+	for _, c := range i.Clusters {
+		line("Cluster", "%s", c)
+	}
+	if c := i.Classification; c != nil {
+		line("Severity", "%s (%s)", severity(c), c.RuleSet)
+		for _, f := range c.Findings {
+			subject := f.Subject
+			if subject == "" {
+				subject = "picture"
+			}
+			line("Finding", "%s %s %.2f > %.2f: %s", subject, f.Rule.Measure, f.Value, f.Rule.Above, f.Rule.Severity)
+		}
+		if c.NoReference {
+			line("Reference", "none, the delta-T rules need a ROI named ref or an ambient temperature")
+		}
+	}
+	if len(i.Entries) > 0 {
+		line("Zip entries", "%d", len(i.Entries))
+		for _, e := range i.Entries {
+			fmt.Fprintf(&b, "  %10d %10d  %s\n", e.Size, e.CompressedSize, e.Name)
+		}
+	}
+	return b.String()
+}
+
+// yesNo returns yes or no
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadInfo(t *testing.T) {
+	old := testOldIS2(testRaw(1320, 2093))
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		sidecar string
+		opts    Options
+		check   func(t *testing.T, info *Info)
+		lines   []string
+	}{
+		{"old format", "old.IS2", old, "", Options{}, func(t *testing.T, info *Info) {
+			if info.Format != FormatOldIS2 || info.Version != 1 || info.Width != 320 || info.Height != 240 {
+				t.Errorf("%s version %d %dx%d", info.Format, info.Version, info.Width, info.Height)
+			}
+			if !info.Visual || !info.Audio || info.AudioSeconds != 0.5 {
+				t.Errorf("visual %v, audio %v %.2f s", info.Visual, info.Audio, info.AudioSeconds)
+			}
+			if info.Captured != nil || info.Entries != nil || info.Sidecar != "" {
+				t.Errorf("captured %v, entries %v, sidecar %q", info.Captured, info.Entries, info.Sidecar)
+			}
+			if info.Max.X != 200 || info.Max.Y != 90 || info.Min.Temperature >= info.Mean || info.Mean >= info.Max.Temperature {
+				t.Errorf("min %+v, mean %.2f, max %+v", info.Min, info.Mean, info.Max)
+			}
+		}, []string{"Format:       is2-old (fileversion 1)", "Size:         320x240", "(default)"}},
+		{"new format", "new.IS2", testNewIS2(t, testRaw(4716, 7263), nil), "", Options{}, func(t *testing.T, info *Info) {
+			if info.Format != FormatNewIS2 || info.Version != 2 || info.Visual || info.Audio {
+				t.Errorf("%s version %d, visual %v, audio %v", info.Format, info.Version, info.Visual, info.Audio)
+			}
+			if len(info.Entries) != 2 || info.Entries[0].Name != "Images/Main/IR.data" || info.Entries[0].Size != 640+2*320*240 {
+				t.Errorf("entries %+v", info.Entries)
+			}
+		}, []string{"(fileversion 2)"}},
+		{"sidecar", "old.IS2", old, "asset: TR-1\nemission: 0.8\nrois:\n  - {name: L1, x: 190, y: 80, width: 20, height: 20}\nnotes: [loose terminal]\n", Options{}, func(t *testing.T, info *Info) {
+			if !strings.HasSuffix(info.Sidecar, "old.IS2.yaml") || !info.SidecarParams || info.Asset != "TR-1" {
+				t.Errorf("sidecar %q %v, asset %q", info.Sidecar, info.SidecarParams, info.Asset)
+			}
+			if info.Params.Emission != 0.8 || len(info.ROIs) != 1 || len(info.Annotations) != 1 {
+				t.Errorf("params %+v, ROIs %v, annotations %v", info.Params, info.ROIs, info.Annotations)
+			}
+		}, []string{"Asset:        TR-1", "emission 0.80 (sidecar)"}},
+		{"hotspots", "old.IS2", old, "", Options{Hotspots: &HotspotOptions{Threshold: 10}}, func(t *testing.T, info *Info) {
+			if len(info.Hotspots) != 1 || info.Hotspots[0].Peak.X != 200 || info.Hotspots[0].Peak.Y != 90 {
+				t.Errorf("hotspots %v", info.Hotspots)
+			}
+		}, nil},
+		{"classification", "old.IS2", old, "", Options{}, func(t *testing.T, info *Info) {
+			if info.Classification == nil {
+				t.Error("no classification")
+			}
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeTestFile(t, tt.file, tt.data)
+			if tt.sidecar != "" {
+				if err := os.WriteFile(filename+".yaml", []byte(tt.sidecar), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			info, err := ReadInfo(filename, tt.opts, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.File != filename {
+				t.Errorf("file %s, want %s", info.File, filename)
+			}
+			tt.check(t, info)
+			text := info.String()
+			for _, line := range tt.lines {
+				if !strings.Contains(text, line) {
+					t.Errorf("%q not in\n%s", line, text)
+				}
+			}
+		})
+	}
+}
+
+func TestReadInfoUnknownFormat(t *testing.T) {
+	_, err := ReadInfo(writeTestFile(t, "text.IS2", []byte("no picture")), Options{}, nil)
+	if err == nil {
+		t.Error("info of a text file")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Offset of the audio data in the old format
+const oldIS2AudioOffset = 784080
+
+// ROI is a rectangular region of interest of the infrared picture in camera
+// pixels. A ROI with a width and a height of 0 is a spot.
+type ROI struct {
+	Name   string `json:"name" yaml:"name"`
+	X      int    `json:"x" yaml:"x"`
+	Y      int    `json:"y" yaml:"y"`
+	Width  int    `json:"width" yaml:"width"`
+	Height int    `json:"height" yaml:"height"`
+	// Emission factor of the surface in the ROI, 0 selects the emission
+	// factor of the picture. It is applied to the pixels of the ROI by the
+	// emission map.
+	Emission float64 `json:"emission,omitempty" yaml:"emission,omitempty"`
+}
+
+// ParseROI parses a ROI of the form "name,x,y[,width,height[,emission]]"
+func ParseROI(s string) (ROI, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 && len(parts) != 5 && len(parts) != 6 {
+		return ROI{}, fmt.Errorf("%s: ROI must be name,x,y[,width,height[,emission]].", s)
+	}
+	values := make([]int, 4)
+	for i, part := range parts[1:min(len(parts), 5)] {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return ROI{}, fmt.Errorf("%s: bad ROI. %w", s, err)
+		}
+		values[i] = v
+	}
+	if values[2] < 0 || values[3] < 0 {
+		return ROI{}, fmt.Errorf("%s: ROI size must not be negative.", s)
+	}
+	roi := ROI{Name: parts[0], X: values[0], Y: values[1], Width: values[2], Height: values[3]}
+	if len(parts) == 6 {
+		e, err := strconv.ParseFloat(strings.TrimSpace(parts[5]), 64)
+		if err != nil {
+			return ROI{}, fmt.Errorf("%s: bad ROI emission. %w", s, err)
+		}
+		if e <= 0 || e > 1 {
+			return ROI{}, fmt.Errorf("%s: ROI emission must be between 0 and 1.", s)
+		}
+		roi.Emission = e
+	}
+	return roi, nil
+}
+
+// oldIS2Offset finds the offset of the old format. The data starts after 20
+// bytes of 0xFF within the first 1000 bytes.
+func oldIS2Offset(r io.Reader) (int64, error) {
+	var bval uint8
+	c := 0
+	i := 0
+	for {
+		i = i + 1
+		err := binary.Read(r, binary.LittleEndian, &bval)
+		if err != nil {
+			return 0, ErrFormat
+		}
+		if bval == 0xFF {
+			c = c + 1
+		} else {
+			c = 0
+		}
+		if c >= 20 {
+			break
+		}
+		if i == 1000 {
+			return 0, ErrFormat
+		}
+	}
+	return int64(i), nil
+}
+
+// wavData returns a wav file of 16 bit little endian mono samples
+func wavData(samples []byte, rate int) []byte {
+	samples = samples[:len(samples)&^1]
+	le := binary.LittleEndian
+	data := make([]byte, 0, 44+len(samples))
+	data = append(data, "RIFF"...)
+	data = le.AppendUint32(data, uint32(36+len(samples)))
+	data = append(data, "WAVEfmt "...)
+	data = le.AppendUint32(data, 16)
+	data = le.AppendUint16(data, 1) // PCM
+	data = le.AppendUint16(data, 1) // mono
+	data = le.AppendUint32(data, uint32(rate))
+	data = le.AppendUint32(data, uint32(rate*2))
+	data = le.AppendUint16(data, 2)
+	data = le.AppendUint16(data, 16)
+	data = append(data, "data"...)
+	data = le.AppendUint32(data, uint32(len(samples)))
+	return append(data, samples...)
+}
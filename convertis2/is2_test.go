@@ -0,0 +1,75 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/cryptix/wav"
+)
+
+func TestParseROI(t *testing.T) {
+	tests := []struct {
+		s    string
+		want ROI
+		ok   bool
+	}{
+		{"spot,10,20", ROI{Name: "spot", X: 10, Y: 20}, true},
+		{"L1, 10, 20, 30, 40", ROI{Name: "L1", X: 10, Y: 20, Width: 30, Height: 40}, true},
+		{"copper,10,20,30,40,0.3", ROI{Name: "copper", X: 10, Y: 20, Width: 30, Height: 40, Emission: 0.3}, true},
+		{"spot,10", ROI{}, false},
+		{"box,10,20,30", ROI{}, false},
+		{"box,10,20,-30,40", ROI{}, false},
+		{"box,a,20", ROI{}, false},
+		{"copper,10,20,30,40,0", ROI{}, false},
+		{"copper,10,20,30,40,1.2", ROI{}, false},
+		{"copper,10,20,30,40,x", ROI{}, false},
+	}
+	for _, tt := range tests {
+		roi, err := ParseROI(tt.s)
+		if (err == nil) != tt.ok || roi != tt.want {
+			t.Errorf("%q: %+v %v, want %+v", tt.s, roi, err, tt.want)
+		}
+	}
+}
+
+func TestWAVData(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []byte
+		rate    int
+	}{
+		{"8 kHz", bytes.Repeat([]byte{1, 2, 3, 4}, 100), 8000},
+		{"44.1 kHz", bytes.Repeat([]byte{0xFF, 0x7F, 0, 0x80}, 10), 44100},
+		{"odd length", []byte{1, 2, 3}, 8000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := wavData(tt.samples, tt.rate)
+			r, err := wav.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := r.GetFile()
+			if f.Channels != 1 || f.SignificantBits != 16 {
+				t.Errorf("%d channels of %d bit, want 16 bit mono", f.Channels, f.SignificantBits)
+			}
+			dr, err := r.GetDumbReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			samples, err := io.ReadAll(io.LimitReader(dr, int64(f.SoundSize)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rate := int(f.SampleRate)
+			if want := tt.samples[:len(tt.samples)&^1]; !bytes.Equal(samples, want) || rate != tt.rate {
+				t.Errorf("%d samples with %d Hz, want %d samples with %d Hz", len(samples)/2, rate, len(want)/2, tt.rate)
+			}
+		})
+	}
+}
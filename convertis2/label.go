@@ -0,0 +1,78 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"math"
+	"sort"
+)
+
+// component is a connected region of pixels
+type component struct {
+	// Bounding box, X1 and Y1 are exclusive
+	X0, Y0, X1, Y1 int
+	// Pixels are the indices of the pixels row by row
+	Pixels []int
+}
+
+// components labels the 8-connected components of the pixels of a width x
+// height picture for which in is true. labels has the 1-based number of the
+// component of every pixel, 0 for the pixels outside.
+func components(width int, height int, in func(i int) bool) ([]int, []component) {
+	labels := make([]int, width*height)
+	var comps []component
+	var stack []int
+	for start := range labels {
+		if labels[start] != 0 || !in(start) {
+			continue
+		}
+		label := len(comps) + 1
+		c := component{X0: width, Y0: height}
+		labels[start] = label
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			c.Pixels = append(c.Pixels, i)
+			x, y := i%width, i/width
+			c.X0, c.Y0 = min(c.X0, x), min(c.Y0, y)
+			c.X1, c.Y1 = max(c.X1, x+1), max(c.Y1, y+1)
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= width || ny >= height {
+						continue
+					}
+					n := ny*width + nx
+					if labels[n] == 0 && in(n) {
+						labels[n] = label
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+		sort.Ints(c.Pixels)
+		comps = append(comps, c)
+	}
+	return labels, comps
+}
+
+// median returns the median of the values. The values are sorted.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// round2 rounds v to 0.01, the precision of the reported temperatures
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,531 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strings"
+	"time"
+)
+
+// Metadata describes the capture of a picture and the measurement. It is
+// embedded as EXIF and XMP into the jpeg and png outputs.
+type Metadata struct {
+	// Capture of the picture, read from the source file when available
+	DateTimeOriginal time.Time
+	Make             string
+	Model            string
+	Serial           string
+	GPS              *GPS
+	// Parameters of the measurement
+	Emission   float64
+	Background float64
+	ScaleMin   float64
+	ScaleMax   float64
+	Palette    string
+	Spots      []Spot
+}
+
+// GPS is a position in degrees and meters above sea level
+type GPS struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// Spot is a temperature at a position of the infrared picture
+type Spot struct {
+	Name        string  `json:"name"`
+	X           int     `json:"x"`
+	Y           int     `json:"y"`
+	Temperature float64 `json:"temperature"`
+}
+
+// measurement returns a copy of the metadata with the measurement
+// parameters of the options and the min and max spots of the frame. frame
+// may be nil.
+func (m *Metadata) measurement(frame *Thermogram, opts Options) *Metadata {
+	meta := *m
+	meta.Palette = opts.palette()
+	if opts.manualScale() {
+		meta.ScaleMin, meta.ScaleMax = opts.MinTemp, opts.MaxTemp
+	}
+	if frame != nil {
+		meta.Emission = frame.Params.Emission
+		meta.Background = frame.Params.Background
+		cs := newColorscale(frame, opts)
+		meta.ScaleMin, meta.ScaleMax = cs.min, cs.max
+		meta.Spots = []Spot{
+			{Name: "min", X: frame.MinX, Y: frame.MinY, Temperature: frame.Min()},
+			{Name: "max", X: frame.MaxX, Y: frame.MaxY, Temperature: frame.Max()},
+		}
+	}
+	return &meta
+}
+
+// EXIF tags
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagBodySerialNumber = 0xA431
+	tagGPSVersionID     = 0x0000
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+	tagGPSAltitudeRef   = 0x0005
+	tagGPSAltitude      = 0x0006
+)
+
+// EXIF data types
+const (
+	exifByte     = 1
+	exifASCII    = 2
+	exifShort    = 3
+	exifLong     = 4
+	exifRational = 5
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// readEXIF reads the capture metadata from the EXIF segment of a jpeg
+// file. It returns an empty Metadata if the file has no EXIF segment.
+func readEXIF(data []byte) (*Metadata, error) {
+	meta := &Metadata{}
+	tiff := jpegSegment(data, 0xE1, []byte("Exif\x00\x00"))
+	if tiff == nil {
+		return meta, nil
+	}
+	if len(tiff) < 8 {
+		return meta, fmt.Errorf("EXIF data too short.")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return meta, fmt.Errorf("Bad EXIF byte order.")
+	}
+	// entry returns the value bytes of an IFD entry
+	entry := func(p int) (uint16, uint16, []byte) {
+		tag := order.Uint16(tiff[p:])
+		typ := order.Uint16(tiff[p+2:])
+		count := int(order.Uint32(tiff[p+4:]))
+		size := count * map[uint16]int{exifByte: 1, exifASCII: 1, exifShort: 2, exifLong: 4, exifRational: 8}[typ]
+		if size <= 4 {
+			return tag, typ, tiff[p+8 : p+8+size]
+		}
+		off := int(order.Uint32(tiff[p+8:]))
+		if off < 0 || off+size > len(tiff) {
+			return tag, typ, nil
+		}
+		return tag, typ, tiff[off : off+size]
+	}
+	// walk calls fn for every entry of the IFD at offset
+	walk := func(offset uint32, fn func(tag uint16, typ uint16, value []byte)) {
+		p := int(offset)
+		if p <= 0 || p+2 > len(tiff) {
+			return
+		}
+		n := int(order.Uint16(tiff[p:]))
+		for i := 0; i < n && p+2+12*i+12 <= len(tiff); i++ {
+			fn(entry(p + 2 + 12*i))
+		}
+	}
+	ascii := func(value []byte) string {
+		return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+	}
+	rationals := func(value []byte) []float64 {
+		var r []float64
+		for i := 0; i+8 <= len(value); i += 8 {
+			den := order.Uint32(value[i+4:])
+			if den == 0 {
+				r = append(r, 0)
+				continue
+			}
+			r = append(r, float64(order.Uint32(value[i:]))/float64(den))
+		}
+		return r
+	}
+	var exifOffset, gpsOffset uint32
+	walk(order.Uint32(tiff[4:]), func(tag uint16, typ uint16, value []byte) {
+		switch tag {
+		case tagMake:
+			meta.Make = ascii(value)
+		case tagModel:
+			meta.Model = ascii(value)
+		case tagDateTime:
+			if meta.DateTimeOriginal.IsZero() {
+				meta.DateTimeOriginal, _ = time.ParseInLocation(exifTimeLayout, ascii(value), time.Local)
+			}
+		case tagExifIFD:
+			if len(value) == 4 {
+				exifOffset = order.Uint32(value)
+			}
+		case tagGPSIFD:
+			if len(value) == 4 {
+				gpsOffset = order.Uint32(value)
+			}
+		}
+	})
+	walk(exifOffset, func(tag uint16, typ uint16, value []byte) {
+		switch tag {
+		case tagDateTimeOriginal:
+			t, err := time.ParseInLocation(exifTimeLayout, ascii(value), time.Local)
+			if err == nil {
+				meta.DateTimeOriginal = t
+			}
+		case tagBodySerialNumber:
+			meta.Serial = ascii(value)
+		}
+	})
+	gps := &GPS{}
+	var latref, lonref string
+	var found bool
+	walk(gpsOffset, func(tag uint16, typ uint16, value []byte) {
+		switch tag {
+		case tagGPSLatitudeRef:
+			latref = ascii(value)
+		case tagGPSLongitudeRef:
+			lonref = ascii(value)
+		case tagGPSLatitude:
+			if v := rationals(value); len(v) == 3 {
+				gps.Latitude = v[0] + v[1]/60 + v[2]/3600
+				found = true
+			}
+		case tagGPSLongitude:
+			if v := rationals(value); len(v) == 3 {
+				gps.Longitude = v[0] + v[1]/60 + v[2]/3600
+			}
+		case tagGPSAltitude:
+			if v := rationals(value); len(v) == 1 {
+				gps.Altitude = v[0]
+			}
+		}
+	})
+	if found {
+		if latref == "S" {
+			gps.Latitude = -gps.Latitude
+		}
+		if lonref == "W" {
+			gps.Longitude = -gps.Longitude
+		}
+		meta.GPS = gps
+	}
+	return meta, nil
+}
+
+// jpegSegment returns the payload of the first marker segment of a jpeg
+// file that starts with prefix, without the prefix
+func jpegSegment(data []byte, marker byte, prefix []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	p := 2
+	for p+4 <= len(data) && data[p] == 0xFF {
+		m := data[p+1]
+		if m == 0xDA || m == 0xD9 {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[p+2:]))
+		if p+2+size > len(data) {
+			break
+		}
+		payload := data[p+4 : p+2+size]
+		if m == marker && bytes.HasPrefix(payload, prefix) {
+			return payload[len(prefix):]
+		}
+		p = p + 2 + size
+	}
+	return nil
+}
+
+// exifEntry is an entry of an EXIF IFD
+type exifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// exifIFD is a list of entries sorted by tag
+type exifIFD []exifEntry
+
+// size returns the number of bytes of the IFD including its values
+func (ifd exifIFD) size() int {
+	n := 2 + 12*len(ifd) + 4
+	for _, e := range ifd {
+		if len(e.value) > 4 {
+			n += len(e.value) + len(e.value)%2
+		}
+	}
+	return n
+}
+
+// write appends the IFD at offset to buf
+func (ifd exifIFD) write(buf *bytes.Buffer, offset int) {
+	order := binary.LittleEndian
+	data := offset + 2 + 12*len(ifd) + 4
+	var values bytes.Buffer
+	binary.Write(buf, order, uint16(len(ifd)))
+	for _, e := range ifd {
+		binary.Write(buf, order, e.tag)
+		binary.Write(buf, order, e.typ)
+		binary.Write(buf, order, e.count)
+		if len(e.value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], e.value)
+			buf.Write(inline[:])
+			continue
+		}
+		binary.Write(buf, order, uint32(data+values.Len()))
+		values.Write(e.value)
+		if len(e.value)%2 == 1 {
+			values.WriteByte(0)
+		}
+	}
+	binary.Write(buf, order, uint32(0))
+	buf.Write(values.Bytes())
+}
+
+func exifASCIIEntry(tag uint16, s string) exifEntry {
+	return exifEntry{tag: tag, typ: exifASCII, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func exifLongEntry(tag uint16, v uint32) exifEntry {
+	return exifEntry{tag: tag, typ: exifLong, count: 1, value: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+func exifRationalEntry(tag uint16, values ...float64) exifEntry {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, uint32(math.Round(v*10000)))
+		b = binary.LittleEndian.AppendUint32(b, 10000)
+	}
+	return exifEntry{tag: tag, typ: exifRational, count: uint32(len(values)), value: b}
+}
+
+// dms splits degrees into degrees, minutes and seconds
+func dms(deg float64) []float64 {
+	deg = math.Abs(deg)
+	d := math.Floor(deg)
+	m := math.Floor((deg - d) * 60)
+	s := (deg - d - m/60) * 3600
+	return []float64{d, m, s}
+}
+
+// exif returns the EXIF data of the metadata as little endian TIFF
+// structure. It returns nil if there is nothing to write.
+func (m *Metadata) exif() []byte {
+	var ifd0, exififd, gpsifd exifIFD
+	if m.Make != "" {
+		ifd0 = append(ifd0, exifASCIIEntry(tagMake, m.Make))
+	}
+	if m.Model != "" {
+		ifd0 = append(ifd0, exifASCIIEntry(tagModel, m.Model))
+	}
+	if !m.DateTimeOriginal.IsZero() {
+		ifd0 = append(ifd0, exifASCIIEntry(tagDateTime, m.DateTimeOriginal.Format(exifTimeLayout)))
+		exififd = append(exififd, exifASCIIEntry(tagDateTimeOriginal, m.DateTimeOriginal.Format(exifTimeLayout)))
+	}
+	if m.Serial != "" {
+		exififd = append(exififd, exifASCIIEntry(tagBodySerialNumber, m.Serial))
+	}
+	if m.GPS != nil {
+		latref, lonref := "N", "E"
+		if m.GPS.Latitude < 0 {
+			latref = "S"
+		}
+		if m.GPS.Longitude < 0 {
+			lonref = "W"
+		}
+		var altref byte
+		if m.GPS.Altitude < 0 {
+			altref = 1
+		}
+		gpsifd = exifIFD{
+			{tag: tagGPSVersionID, typ: exifByte, count: 4, value: []byte{2, 3, 0, 0}},
+			exifASCIIEntry(tagGPSLatitudeRef, latref),
+			exifRationalEntry(tagGPSLatitude, dms(m.GPS.Latitude)...),
+			exifASCIIEntry(tagGPSLongitudeRef, lonref),
+			exifRationalEntry(tagGPSLongitude, dms(m.GPS.Longitude)...),
+			{tag: tagGPSAltitudeRef, typ: exifByte, count: 1, value: []byte{altref}},
+			exifRationalEntry(tagGPSAltitude, math.Abs(m.GPS.Altitude)),
+		}
+	}
+	if len(ifd0) == 0 && len(exififd) == 0 && len(gpsifd) == 0 {
+		return nil
+	}
+	// The pointers to the sub IFDs are inline values, so they don't change
+	// the size of IFD0.
+	if len(exififd) > 0 {
+		ifd0 = append(ifd0, exifLongEntry(tagExifIFD, 0))
+	}
+	if len(gpsifd) > 0 {
+		ifd0 = append(ifd0, exifLongEntry(tagGPSIFD, 0))
+	}
+	// An empty sub IFD is not written.
+	exifOffset := 8 + ifd0.size()
+	gpsOffset := exifOffset
+	if len(exififd) > 0 {
+		gpsOffset += exififd.size()
+	}
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case tagExifIFD:
+			ifd0[i] = exifLongEntry(tagExifIFD, uint32(exifOffset))
+		case tagGPSIFD:
+			ifd0[i] = exifLongEntry(tagGPSIFD, uint32(gpsOffset))
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("II")
+	binary.Write(&buf, binary.LittleEndian, uint16(42))
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+	ifd0.write(&buf, 8)
+	if len(exififd) > 0 {
+		exififd.write(&buf, exifOffset)
+	}
+	if len(gpsifd) > 0 {
+		gpsifd.write(&buf, gpsOffset)
+	}
+	return buf.Bytes()
+}
+
+// xmpNamespace is the XMP namespace of the measurement parameters
+const xmpNamespace = "https://github.com/weisskopfjens/goconvertis2/ns/1.0/"
+
+// xmp returns the XMP packet with the measurement parameters
+func (m *Metadata) xmp() []byte {
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	fmt.Fprintf(&b, "  <rdf:Description rdf:about=\"\" xmlns:is2=\"%s\"\n", xmpNamespace)
+	fmt.Fprintf(&b, "   is2:Emissivity=\"%g\"\n", m.Emission)
+	fmt.Fprintf(&b, "   is2:BackgroundTemperature=\"%g\"\n", m.Background)
+	fmt.Fprintf(&b, "   is2:ScaleMin=\"%.2f\"\n", m.ScaleMin)
+	fmt.Fprintf(&b, "   is2:ScaleMax=\"%.2f\"\n", m.ScaleMax)
+	fmt.Fprintf(&b, "   is2:Palette=\"%s\">\n", xmlEscape(m.Palette))
+	if len(m.Spots) > 0 {
+		b.WriteString("   <is2:Spots>\n    <rdf:Seq>\n")
+		for _, s := range m.Spots {
+			fmt.Fprintf(&b, "     <rdf:li rdf:parseType=\"Resource\"><is2:Name>%s</is2:Name><is2:X>%d</is2:X><is2:Y>%d</is2:Y><is2:Temperature>%.2f</is2:Temperature></rdf:li>\n",
+				xmlEscape(s.Name), s.X, s.Y, s.Temperature)
+		}
+		b.WriteString("    </rdf:Seq>\n   </is2:Spots>\n")
+	}
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return []byte(b.String())
+}
+
+// xmlEscape escapes the special characters of XML
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		switch r {
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '&':
+			b.WriteString("&amp;")
+		case '"':
+			b.WriteString("&quot;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// jpegInsert returns the position after the SOI marker and an optional JFIF
+// segment of a jpeg file, where segments are inserted
+func jpegInsert(data []byte) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, fmt.Errorf("Not a jpeg file.")
+	}
+	if data[2] != 0xFF || data[3] != 0xE0 {
+		return 2, nil
+	}
+	if len(data) < 6 {
+		return 0, fmt.Errorf("Truncated JFIF segment.")
+	}
+	size := int(binary.BigEndian.Uint16(data[4:]))
+	if size < 2 || 4+size > len(data) {
+		return 0, fmt.Errorf("Truncated JFIF segment.")
+	}
+	return 4 + size, nil
+}
+
+// embedJPEG inserts the EXIF and XMP segments of the metadata after the
+// SOI marker and an optional JFIF segment. An existing EXIF segment of the
+// data is kept.
+func embedJPEG(data []byte, m *Metadata) ([]byte, error) {
+	p, err := jpegInsert(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:p])
+	if jpegSegment(data, 0xE1, []byte("Exif\x00\x00")) == nil {
+		if exif := m.exif(); exif != nil {
+			writeJPEGSegment(&buf, 0xE1, append([]byte("Exif\x00\x00"), exif...))
+		}
+	}
+	writeJPEGSegment(&buf, 0xE1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), m.xmp()...))
+	buf.Write(data[p:])
+	return buf.Bytes(), nil
+}
+
+// writeJPEGSegment writes a marker segment with payload
+func writeJPEGSegment(buf *bytes.Buffer, marker byte, payload []byte) {
+	buf.Write([]byte{0xFF, marker})
+	binary.Write(buf, binary.BigEndian, uint16(len(payload)+2))
+	buf.Write(payload)
+}
+
+// embedPNG inserts an eXIf and an iTXt chunk with the metadata after the
+// IHDR chunk
+func embedPNG(data []byte, m *Metadata) ([]byte, error) {
+	// signature (8) + IHDR chunk (4 length + 4 type + 13 data + 4 crc)
+	const ihdrEnd = 8 + 25
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, fmt.Errorf("Not a png file.")
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:ihdrEnd])
+	if exif := m.exif(); exif != nil {
+		writePNGChunk(&buf, "eXIf", exif)
+	}
+	// keyword, null separator, compression flag, compression method,
+	// empty language tag and translated keyword
+	itxt := append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), m.xmp()...)
+	writePNGChunk(&buf, "iTXt", itxt)
+	buf.Write(data[ihdrEnd:])
+	return buf.Bytes(), nil
+}
+
+// writePNGChunk writes a png chunk with its checksum
+func writePNGChunk(buf *bytes.Buffer, typ string, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	buf.WriteString(typ)
+	buf.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
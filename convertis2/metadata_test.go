@@ -0,0 +1,134 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEXIFRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		meta Metadata
+	}{
+		{"empty", Metadata{}},
+		{"camera without time", Metadata{Make: "InfraTec", Model: "VarioCAM", Serial: "1234"}},
+		{"capture", Metadata{Make: "Fluke", Model: "Ti401", DateTimeOriginal: time.Date(2024, 3, 1, 10, 30, 15, 0, time.Local)}},
+		{"south west", Metadata{GPS: &GPS{Latitude: -33.8568, Longitude: -151.2153, Altitude: 12}}},
+		{"north east", Metadata{GPS: &GPS{Latitude: 48.1372, Longitude: 11.5756, Altitude: 519}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := embedJPEG(buf.Bytes(), &tt.meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+				t.Fatalf("jpeg with metadata can't be decoded. %v", err)
+			}
+			got, err := readEXIF(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Make != tt.meta.Make || got.Model != tt.meta.Model || got.Serial != tt.meta.Serial {
+				t.Errorf("camera %q %q %q, want %q %q %q", got.Make, got.Model, got.Serial, tt.meta.Make, tt.meta.Model, tt.meta.Serial)
+			}
+			if !got.DateTimeOriginal.Equal(tt.meta.DateTimeOriginal) {
+				t.Errorf("captured %v, want %v", got.DateTimeOriginal, tt.meta.DateTimeOriginal)
+			}
+			if (got.GPS == nil) != (tt.meta.GPS == nil) {
+				t.Fatalf("GPS %v, want %v", got.GPS, tt.meta.GPS)
+			}
+			if g, w := got.GPS, tt.meta.GPS; g != nil {
+				if math.Abs(g.Latitude-w.Latitude) > 1e-5 || math.Abs(g.Longitude-w.Longitude) > 1e-5 || math.Abs(g.Altitude-w.Altitude) > 1e-2 {
+					t.Errorf("GPS %+v, want %+v", *g, *w)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedJPEGTruncated(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no jpeg", []byte("GIF89a")},
+		{"JFIF marker only", []byte{0xFF, 0xD8, 0xFF, 0xE0}},
+		{"JFIF size only", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00}},
+		{"JFIF segment beyond the data", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F'}},
+		{"JFIF size below 2", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x01, 0xFF, 0xD9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := embedJPEG(tt.data, &Metadata{Make: "Fluke"})
+			if err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+func TestXMP(t *testing.T) {
+	m := &Metadata{Emission: 0.93, Background: 21.5, ScaleMin: 10, ScaleMax: 60, Palette: "iron<&>", Spots: []Spot{{Name: "max \"hot\"", X: 3, Y: 4, Temperature: 55.126}}}
+	xmp := string(m.xmp())
+	for _, want := range []string{
+		`is2:Emissivity="0.93"`,
+		`is2:BackgroundTemperature="21.5"`,
+		`is2:ScaleMax="60.00"`,
+		`is2:Palette="iron&lt;&amp;&gt;"`,
+		`<is2:Name>max &quot;hot&quot;</is2:Name><is2:X>3</is2:X><is2:Y>4</is2:Y><is2:Temperature>55.13</is2:Temperature>`,
+	} {
+		if !strings.Contains(xmp, want) {
+			t.Errorf("XMP without %s:\n%s", want, xmp)
+		}
+	}
+}
+
+func TestEmbedPNG(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := embedPNG(buf.Bytes(), &Metadata{Model: "VarioCAM", Palette: "iron"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("png with metadata can't be decoded. %v", err)
+	}
+	for _, chunk := range []string{"eXIf", "iTXt"} {
+		if !bytes.Contains(data, []byte(chunk)) {
+			t.Errorf("no %s chunk", chunk)
+		}
+	}
+	_, err = embedPNG([]byte("no png"), &Metadata{})
+	if err == nil {
+		t.Error("embedded into no png")
+	}
+}
+
+func TestOldIS2NoCaptureTime(t *testing.T) {
+	frame, err := Decode(writeTestFile(t, "old.IS2", testOldIS2(testRaw(1320, 2093))), Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Metadata == nil || !frame.Metadata.DateTimeOriginal.IsZero() {
+		t.Errorf("old format metadata %+v, want no capture time", frame.Metadata)
+	}
+}
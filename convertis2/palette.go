@@ -0,0 +1,121 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"image/color"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Names of the built in palettes
+const (
+	PaletteIron     = "iron"
+	PaletteRainbow  = "rainbow"
+	PaletteGray     = "gray"
+	PaletteBlackHot = "blackhot"
+	// PaletteDiverging runs from blue over white to red, for deltas
+	PaletteDiverging = "diverging"
+)
+
+// palettes is the registry of the palettes by name
+var palettes = struct {
+	sync.RWMutex
+	colors map[string][]color.RGBA
+}{colors: map[string][]color.RGBA{}}
+
+func init() {
+	RegisterPalette(PaletteIron, parsePalette(ironpalette))
+	RegisterPalette(PaletteRainbow, rainbowPalette(433))
+	gray := make([]color.RGBA, 256)
+	blackhot := make([]color.RGBA, 256)
+	for i := range gray {
+		gray[i] = color.RGBA{uint8(i), uint8(i), uint8(i), 255}
+		blackhot[255-i] = gray[i]
+	}
+	RegisterPalette(PaletteGray, gray)
+	RegisterPalette(PaletteBlackHot, blackhot)
+	RegisterPalette(PaletteDiverging, divergingPalette(257))
+}
+
+// RegisterPalette adds a palette under name. The colors run from cold to
+// hot. A palette of the same name is replaced.
+func RegisterPalette(name string, colors []color.RGBA) {
+	palettes.Lock()
+	defer palettes.Unlock()
+	palettes.colors[name] = colors
+}
+
+// Palette returns the colors of the palette name, nil if it is unknown
+func Palette(name string) []color.RGBA {
+	palettes.RLock()
+	defer palettes.RUnlock()
+	return palettes.colors[name]
+}
+
+// PaletteNames returns the names of the registered palettes in order
+func PaletteNames() []string {
+	palettes.RLock()
+	defer palettes.RUnlock()
+	var names []string
+	for name := range palettes.colors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parsePalette parses the #RRGGBB colors of a palette
+func parsePalette(palette []string) []color.RGBA {
+	colors := make([]color.RGBA, len(palette))
+	for i, c := range palette {
+		r, g, b := HTMLColorToRGB(c)
+		colors[i] = color.RGBA{r, g, b, 255}
+	}
+	return colors
+}
+
+// rainbowPalette runs through the hues from blue to red
+func rainbowPalette(n int) []color.RGBA {
+	colors := make([]color.RGBA, n)
+	for i := range colors {
+		h := 240 * (1 - float64(i)/float64(n-1))
+		x := 1 - math.Abs(math.Mod(h/60, 2)-1)
+		var r, g, b float64
+		switch {
+		case h < 60:
+			r, g = 1, x
+		case h < 120:
+			r, g = x, 1
+		case h < 180:
+			g, b = 1, x
+		default:
+			g, b = x, 1
+		}
+		colors[i] = color.RGBA{uint8(math.Round(r * 255)), uint8(math.Round(g * 255)), uint8(math.Round(b * 255)), 255}
+	}
+	return colors
+}
+
+// divergingPalette runs from blue over white in the middle to red
+func divergingPalette(n int) []color.RGBA {
+	blue := [3]float64{33, 102, 172}
+	red := [3]float64{178, 24, 43}
+	colors := make([]color.RGBA, n)
+	for i := range colors {
+		f := 2*float64(i)/float64(n-1) - 1
+		end := red
+		if f < 0 {
+			end, f = blue, -f
+		}
+		var c [3]uint8
+		for j := range c {
+			c[j] = uint8(math.Round(255 + (end[j]-255)*f))
+		}
+		colors[i] = color.RGBA{c[0], c[1], c[2], 255}
+	}
+	return colors
+}
@@ -0,0 +1,482 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Planck constants of the radiometric jpeg output. The IS2 raw values are
+// calibrated with the Stefan Boltzmann Law, so the apparent temperatures
+// are mapped onto the Planck curve of these constants. Thermal software
+// then reads the same temperatures as this converter. The constants cover
+// -40 °C up to 600 °C within the 16 bit raw values.
+const (
+	planckR1 = 3435.0
+	planckR2 = 0.0125
+	planckB  = 1501.0
+	planckF  = 1.0
+	planckO  = 0.0
+)
+
+// FLIR record types
+const (
+	flirRawData    = 0x01
+	flirCameraInfo = 0x20
+)
+
+// flirSegmentSize is the maximum payload of a FLIR APP1 segment without
+// the 8 byte FLIR header
+const flirSegmentSize = 65533 - 8
+
+// Radiometric is the content of a FLIR radiometric jpeg
+type Radiometric struct {
+	Width  int
+	Height int
+	// Raw values of the thermal image, row by row
+	Raw []uint16
+	// Planck constants of the camera
+	R1, R2, B, F, O float64
+	// Emissivity and the reflected temperature in degree celsius
+	Emissivity           float64
+	ReflectedTemperature float64
+	Model                string
+	Serial               string
+	DateTimeOriginal     time.Time
+}
+
+// planckRaw returns the raw value of the temperature t in degree celsius
+func (r *Radiometric) planckRaw(t float64) float64 {
+	return r.R1/(r.R2*(math.Exp(r.B/(t+273.15))-r.F)) - r.O
+}
+
+// planckTemperature returns the temperature in degree celsius of the raw
+// value s
+func (r *Radiometric) planckTemperature(s float64) float64 {
+	return r.B/math.Log(r.R1/(r.R2*(s+r.O))+r.F) - 273.15
+}
+
+// Temperature returns the temperature of the raw value at index i in
+// degree celsius, corrected with the emissivity and the reflected
+// temperature
+func (r *Radiometric) Temperature(i int) float64 {
+	return r.temperature(r.Raw[i], r.Emissivity, r.ReflectedTemperature)
+}
+
+// temperature returns the temperature of the raw value w in degree celsius
+// for the emissivity e and the reflected temperature
+func (r *Radiometric) temperature(w uint16, e float64, reflected float64) float64 {
+	s := float64(w)
+	if e > 0 && e < 1 {
+		s = (s - (1-e)*r.planckRaw(reflected)) / e
+	}
+	// A low emissivity with a high reflected temperature can leave no
+	// radiation of the object for cold pixels. They are clamped to absolute
+	// zero, the logarithm of the Planck curve is NaN below it.
+	return r.planckTemperature(max(s, -r.O))
+}
+
+// newRadiometric converts the frame into raw values of the Planck curve
+func newRadiometric(frame *Thermogram, opts Options, meta *Metadata) *Radiometric {
+	r := &Radiometric{
+		Width:                frame.Width,
+		Height:               frame.Height,
+		Raw:                  make([]uint16, len(frame.Raw)),
+		R1:                   planckR1,
+		R2:                   planckR2,
+		B:                    planckB,
+		F:                    planckF,
+		O:                    planckO,
+		Emissivity:           frame.Params.Emission,
+		ReflectedTemperature: frame.Params.Background,
+	}
+	if meta != nil {
+		r.Model = meta.Model
+		r.Serial = meta.Serial
+		r.DateTimeOriginal = meta.DateTimeOriginal
+	}
+	e, reflected := r.Emissivity, r.planckRaw(r.ReflectedTemperature)
+	for i := range frame.Raw {
+		s := r.planckRaw(frame.apparent(i))
+		if frame.EmissionMap != nil && frame.EmissionMap[i] != 0 {
+			// The raw value of a pixel with its own emission factor gives
+			// its temperature with the emissivity of the file.
+			s = e*r.planckRaw(frame.Temperatures[i]) + (1-e)*reflected
+		}
+		s = math.Round(s)
+		r.Raw[i] = uint16(math.Min(math.Max(s, 0), 65535))
+	}
+	return r
+}
+
+// fff returns the FLIR file format data with the raw data record and the
+// camera info record
+func (r *Radiometric) fff() []byte {
+	le := binary.LittleEndian
+	// raw data record, little endian 16 bit values after a 32 byte header
+	rawdata := make([]byte, 32+2*len(r.Raw))
+	le.PutUint16(rawdata[0:], 2)
+	le.PutUint16(rawdata[2:], uint16(r.Width))
+	le.PutUint16(rawdata[4:], uint16(r.Height))
+	for i, v := range r.Raw {
+		le.PutUint16(rawdata[32+2*i:], v)
+	}
+	// camera info record
+	info := make([]byte, 0x480)
+	float := func(offset int, v float64) {
+		le.PutUint32(info[offset:], math.Float32bits(float32(v)))
+	}
+	str := func(offset int, size int, s string) {
+		copy(info[offset:offset+size-1], s)
+	}
+	le.PutUint16(info[0x00:], 2)
+	float(0x20, r.Emissivity)
+	float(0x24, 1.0) // object distance
+	float(0x28, r.ReflectedTemperature+273.15)
+	float(0x2c, r.ReflectedTemperature+273.15) // atmospheric temperature
+	float(0x30, r.ReflectedTemperature+273.15) // IR window temperature
+	float(0x34, 1.0)                           // IR window transmission
+	float(0x3c, 0.5)                           // relative humidity
+	float(0x58, r.R1)
+	float(0x5c, r.B)
+	float(0x60, r.F)
+	float(0x70, 0.006569) // atmospheric transmission alpha 1
+	float(0x74, 0.01262)  // atmospheric transmission alpha 2
+	float(0x78, -0.002276)
+	float(0x7c, -0.00667)
+	float(0x80, 1.9)
+	float(0x90, 600+273.15)
+	float(0x94, -40+273.15)
+	str(0xd4, 32, r.Model)
+	str(0x104, 16, r.Serial)
+	str(0x114, 16, "goconvertis2")
+	le.PutUint32(info[0x308:], uint32(int32(r.O)))
+	float(0x30c, r.R2)
+	minraw, maxraw := uint16(65535), uint16(0)
+	for _, v := range r.Raw {
+		minraw = min(minraw, v)
+		maxraw = max(maxraw, v)
+	}
+	le.PutUint16(info[0x310:], minraw)
+	le.PutUint16(info[0x312:], maxraw)
+	le.PutUint16(info[0x338:], minraw+(maxraw-minraw)/2)
+	le.PutUint16(info[0x33c:], maxraw-minraw)
+	if !r.DateTimeOriginal.IsZero() {
+		_, zone := r.DateTimeOriginal.Zone()
+		le.PutUint32(info[0x384:], uint32(r.DateTimeOriginal.Unix()))
+		le.PutUint32(info[0x388:], uint32(r.DateTimeOriginal.Nanosecond()/1e6))
+		le.PutUint16(info[0x38c:], uint16(int16(-zone/60)))
+	}
+
+	// FFF header and record directory, big endian
+	be := binary.BigEndian
+	records := []struct {
+		typ     uint16
+		subtype uint16
+		data    []byte
+	}{
+		{flirRawData, 2, rawdata},
+		{flirCameraInfo, 1, info},
+	}
+	const headerSize = 0x40
+	const entrySize = 0x20
+	var buf bytes.Buffer
+	header := make([]byte, headerSize)
+	copy(header[0:], "FFF\x00")
+	copy(header[4:20], "goconvertis2")
+	be.PutUint32(header[0x14:], 100)
+	be.PutUint32(header[0x18:], headerSize)
+	be.PutUint32(header[0x1c:], uint32(len(records)))
+	be.PutUint32(header[0x20:], uint32(len(records)+1))
+	buf.Write(header)
+	offset := headerSize + entrySize*len(records)
+	for i, rec := range records {
+		entry := make([]byte, entrySize)
+		be.PutUint16(entry[0x00:], rec.typ)
+		be.PutUint16(entry[0x02:], rec.subtype)
+		be.PutUint32(entry[0x04:], 0x64)
+		be.PutUint32(entry[0x08:], uint32(i+1))
+		be.PutUint32(entry[0x0c:], uint32(offset))
+		be.PutUint32(entry[0x10:], uint32(len(rec.data)))
+		buf.Write(entry)
+		offset += len(rec.data)
+	}
+	for _, rec := range records {
+		buf.Write(rec.data)
+	}
+	return buf.Bytes()
+}
+
+// embedFLIR inserts the FFF data as FLIR APP1 segments after the SOI marker
+// and an optional JFIF segment of the jpeg data
+func embedFLIR(data []byte, fff []byte) ([]byte, error) {
+	p, err := jpegInsert(data)
+	if err != nil {
+		return nil, err
+	}
+	parts := (len(fff) + flirSegmentSize - 1) / flirSegmentSize
+	if parts > 256 {
+		return nil, fmt.Errorf("FLIR data too large.")
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:p])
+	for i := 0; i < parts; i++ {
+		chunk := fff[i*flirSegmentSize : min((i+1)*flirSegmentSize, len(fff))]
+		payload := append([]byte{'F', 'L', 'I', 'R', 0, 1, byte(i), byte(parts - 1)}, chunk...)
+		writeJPEGSegment(&buf, 0xE1, payload)
+	}
+	buf.Write(data[p:])
+	return buf.Bytes(), nil
+}
+
+// ReadRadiometricJPEG reads the raw thermal image and the camera info of a
+// FLIR radiometric jpeg
+func ReadRadiometricJPEG(data []byte) (*Radiometric, error) {
+	fff, err := flirData(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(fff) < 0x40 || !strings.HasPrefix(string(fff), "FFF\x00") {
+		return nil, fmt.Errorf("No FFF data in the FLIR segments.")
+	}
+	// The version of the header tells the byte order.
+	var order binary.ByteOrder = binary.BigEndian
+	if v := order.Uint32(fff[0x14:]); v < 100 || v >= 200 {
+		order = binary.LittleEndian
+		if v := order.Uint32(fff[0x14:]); v < 100 || v >= 200 {
+			return nil, fmt.Errorf("Unsupported FFF version.")
+		}
+	}
+	dir := int(order.Uint32(fff[0x18:]))
+	num := int(order.Uint32(fff[0x1c:]))
+	r := &Radiometric{R2: 1, F: 1, Emissivity: 1}
+	var found bool
+	for i := 0; i < num; i++ {
+		p := dir + i*0x20
+		if p+0x20 > len(fff) {
+			return nil, fmt.Errorf("FFF record directory truncated.")
+		}
+		typ := order.Uint16(fff[p:])
+		offset := int(order.Uint32(fff[p+0x0c:]))
+		length := int(order.Uint32(fff[p+0x10:]))
+		if offset < 0 || length < 0 || offset+length > len(fff) {
+			return nil, fmt.Errorf("FFF record %d out of range.", i)
+		}
+		rec := fff[offset : offset+length]
+		switch typ {
+		case flirRawData:
+			err = r.readRawData(rec)
+			found = err == nil
+		case flirCameraInfo:
+			err = r.readCameraInfo(rec)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("No raw thermal image in the FLIR data.")
+	}
+	return r, nil
+}
+
+// flirData returns the concatenated payload of the FLIR APP1 segments
+func flirData(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, fmt.Errorf("Not a jpeg file.")
+	}
+	type part struct {
+		index int
+		data  []byte
+	}
+	var parts []part
+	p := 2
+	for p+4 <= len(data) && data[p] == 0xFF {
+		m := data[p+1]
+		if m == 0xDA || m == 0xD9 {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[p+2:]))
+		if p+2+size > len(data) {
+			break
+		}
+		payload := data[p+4 : p+2+size]
+		if m == 0xE1 && len(payload) >= 8 && string(payload[:5]) == "FLIR\x00" {
+			parts = append(parts, part{int(payload[6]), payload[8:]})
+		}
+		p = p + 2 + size
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("No FLIR segments found.")
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].index < parts[j].index })
+	var fff []byte
+	for _, part := range parts {
+		fff = append(fff, part.data...)
+	}
+	return fff, nil
+}
+
+// recordOrder returns the byte order of a record. The first value of a
+// record is 2 in the byte order of the record.
+func recordOrder(rec []byte) binary.ByteOrder {
+	if binary.LittleEndian.Uint16(rec) == 2 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// readRawData reads a raw data record with 16 bit values
+func (r *Radiometric) readRawData(rec []byte) error {
+	if len(rec) < 32 {
+		return fmt.Errorf("FLIR raw data record too short.")
+	}
+	order := recordOrder(rec)
+	r.Width = int(order.Uint16(rec[2:]))
+	r.Height = int(order.Uint16(rec[4:]))
+	if r.Width <= 0 || r.Height <= 0 {
+		return fmt.Errorf("FLIR raw data has a bad size %dx%d.", r.Width, r.Height)
+	}
+	img := rec[32:]
+	if bytes.HasPrefix(img, []byte("\x89PNG")) {
+		return r.readRawPNG(img)
+	}
+	if len(img) != 2*r.Width*r.Height {
+		return fmt.Errorf("FLIR raw data of %d bytes doesn't match the size %dx%d.", len(img), r.Width, r.Height)
+	}
+	r.Raw = make([]uint16, r.Width*r.Height)
+	for i := range r.Raw {
+		r.Raw[i] = order.Uint16(img[2*i:])
+	}
+	return nil
+}
+
+// readRawPNG reads png compressed raw data. The cameras store the 16 bit
+// values little endian in the big endian png, so the bytes are swapped.
+func (r *Radiometric) readRawPNG(data []byte) error {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("Can't decode FLIR raw data. %w", err)
+	}
+	gray, ok := img.(*image.Gray16)
+	if !ok {
+		return fmt.Errorf("FLIR raw data is not a 16 bit gray png.")
+	}
+	b := gray.Bounds()
+	if b.Dx() != r.Width || b.Dy() != r.Height {
+		return fmt.Errorf("FLIR raw data png has the size %dx%d instead of %dx%d.", b.Dx(), b.Dy(), r.Width, r.Height)
+	}
+	r.Raw = make([]uint16, r.Width*r.Height)
+	for y := 0; y < r.Height; y++ {
+		for x := 0; x < r.Width; x++ {
+			v := gray.Gray16At(b.Min.X+x, b.Min.Y+y).Y
+			r.Raw[y*r.Width+x] = v<<8 | v>>8
+		}
+	}
+	return nil
+}
+
+// readCameraInfo reads the Planck constants and the object parameters of a
+// camera info record
+func (r *Radiometric) readCameraInfo(rec []byte) error {
+	if len(rec) < 0x390 {
+		return fmt.Errorf("FLIR camera info record too short.")
+	}
+	order := recordOrder(rec)
+	float := func(offset int) float64 {
+		return float64(math.Float32frombits(order.Uint32(rec[offset:])))
+	}
+	str := func(offset int, size int) string {
+		return strings.TrimRight(string(rec[offset:offset+size]), "\x00")
+	}
+	r.Emissivity = float(0x20)
+	r.ReflectedTemperature = float(0x28) - 273.15
+	r.R1 = float(0x58)
+	r.B = float(0x5c)
+	r.F = float(0x60)
+	r.O = float64(int32(order.Uint32(rec[0x308:])))
+	r.R2 = float(0x30c)
+	r.Model = str(0xd4, 32)
+	r.Serial = str(0x104, 16)
+	if sec := order.Uint32(rec[0x384:]); sec != 0 {
+		ms := order.Uint32(rec[0x388:])
+		r.DateTimeOriginal = time.Unix(int64(sec), int64(ms)*1e6)
+	}
+	return nil
+}
+
+// writeRadiometricJPEG writes the frame as FLIR radiometric jpeg
+func writeRadiometricJPEG(frame *Thermogram, filename string, opts Options, meta *Metadata) error {
+	r := newRadiometric(frame, opts, meta)
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, renderField(frame, opts), &jpeg.Options{Quality: opts.quality()})
+	if err != nil {
+		return err
+	}
+	data, err := embedFLIR(buf.Bytes(), r.fff())
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		data, err = embedJPEG(data, meta)
+		if err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filename, data, 0666)
+}
+
+// flirDecoder decodes FLIR radiometric jpeg files
+type flirDecoder struct{}
+
+// Name returns the name of the format
+func (flirDecoder) Name() string {
+	return "flir"
+}
+
+// Decode decodes a FLIR radiometric jpeg. The emission factor and the
+// background temperature of p replace the values stored by the camera.
+// The reflected temperature is the background temperature.
+func (flirDecoder) Decode(filename string, p Params, logger *log.Logger) (*Thermogram, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := flirData(data); err != nil {
+		return nil, ErrFormat
+	}
+	r, err := ReadRadiometricJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	convert := func(w uint16, p Params) float64 {
+		return r.temperature(w, p.Emission, p.Background)
+	}
+	stored := &Params{Background: r.ReflectedTemperature, Emission: r.Emissivity}
+	frame := newThermogram("flir", r.Width, r.Height, r.Raw, p.resolve(stored), convert)
+	frame.StoredParams = stored
+	// The jpeg of the file is the rendered thermal image, the visual picture
+	// of the camera is not read.
+	frame.Metadata = &Metadata{Model: r.Model, Serial: r.Serial, DateTimeOriginal: r.DateTimeOriginal}
+	if exif, err := readEXIF(data); err == nil {
+		if !exif.DateTimeOriginal.IsZero() {
+			frame.Metadata.DateTimeOriginal = exif.DateTimeOriginal
+		}
+		frame.Metadata.Make = exif.Make
+		frame.Metadata.GPS = exif.GPS
+	}
+	return frame, nil
+}
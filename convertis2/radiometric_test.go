@@ -0,0 +1,218 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testFrame returns the thermogram of the old format test file
+func testFrame(tb testing.TB, p Params) *Thermogram {
+	frame, err := readIRFrame(bytes.NewReader(testOldIS2(testRaw(1320, 2093))), 120+15828, FormatOldIS2, oldIS2Gain, oldIS2Bias, p)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return frame
+}
+
+func TestRadiometricJPEGRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		params Params
+		rois   []ROI
+	}{
+		{"default", DefaultParams, nil},
+		{"emission 0.8", Params{Background: 10, Emission: 0.8}, nil},
+		{"emission map", DefaultParams, []ROI{{Name: "copper", X: 180, Y: 70, Width: 40, Height: 40, Emission: 0.3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := testFrame(t, tt.params)
+			frame.ROIs = tt.rois
+			frame.SetEmissionMask(nil)
+			meta := &Metadata{Model: "VarioCAM", Serial: "1234", DateTimeOriginal: time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)}
+			filename := filepath.Join(t.TempDir(), "r.jpg")
+			err := writeRadiometricJPEG(frame, filename, Options{}, meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := ReadRadiometricJPEG(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Width != frame.Width || r.Height != frame.Height {
+				t.Fatalf("size %dx%d, want %dx%d", r.Width, r.Height, frame.Width, frame.Height)
+			}
+			if r.Model != meta.Model || r.Serial != meta.Serial || !r.DateTimeOriginal.Equal(meta.DateTimeOriginal) {
+				t.Errorf("camera info %s %s %v, want %s %s %v", r.Model, r.Serial, r.DateTimeOriginal, meta.Model, meta.Serial, meta.DateTimeOriginal)
+			}
+			if math.Abs(r.Emissivity-tt.params.Emission) > 1e-6 || math.Abs(r.ReflectedTemperature-tt.params.Background) > 1e-3 {
+				t.Errorf("object parameters %.2f %.2f, want %.2f %.2f", r.Emissivity, r.ReflectedTemperature, tt.params.Emission, tt.params.Background)
+			}
+			// The raw values are the apparent temperatures, the emission
+			// correction of the Planck curve differs from the one of the IS2
+			// files. Pixels of the emission map store their temperature for
+			// the emissivity of the file.
+			for i := range frame.Temperatures {
+				want, got := frame.apparent(i), r.temperature(r.Raw[i], 1, r.ReflectedTemperature)
+				if frame.EmissionMap != nil && frame.EmissionMap[i] != 0 {
+					want, got = frame.Temperatures[i], r.Temperature(i)
+				}
+				if math.Abs(got-want) > 0.1 {
+					t.Fatalf("pixel %d: %.2f °C, want %.2f °C", i, got, want)
+				}
+			}
+			// The jpeg is the rendered picture of the frame.
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds() != image.Rect(0, 0, frame.Width, frame.Height) {
+				t.Errorf("jpeg bounds %v", img.Bounds())
+			}
+		})
+	}
+}
+
+func TestReadRadiometricJPEGBadSize(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := testFrame(t, DefaultParams)
+	tests := []struct {
+		name          string
+		width, height int
+	}{
+		{"zero width", 0, 240},
+		{"zero height", 320, 0},
+		{"too small", 100, 240},
+		{"too large", 320, 241},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRadiometric(frame, Options{}, nil)
+			r.Width, r.Height = tt.width, tt.height
+			data, err := embedFLIR(buf.Bytes(), r.fff())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ReadRadiometricJPEG(data)
+			if err == nil {
+				t.Errorf("size %dx%d read", tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestEmbedFLIRTruncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{0xFF, 0xD8},
+		{0xFF, 0xD8, 0xFF, 0xE0},
+		{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F'},
+	} {
+		_, err := embedFLIR(data, []byte("FFF\x00"))
+		if err == nil {
+			t.Errorf("% x embedded", data)
+		}
+	}
+}
+
+func TestFLIRDecoder(t *testing.T) {
+	frame := testFrame(t, Params{Background: 10, Emission: 0.8})
+	meta := &Metadata{Model: "VarioCAM", Serial: "1234"}
+	filename := filepath.Join(t.TempDir(), "flir.jpg")
+	err := writeRadiometricJPEG(frame, filename, Options{}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		params Params
+		want   Params
+	}{
+		{"stored parameters", Params{}, Params{Background: 10, Emission: 0.8}},
+		{"own parameters", Params{Background: 25, Emission: 0.95}, Params{Background: 25, Emission: 0.95}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flir, err := Decode(filename, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flir.Format != "flir" || flir.Width != frame.Width || flir.Height != frame.Height {
+				t.Fatalf("%s %dx%d, want flir %dx%d", flir.Format, flir.Width, flir.Height, frame.Width, frame.Height)
+			}
+			if math.Abs(flir.Params.Emission-tt.want.Emission) > 1e-6 || math.Abs(flir.Params.Background-tt.want.Background) > 1e-3 {
+				t.Errorf("params %+v, want %+v", flir.Params, tt.want)
+			}
+			if flir.StoredParams == nil || math.Abs(flir.StoredParams.Emission-0.8) > 1e-6 {
+				t.Errorf("stored params %+v, want the emission 0.8", flir.StoredParams)
+			}
+			if flir.Metadata.Model != meta.Model || flir.Metadata.Serial != meta.Serial {
+				t.Errorf("camera %s %s, want %s %s", flir.Metadata.Model, flir.Metadata.Serial, meta.Model, meta.Serial)
+			}
+			if flir.MaxX != frame.MaxX || flir.MaxY != frame.MaxY {
+				t.Errorf("hottest pixel at %d,%d, want %d,%d", flir.MaxX, flir.MaxY, frame.MaxX, frame.MaxY)
+			}
+			// The raw values hold the apparent temperatures of the frame.
+			i := frame.MaxY*frame.Width + frame.MaxX
+			got := flir.convert(flir.Raw[i], Params{Background: tt.params.Background, Emission: 1})
+			if want := frame.apparent(i); math.Abs(got-want) > 0.1 {
+				t.Errorf("apparent max %.2f °C, want %.2f °C", got, want)
+			}
+		})
+	}
+}
+
+func TestFLIRDecoderNoRadiation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "flir.jpg")
+	err := writeRadiometricJPEG(testFrame(t, DefaultParams), filename, Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reflected radiation exceeds the radiation of the cold pixels.
+	flir, err := DecodeLog(filename, Params{Background: 150, Emission: 0.1}, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range flir.Temperatures {
+		if math.IsNaN(v) || v < -273.15 {
+			t.Fatalf("pixel %d: %v °C", i, v)
+		}
+	}
+	if flir.Min() != -273.15 {
+		t.Errorf("min %.2f °C, want absolute zero", flir.Min())
+	}
+	_, err = renderIR(flir, nil, Options{Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFLIRDecoderPlainJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = flirDecoder{}.Decode(writeTestFile(t, "plain.jpg", buf.Bytes()), Params{}, discard)
+	if !errors.Is(err, ErrFormat) {
+		t.Errorf("error %v, want ErrFormat", err)
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// fluke hot iron palette
+var ironpalette = []string{"#00000a", "#000014", "#00001e", "#000025", "#00002a", "#00002e", "#000032", "#000036", "#00003a", "#00003e", "#000042", "#000046", "#00004a", "#00004f", "#000052", "#010055", "#010057", "#020059", "#02005c", "#03005e", "#040061", "#040063", "#050065", "#060067", "#070069", "#08006b", "#09006e", "#0a0070", "#0b0073", "#0c0074", "#0d0075", "#0d0076", "#0e0077", "#100078", "#120079", "#13007b", "#15007c", "#17007d", "#19007e", "#1b0080", "#1c0081", "#1e0083", "#200084", "#220085", "#240086", "#260087", "#280089", "#2a0089", "#2c008a", "#2e008b", "#30008c", "#32008d", "#34008e", "#36008e", "#38008f", "#390090", "#3b0091", "#3c0092", "#3e0093", "#3f0093", "#410094", "#420095", "#440095", "#450096", "#470096", "#490096", "#4a0096", "#4c0097", "#4e0097", "#4f0097", "#510097", "#520098", "#540098", "#560098", "#580099", "#5a0099", "#5c0099", "#5d009a", "#5f009a", "#61009b", "#63009b", "#64009b", "#66009b", "#68009b", "#6a009b", "#6c009c", "#6d009c", "#6f009c", "#70009c", "#71009d", "#73009d", "#75009d", "#77009d", "#78009d", "#7a009d", "#7c009d", "#7e009d", "#7f009d", "#81009d", "#83009d", "#84009d", "#86009d", "#87009d", "#89009d", "#8a009d", "#8b009d", "#8d009d", "#8f009c", "#91009c", "#93009c", "#95009c", "#96009b", "#98009b", "#99009b", "#9b009b", "#9c009b", "#9d009b", "#9f009b", "#a0009b", "#a2009b", "#a3009b", "#a4009b", "#a6009a", "#a7009a", "#a8009a", "#a90099", "#aa0099", "#ab0099", "#ad0099", "#ae0198", "#af0198", "#b00198", "#b00198", "#b10197", "#b20197", "#b30196", "#b40296", "#b50295", "#b60295", "#b70395", "#b80395", "#b90495", "#ba0495", "#ba0494", "#bb0593", "#bc0593", "#bd0593", "#be0692", "#bf0692", "#bf0692", "#c00791", "#c00791", "#c10890", "#c10990", "#c20a8f", "#c30a8e", "#c30b8e", "#c40c8d", "#c50c8c", "#c60d8b", "#c60e8a", "#c70f89", "#c81088", "#c91187", "#ca1286", "#ca1385", "#cb1385", "#cb1484", "#cc1582", "#cd1681", "#ce1780", "#ce187e", "#cf187c", "#cf197b", "#d01a79", "#d11b78", "#d11c76", "#d21c75", "#d21d74", "#d31e72", "#d32071", "#d4216f", "#d4226e", "#d5236b", "#d52469", "#d62567", "#d72665", "#d82764", "#d82862", "#d92a60", "#da2b5e", "#da2c5c", "#db2e5a", "#db2f57", "#dc2f54", "#dd3051", "#dd314e", "#de324a", "#de3347", "#df3444", "#df3541", "#df363d", "#e0373a", "#e03837", "#e03933", "#e13a30", "#e23b2d", "#e23c2a", "#e33d26", "#e33e23", "#e43f20", "#e4411d", "#e4421c", "#e5431b", "#e54419", "#e54518", "#e64616", "#e74715", "#e74814", "#e74913", "#e84a12", "#e84c10", "#e84c0f", "#e94d0e", "#e94d0d", "#ea4e0c", "#ea4f0c", "#eb500b", "#eb510a", "#eb520a", "#eb5309", "#ec5409", "#ec5608", "#ec5708", "#ec5808", "#ed5907", "#ed5a07", "#ed5b06", "#ee5c06", "#ee5c05", "#ee5d05", "#ee5e05", "#ef5f04", "#ef6004", "#ef6104", "#ef6204", "#f06303", "#f06403", "#f06503", "#f16603", "#f16603", "#f16703", "#f16803", "#f16902", "#f16a02", "#f16b02", "#f16b02", "#f26c01", "#f26d01", "#f26e01", "#f36f01", "#f37001", "#f37101", "#f37201", "#f47300", "#f47400", "#f47500", "#f47600", "#f47700", "#f47800", "#f47a00", "#f57b00", "#f57c00", "#f57e00", "#f57f00", "#f68000", "#f68100", "#f68200", "#f78300", "#f78400", "#f78500", "#f78600", "#f88700", "#f88800", "#f88800", "#f88900", "#f88a00", "#f88b00", "#f88c00", "#f98d00", "#f98d00", "#f98e00", "#f98f00", "#f99000", "#f99100", "#f99200", "#f99300", "#fa9400", "#fa9500", "#fa9600", "#fb9800", "#fb9900", "#fb9a00", "#fb9c00", "#fc9d00", "#fc9f00", "#fca000", "#fca100", "#fda200", "#fda300", "#fda400", "#fda600", "#fda700", "#fda800", "#fdaa00", "#fdab00", "#fdac00", "#fdad00", "#fdae00", "#feaf00", "#feb000", "#feb100", "#feb200", "#feb300", "#feb400", "#feb500", "#feb600", "#feb800", "#feb900", "#feb900", "#feba00", "#febb00", "#febc00", "#febd00", "#febe00", "#fec000", "#fec100", "#fec200", "#fec300", "#fec400", "#fec500", "#fec600", "#fec700", "#fec800", "#fec901", "#feca01", "#feca01", "#fecb01", "#fecc02", "#fecd02", "#fece03", "#fecf04", "#fecf04", "#fed005", "#fed106", "#fed308", "#fed409", "#fed50a", "#fed60a", "#fed70b", "#fed80c", "#fed90d", "#ffda0e", "#ffda0e", "#ffdb10", "#ffdc12", "#ffdc14", "#ffdd16", "#ffde19", "#ffde1b", "#ffdf1e", "#ffe020", "#ffe122", "#ffe224", "#ffe226", "#ffe328", "#ffe42b", "#ffe42e", "#ffe531", "#ffe635", "#ffe638", "#ffe73c", "#ffe83f", "#ffe943", "#ffea46", "#ffeb49", "#ffeb4d", "#ffec50", "#ffed54", "#ffee57", "#ffee5b", "#ffee5f", "#ffef63", "#ffef67", "#fff06a", "#fff06e", "#fff172", "#fff177", "#fff17b", "#fff280", "#fff285", "#fff28a", "#fff38e", "#fff492", "#fff496", "#fff49a", "#fff59e", "#fff5a2", "#fff5a6", "#fff6aa", "#fff6af", "#fff7b3", "#fff7b6", "#fff8ba", "#fff8bd", "#fff8c1", "#fff8c4", "#fff9c7", "#fff9ca", "#fff9cd", "#fffad1", "#fffad4", "#fffbd8", "#fffcdb", "#fffcdf", "#fffde2", "#fffde5", "#fffde8", "#fffeeb", "#fffeee", "#fffef1", "#fffef4", "#fffff6"}
+
+// Interpolation methods for upscaling the infrared picture
+const (
+	InterpolationNearest  = "nearest"
+	InterpolationBilinear = "bilinear"
+	InterpolationBicubic  = "bicubic"
+)
+
+// sample returns the temperature at the subpixel position x, y
+func (f *Thermogram) sample(x float64, y float64, interpolation string) float64 {
+	switch interpolation {
+	case InterpolationBilinear:
+		x0, y0 := math.Floor(x), math.Floor(y)
+		dx, dy := x-x0, y-y0
+		ix, iy := int(x0), int(y0)
+		t0 := f.At(ix, iy)*(1-dx) + f.At(ix+1, iy)*dx
+		t1 := f.At(ix, iy+1)*(1-dx) + f.At(ix+1, iy+1)*dx
+		return t0*(1-dy) + t1*dy
+	case InterpolationBicubic:
+		x0, y0 := math.Floor(x), math.Floor(y)
+		dx, dy := x-x0, y-y0
+		ix, iy := int(x0), int(y0)
+		var rows [4]float64
+		for j := -1; j <= 2; j++ {
+			rows[j+1] = cubic(f.At(ix-1, iy+j), f.At(ix, iy+j), f.At(ix+1, iy+j), f.At(ix+2, iy+j), dx)
+		}
+		return cubic(rows[0], rows[1], rows[2], rows[3], dy)
+	default:
+		return f.At(int(math.Round(x)), int(math.Round(y)))
+	}
+}
+
+// cubic interpolates between p1 and p2 with a Catmull-Rom spline
+func cubic(p0 float64, p1 float64, p2 float64, p3 float64, t float64) float64 {
+	return p1 + 0.5*t*(p2-p0+t*(2*p0-5*p1+4*p2-p3+t*(3*(p1-p2)+p3-p0)))
+}
+
+// validInterpolation reports whether name is a known interpolation method
+func validInterpolation(name string) bool {
+	switch name {
+	case "", InterpolationNearest, InterpolationBilinear, InterpolationBicubic:
+		return true
+	}
+	return false
+}
+
+// colorscale maps temperatures to the colors of the colortable
+type colorscale struct {
+	min    float64
+	max    float64
+	colors []color.RGBA
+	// value maps a temperature to the value of the scale, nil for the
+	// temperature itself
+	value func(float64) float64
+	// unit and the format of the ticks of the drawn scale
+	unit  string
+	ticks string
+}
+
+// newColorscale returns the manual scale of opts or the automatic scale
+// from the min and max temperature of the frame. The building modes have
+// their own scale.
+func newColorscale(frame *Thermogram, opts Options) colorscale {
+	cs := colorscale{min: frame.Min(), max: frame.Max(), colors: Palette(opts.palette()), unit: "°C", ticks: "%.0f"}
+	if opts.manualScale() {
+		cs.min, cs.max = opts.MinTemp, opts.MaxTemp
+	}
+	if frame.Format == FormatDiff {
+		cs.unit, cs.ticks = "K", "%.1f"
+	}
+	if opts.Climate != nil {
+		cs = modeScale(frame, opts, cs)
+	}
+	return cs
+}
+
+// color returns the color of the temperature t
+func (c colorscale) color(t float64) (uint8, uint8, uint8) {
+	if c.value != nil {
+		t = c.value(t)
+	}
+	if math.IsNaN(t) {
+		// An undefined temperature must not index the colors.
+		t = c.min
+	}
+	n := len(c.colors)
+	if c.max <= c.min {
+		// A scale without a range, e.g. of a uniform picture, has the
+		// middle color.
+		pc := c.colors[n/2]
+		return pc.R, pc.G, pc.B
+	}
+	colorstep := float64(n) / (c.max - c.min)
+	// Temperatures outside of the scale get the color of its ends.
+	ci := min(max((t-c.min)*colorstep, 0), float64(n-1))
+	pc := c.colors[int64(ci)]
+	return pc.R, pc.G, pc.B
+}
+
+// renderField draws the colored temperature field in the camera resolution
+// without the scale and the markers
+func renderField(frame *Thermogram, opts Options) image.Image {
+	cs := newColorscale(frame, opts)
+	field := image.NewRGBA(image.Rect(0, 0, frame.Width, frame.Height))
+	for y := 0; y < frame.Height; y++ {
+		for x := 0; x < frame.Width; x++ {
+			r, g, b := cs.color(frame.At(x, y))
+			if opts.Climate != nil {
+				r, g, b = opts.Climate.overlay(frame.At(x, y), x, y, 1, r, g, b)
+			}
+			field.SetRGBA(x, y, color.RGBA{r, g, b, 255})
+		}
+	}
+	return field
+}
+
+// scaleWidth is the width of the temperature scale right of the field in
+// pixels of a 240 pixel high field
+const scaleWidth = 70
+
+// layoutWidth returns the width of the infrared picture of frame with its
+// scale in camera pixels. The scale grows with the height of the field.
+func layoutWidth(frame *Thermogram) float64 {
+	return float64(frame.Width) + scaleWidth*float64(frame.Height)/240
+}
+
+// renderIR draws the temperature field with the colortable, the temperature
+// scale and the min/max markers. Everything is drawn at the output
+// resolution, so the text stays sharp when the picture is upscaled. With an
+// edge strength the detail of the visual picture vis is embossed onto the
+// colors.
+func renderIR(frame *Thermogram, vis image.Image, opts Options) (image.Image, error) {
+	var r, g, b uint8
+	s := opts.scale(frame)
+	// u converts the 240 pixel high layout of the scale to the output.
+	u := s * float64(frame.Height) / 240
+	mintemperature := frame.Min()
+	maxtemperature := frame.Max()
+	mintemppointx := (float64(frame.MinX)+0.5)*s - 0.5
+	mintemppointy := (float64(frame.MinY)+0.5)*s - 0.5
+	maxtemppointx := (float64(frame.MaxX)+0.5)*s - 0.5
+	maxtemppointy := (float64(frame.MaxY)+0.5)*s - 0.5
+	opts.logger().Printf("Min. and Max. temperature in the file:\n")
+	opts.logger().Printf("Temperature min=%.2f °C\n", mintemperature)
+	opts.logger().Printf("Temperature max=%.2f °C\n", maxtemperature)
+
+	cs := newColorscale(frame, opts)
+	mintemperaturescale := cs.min
+	maxtemperaturescale := cs.max
+	if opts.Climate != nil {
+		c := opts.Climate
+		opts.logger().Printf("Indoor=%.1f °C, humidity=%.0f %%, outdoor=%.1f °C\n", c.Indoor, c.Humidity, c.Outdoor)
+		opts.logger().Printf("Dew point=%.1f °C, mold temperature=%.1f °C\n", c.DewPoint(), c.MoldTemperature())
+		opts.logger().Printf("Mode=%s\n", opts.mode())
+	} else if opts.manualScale() {
+		opts.logger().Printf("Manual scale of the colortable:\n")
+		opts.logger().Printf("Temperature min=%.2f °C\n", mintemperaturescale)
+		opts.logger().Printf("Temperature max=%.2f °C\n", maxtemperaturescale)
+	} else {
+		opts.logger().Printf("Automatic scale of the colortable.\n")
+	}
+
+	opts.logger().Printf("Backgroundtemperature=%.2f °C\n", frame.Params.Background)
+	opts.logger().Printf("Emission factor=%.2f\n", frame.Params.Emission)
+	if s != 1 {
+		opts.logger().Printf("Scale factor=%.2f (%s)\n", s, opts.interpolation())
+	}
+
+	var detail *detailmap
+	if opts.EdgeStrength > 0 && vis != nil {
+		opts.logger().Printf("Edge strength=%.2f\n", opts.EdgeStrength)
+		detail = newDetailmap(vis, opts.alignment(frame, vis), 2)
+	}
+
+	width := int(math.Round(float64(frame.Width) * s))
+	height := int(math.Round(float64(frame.Height) * s))
+	irImage := gg.NewContext(int(math.Round(layoutWidth(frame)*s)), height)
+	font, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	fontbold, err := truetype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face := truetype.NewFace(font, &truetype.Options{Size: 14 * u})
+	irImage.SetFontFace(face)
+	irImage.SetRGBA(1, 1, 1, 1)
+	irImage.Clear()
+	// The temperature field is interpolated before the colortable is
+	// applied, so there is no color banding in the upscaled picture.
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := (float64(x)+0.5)/s-0.5, (float64(y)+0.5)/s-0.5
+			t := frame.sample(fx, fy, opts.interpolation())
+			r, g, b = cs.color(t)
+			if opts.Climate != nil {
+				r, g, b = opts.Climate.overlay(t, x, y, s, r, g, b)
+			}
+			if detail != nil {
+				r, g, b = emboss(r, g, b, detail.at(fx, fy), opts.EdgeStrength)
+			}
+			irImage.SetRGB255(int(r), int(g), int(b))
+			irImage.SetPixel(x, y)
+		}
+	}
+	// The scale is laid out for a 390x240 picture right of the field, line
+	// and text take the coordinates of this layout.
+	sx := func(x float64) float64 {
+		return float64(width) + (x-320)*u
+	}
+	line := func(x1, y1, x2, y2 float64) {
+		irImage.DrawLine(sx(x1), y1*u, sx(x2), y2*u)
+	}
+	text := func(str string, x, y float64) {
+		irImage.DrawString(str, sx(x), y*u)
+	}
+	n := float64(len(cs.colors))
+	colorstep := n / (221.0 * u)
+	for y := 0; y < int(math.Round(221*u)); y++ {
+		ci := n - 1 - colorstep*float64(y)
+		if ci >= n {
+			ci = n - 1
+		}
+		if ci < 0 {
+			ci = 0
+		}
+		pc := cs.colors[int(ci)]
+		r, g, b = pc.R, pc.G, pc.B
+		irImage.SetLineWidth(1)
+		irImage.SetRGB255(int(r), int(g), int(b))
+		irImage.DrawLine(sx(320), float64(y), sx(335), float64(y))
+		irImage.Stroke()
+	}
+	irImage.SetRGB255(0, 0, 0)
+	irImage.SetLineWidth(u)
+	irImage.DrawRectangle(sx(320), 0, 15*u, 220*u)
+	irImage.Stroke()
+	line(320, 8, 335, 8)
+	text(fmt.Sprintf("%.1f", maxtemperaturescale), 353, 13)
+	line(320, 213, 335, 213)
+	text(fmt.Sprintf("%.1f", mintemperaturescale), 353, 219)
+	line(344, 8, 344, 213)
+	line(344, 8, 350, 8)
+	tempstep := (maxtemperaturescale - mintemperaturescale) / 9
+	for i := 24; i < 224; i = i + 25 {
+		temp := (tempstep * ((((224 - float64(i)) - 24) / 25) + 1)) + mintemperaturescale
+		line(344, float64(i), 350, float64(i))
+		text(fmt.Sprintf(cs.ticks, temp), 353, float64(i)+4)
+	}
+	line(344, 213, 350, 213)
+	text(cs.unit, 346, 234)
+	irImage.Stroke()
+	irImage.SetRGB255(0, 0, 0)
+	face2 := truetype.NewFace(fontbold, &truetype.Options{Size: 13 * s})
+	irImage.SetFontFace(face2)
+	irImage.SetLineWidth(4 * s)
+	irImage.DrawLine(mintemppointx-4*s, mintemppointy, mintemppointx+4*s, mintemppointy)
+	irImage.DrawLine(mintemppointx, mintemppointy-4*s, mintemppointx, mintemppointy+4*s)
+	irImage.DrawString(fmt.Sprintf("%.1f", mintemperature), mintemppointx-12*s, mintemppointy-6*s)
+	irImage.Stroke()
+	irImage.DrawLine(maxtemppointx-4*s, maxtemppointy, maxtemppointx+4*s, maxtemppointy)
+	irImage.DrawLine(maxtemppointx, maxtemppointy-4*s, maxtemppointx, maxtemppointy+4*s)
+	irImage.DrawString(fmt.Sprintf("%.1f", maxtemperature), maxtemppointx-12*s, maxtemppointy-6*s)
+	irImage.Stroke()
+	irImage.SetRGBA255(200, 200, 255, 230)
+	face = truetype.NewFace(font, &truetype.Options{Size: 12 * s})
+	irImage.SetFontFace(face)
+	irImage.SetLineWidth(s)
+	irImage.DrawLine(mintemppointx-3*s, mintemppointy, mintemppointx+3*s, mintemppointy)
+	irImage.DrawLine(mintemppointx, mintemppointy-3*s, mintemppointx, mintemppointy+3*s)
+	irImage.DrawString(fmt.Sprintf("%.1f", mintemperature), mintemppointx-12*s, mintemppointy-6*s)
+	irImage.Stroke()
+	irImage.SetRGBA255(255, 200, 200, 230)
+	irImage.DrawLine(maxtemppointx-2*s, maxtemppointy, maxtemppointx+2*s, maxtemppointy)
+	irImage.DrawLine(maxtemppointx, maxtemppointy-2*s, maxtemppointx, maxtemppointy+2*s)
+	irImage.DrawString(fmt.Sprintf("%.1f", maxtemperature), maxtemppointx-12*s, maxtemppointy-6*s)
+	irImage.Stroke()
+	if opts.Hotspots != nil {
+		hotspots := frame.Hotspots(*opts.Hotspots)
+		opts.logger().Printf("Hotspots=%d\n", len(hotspots))
+		drawHotspots(irImage, hotspots, s)
+	}
+	for _, c := range opts.Clusters {
+		clusters := frame.Clusters(c)
+		opts.logger().Printf("%s clusters=%d\n", c.Kind, len(clusters))
+		drawClusters(irImage, clusters, c.Style, s, float64(width), float64(height))
+	}
+	if c := opts.Climate; c != nil {
+		// The legend of the overlays is in the lower left corner, it is laid
+		// out like the scale.
+		legend := fmt.Sprintf("Td %.1f °C  mold %.1f °C  fRsi %.2f", c.DewPoint(), c.MoldTemperature(), FRsiCritical)
+		ly := float64(height) - 240*u
+		irImage.SetRGBA255(0, 0, 0, 160)
+		irImage.DrawRectangle(0, ly+222*u, 250*u, 18*u)
+		irImage.Fill()
+		irImage.SetRGB255(int(condensationColor[0]), int(condensationColor[1]), int(condensationColor[2]))
+		irImage.DrawRectangle(4*u, ly+226*u, 10*u, 10*u)
+		irImage.Fill()
+		irImage.SetRGB255(int(moldColor[0]), int(moldColor[1]), int(moldColor[2]))
+		irImage.DrawRectangle(18*u, ly+226*u, 10*u, 10*u)
+		irImage.Fill()
+		irImage.SetRGB255(255, 255, 255)
+		irImage.SetFontFace(truetype.NewFace(font, &truetype.Options{Size: 12 * u}))
+		irImage.DrawString(legend, 32*u, ly+235*u)
+	}
+	return irImage.Image(), nil
+}
+
+// drawHotspots draws the numbered boxes of the hotspots at the output
+// scale s. The boxes are white with a black outline, so they are visible
+// on every color.
+func drawHotspots(dc *gg.Context, hotspots []Hotspot, s float64) {
+	for _, h := range hotspots {
+		x, y := float64(h.X)*s, float64(h.Y)*s
+		w, hh := float64(h.Width)*s, float64(h.Height)*s
+		label := fmt.Sprint(h.Number)
+		// The number is above the box, or below it at the top edge.
+		ty := y - 3*s
+		if ty < 14*s {
+			ty = y + hh + 13*s
+		}
+		dc.SetRGB255(0, 0, 0)
+		dc.SetLineWidth(3 * s)
+		dc.DrawRectangle(x, y, w, hh)
+		dc.Stroke()
+		dc.DrawString(label, x+s, ty+s)
+		dc.SetRGB255(255, 255, 255)
+		dc.SetLineWidth(s)
+		dc.DrawRectangle(x, y, w, hh)
+		dc.Stroke()
+		dc.DrawString(label, x, ty)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	// A ramp of 1 K per column and 10 K per row with a step at x 4
+	frame := testTemperatures(8, 6, func(x, y int) float64 {
+		v := float64(x + 10*y)
+		if x >= 4 {
+			v += 100
+		}
+		return v
+	})
+	tests := []struct {
+		interpolation string
+		x, y          float64
+		want          float64
+	}{
+		{InterpolationNearest, 1, 2, 21},
+		{InterpolationNearest, 1.4, 2.6, 31},
+		{InterpolationNearest, -3, 9, 50},
+		{"", 1.6, 2, 22},
+		{InterpolationBilinear, 1, 2, 21},
+		{InterpolationBilinear, 1.5, 2, 21.5},
+		{InterpolationBilinear, 1.25, 2.5, 26.25},
+		{InterpolationBilinear, 3.5, 0, 53.5},
+		{InterpolationBilinear, 7.5, 5.5, 157},
+		{InterpolationBicubic, 1, 2, 21},
+		{InterpolationBicubic, 1.5, 2, 21.5},
+		{InterpolationBicubic, 1.25, 2.5, 26.25},
+		{InterpolationBicubic, 6, 3, 136},
+	}
+	for _, tt := range tests {
+		if got := frame.sample(tt.x, tt.y, tt.interpolation); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s at %v,%v: %v, want %v", tt.interpolation, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestRenderIRSize(t *testing.T) {
+	frame := testTemperatures(320, 240, func(x, y int) float64 { return float64(x) / 10 })
+	tests := []struct {
+		opts          Options
+		width, height int
+	}{
+		{Options{}, 390, 240},
+		{Options{ScaleFactor: 2, Interpolation: InterpolationBilinear}, 780, 480},
+		{Options{Width: 780, Interpolation: InterpolationBicubic}, 780, 480},
+		{Options{Width: 1170, ScaleFactor: 2}, 1170, 720},
+	}
+	for _, tt := range tests {
+		tt.opts.Logger = discard
+		img, err := renderIR(frame, nil, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != tt.width || img.Bounds().Dy() != tt.height {
+			t.Errorf("%+v: size %v, want %dx%d", tt.opts, img.Bounds().Size(), tt.width, tt.height)
+		}
+	}
+}
+
+func TestRenderIRFrameSize(t *testing.T) {
+	tests := []struct {
+		frameWidth, frameHeight int
+		opts                    Options
+		width, height           int
+	}{
+		{640, 480, Options{}, 780, 480},
+		{640, 480, Options{Width: 390}, 390, 240},
+		{200, 240, Options{}, 270, 240},
+		{200, 240, Options{ScaleFactor: 2}, 540, 480},
+	}
+	for _, tt := range tests {
+		frame := testTemperatures(tt.frameWidth, tt.frameHeight, func(x, y int) float64 { return float64(x) / 10 })
+		tt.opts.Logger = discard
+		img, err := renderIR(frame, nil, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != tt.width || img.Bounds().Dy() != tt.height {
+			t.Errorf("%dx%d %+v: size %v, want %dx%d", tt.frameWidth, tt.frameHeight, tt.opts, img.Bounds().Size(), tt.width, tt.height)
+		}
+		// The color bar of the scale starts right of the field.
+		s := float64(tt.height) / float64(tt.frameHeight)
+		x := int(math.Round(float64(tt.frameWidth)*s)) + tt.height*7/240
+		if r, g, b, _ := img.At(x, tt.height/2).RGBA(); r == 0xffff && g == 0xffff && b == 0xffff {
+			t.Errorf("%dx%d %+v: no color bar at %d,%d", tt.frameWidth, tt.frameHeight, tt.opts, x, tt.height/2)
+		}
+	}
+}
+
+func TestColorscaleColor(t *testing.T) {
+	colors := []color.RGBA{{0, 0, 0, 255}, {1, 0, 0, 255}, {2, 0, 0, 255}, {3, 0, 0, 255}}
+	tests := []struct {
+		name     string
+		min, max float64
+		t        float64
+		want     uint8
+	}{
+		{"minimum", 10, 50, 10, 0},
+		{"lower quarter", 10, 50, 19.9, 0},
+		{"second quarter", 10, 50, 20, 1},
+		{"maximum", 10, 50, 50, 3},
+		{"above the maximum", 10, 50, 80, 3},
+		{"below the minimum", 10, 50, 5, 0},
+		{"far below the minimum", 10, 50, -30, 0},
+		{"not a number", 10, 50, math.NaN(), 0},
+		{"uniform", 20, 20, 20, 2},
+		{"uniform above", 20, 20, 25, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := colorscale{min: tt.min, max: tt.max, colors: colors}
+			r, _, _ := cs.color(tt.t)
+			if r != tt.want {
+				t.Errorf("color %d, want %d", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderUniform(t *testing.T) {
+	raw := make([]uint16, 320*240)
+	for i := range raw {
+		raw[i] = 1500
+	}
+	frame := newThermogram(FormatOldIS2, 320, 240, raw, DefaultParams, func(w uint16, p Params) float64 {
+		return raypower2degrees(w, p.Background, p.Emission)
+	})
+	img, err := renderIR(frame, nil, Options{Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 390 || img.Bounds().Dy() != 240 {
+		t.Errorf("bounds %v", img.Bounds())
+	}
+}
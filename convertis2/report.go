@@ -0,0 +1,153 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"time"
+)
+
+// Report is an inspection report of several files
+type Report struct {
+	Title     string
+	Customer  string
+	Inspector string
+	Date      time.Time
+	// RuleSet classifies the pictures
+	RuleSet *RuleSet
+	Entries []ReportEntry
+}
+
+// Critical returns the number of pictures with critical findings
+func (r *Report) Critical() int {
+	n := 0
+	for _, e := range r.Entries {
+		if e.Classification.Critical {
+			n++
+		}
+	}
+	return n
+}
+
+// ReportEntry is the measurement of a file in a report
+type ReportEntry struct {
+	Info *Info
+	// Palette and scale of the infrared picture
+	Palette  string
+	ScaleMin float64
+	ScaleMax float64
+	// Regions are the temperatures of the ROIs stored in the file
+	Regions []ReportRegion
+	// Reference is the temperature the delta-T results refer to. It is the
+	// mean of the ROI named ref or the ambient temperature, nil without both.
+	Reference     *float64
+	ReferenceName string
+	// DeltaT is the max temperature minus the reference, nil without a
+	// reference
+	DeltaT *float64
+	// Classification of the picture by the rule set of the report
+	Classification Classification
+	Analysis
+	// IR and Visual are the pictures as jpeg, Visual is nil if the file
+	// has none
+	IR     []byte
+	Visual []byte
+	// Audio is the voice annotation as wav, nil if the file has none
+	Audio []byte
+}
+
+// ReportRegion is a ROI of a report with its delta-T result
+type ReportRegion struct {
+	RegionStats
+	// DeltaT is the max temperature of the region minus the reference, nil
+	// without a reference
+	DeltaT *float64
+	// Severity and Level are the highest severity of the findings of the
+	// region
+	Severity string
+	Level    int
+}
+
+// NewReport decodes the files and renders their pictures with the options.
+// The options add their Analysis. The pictures are classified by the rules,
+// nil selects DefaultRuleSet.
+func NewReport(files []string, opts Options, rules *RuleSet) (*Report, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = DefaultRuleSet
+	}
+	report := &Report{Date: time.Now(), RuleSet: rules}
+	for i, filename := range files {
+		opts.logger().Printf("[%d/%d] %s\n", i+1, len(files), filename)
+		entry, err := newReportEntry(filename, opts, rules)
+		if err != nil {
+			return nil, err
+		}
+		report.Entries = append(report.Entries, *entry)
+	}
+	return report, nil
+}
+
+// newReportEntry decodes filename and measures its ROIs
+func newReportEntry(filename string, opts Options, rules *RuleSet) (*ReportEntry, error) {
+	frame, err := decodeOptions(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	info, err := newInfo(filename, frame)
+	if err != nil {
+		return nil, err
+	}
+	cs := newColorscale(frame, opts)
+	entry := &ReportEntry{
+		Info:     info,
+		Palette:  opts.palette(),
+		ScaleMin: cs.min,
+		ScaleMax: cs.max,
+	}
+	reference, name := frame.Reference(opts.Ambient)
+	// delta returns the delta T of t, nil without a reference
+	delta := func(t float64) *float64 {
+		if entry.Reference == nil {
+			return nil
+		}
+		d := t - reference
+		return &d
+	}
+	if name != referenceMean {
+		entry.Reference, entry.ReferenceName = &reference, name
+	}
+	entry.DeltaT = delta(frame.Max())
+	entry.Classification = rules.Classify(frame, opts.Ambient)
+	entry.Analysis = analyze(frame, opts)
+	for _, roi := range frame.ROIs {
+		reg := ReportRegion{RegionStats: frame.Region(roi)}
+		reg.DeltaT = delta(reg.Max.Temperature)
+		reg.Severity, reg.Level = entry.Classification.SubjectLevel(rules, roi.Name)
+		entry.Regions = append(entry.Regions, reg)
+	}
+	meta := frame.Metadata.measurement(frame, opts)
+	img, err := renderIR(frame, frame.Visual, opts)
+	if err != nil {
+		return nil, err
+	}
+	entry.IR, err = encodeImage(img, FormatJPEG, opts, meta)
+	if err != nil {
+		return nil, fmt.Errorf("Can't encode infrared data. %w %s", err, filename)
+	}
+	if frame.Visual != nil || frame.VisualJPEG != nil {
+		entry.Visual, err = encodeVisual(frame, FormatJPEG, opts, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Can't encode visual picture. %w %s", err, filename)
+		}
+	}
+	if len(frame.Audio) > 0 {
+		entry.Audio = wavData(frame.Audio, frame.AudioRate)
+	}
+	return entry, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+)
+
+// reportHTML is the default template of the html report
+//
+//go:embed report.html
+var reportHTML string
+
+// reportFuncs are the functions of the report templates
+var reportFuncs = template.FuncMap{
+	"base":   filepath.Base,
+	"deltaT": deltaT,
+	"inc":    func(i int) int { return i + 1 },
+	"jpeg": func(data []byte) template.URL {
+		return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data))
+	},
+	"wav": func(data []byte) template.URL {
+		return template.URL("data:audio/wav;base64," + base64.StdEncoding.EncodeToString(data))
+	},
+	"severityClass": func(level int) string {
+		return fmt.Sprintf("severity-%d", level)
+	},
+}
+
+// ParseReportTemplate returns the template of the html report. The files
+// are parsed after the default template, so they can redefine its blocks
+// title, style, cover, summary, entry and footer or the whole template
+// report. The functions base, inc, jpeg, wav and severityClass are
+// available. severityClass maps the level of a severity to the css class
+// severity-<level>.
+func ParseReportTemplate(files ...string) (*template.Template, error) {
+	tmpl, err := template.New("report").Funcs(reportFuncs).Parse(reportHTML)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return tmpl, nil
+	}
+	return tmpl.ParseFiles(files...)
+}
+
+// WriteHTML writes the report as self-contained html file with the
+// template tmpl. nil selects the default template. The pictures and the
+// voice annotations are embedded as data URLs.
+func (r *Report) WriteHTML(w io.Writer, tmpl *template.Template) error {
+	if tmpl == nil {
+		var err error
+		tmpl, err = ParseReportTemplate()
+		if err != nil {
+			return err
+		}
+	}
+	return tmpl.ExecuteTemplate(w, "report", r)
+}
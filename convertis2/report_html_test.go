@@ -0,0 +1,99 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+	report := testReport(t)
+	dir := t.TempDir()
+	override := filepath.Join(dir, "footer.html")
+	err := os.WriteFile(override, []byte(`{{define "footer"}}<p>Checked by {{.Inspector}}</p>{{end}}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.html")
+	err = os.WriteFile(bad, []byte(`{{define "footer"}}{{.Missing`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.Inspector = "J. Doe"
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+		not   []string
+	}{
+		{"default template", nil, []string{
+			"<title>Switchgear Ü1</title>",
+			"<h2>old.IS2</h2>",
+			"<h2>new.IS2</h2>",
+			`src="data:image/jpeg;base64,/9j/`,
+			`<audio controls src="data:audio/wav;base64,UklGR`,
+			"<td>Asset</td><td class=\"text\">TR-1</td>",
+			"(ref)</td></tr>",
+			"<td>Reference</td><td class=\"text\">none, delta T needs a ROI named ref or an ambient temperature",
+			"<td>Delta T</td><td class=\"text\">none</td>",
+			"<h3>Clusters</h3>",
+			"Created by goConvertIS2.",
+		}, []string{"%!"}},
+		{"overridden footer", []string{override}, []string{
+			"<h2>old.IS2</h2>",
+			"<p>Checked by J. Doe</p>",
+		}, []string{"Created by goConvertIS2."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseReportTemplate(tt.files...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err = report.WriteHTML(&buf, tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			html := buf.String()
+			for _, s := range tt.want {
+				if !strings.Contains(html, s) {
+					t.Errorf("%q not in the report", s)
+				}
+			}
+			for _, s := range tt.not {
+				if strings.Contains(html, s) {
+					t.Errorf("%q in the report", s)
+				}
+			}
+			// The sections of both files and their images
+			if n := strings.Count(html, `<section class="entry">`); n != 2 {
+				t.Errorf("%d sections, want 2", n)
+			}
+			if n := strings.Count(html, "<img "); n != 3 {
+				t.Errorf("%d pictures, want 3", n)
+			}
+		})
+	}
+	if _, err := ParseReportTemplate(bad); err == nil {
+		t.Error("bad template parsed")
+	}
+}
+
+func TestWriteHTMLNilTemplate(t *testing.T) {
+	report := &Report{Title: "Empty <report>", RuleSet: DefaultRuleSet}
+	var buf bytes.Buffer
+	err := report.WriteHTML(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<title>Empty &lt;report&gt;</title>") {
+		t.Error("title not escaped")
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pdfReport writes a report with gofpdf. The core fonts of pdf take cp1252
+// text, tr translates the utf-8 strings.
+type pdfReport struct {
+	pdf *gofpdf.Fpdf
+	tr  func(string) string
+}
+
+// WritePDF writes the report as A4 PDF with a cover page, a summary table
+// and a page per file
+func (r *Report) WritePDF(w io.Writer) error {
+	p := &pdfReport{pdf: gofpdf.New("P", "mm", "A4", "")}
+	p.tr = p.pdf.UnicodeTranslatorFromDescriptor("")
+	pdf := p.pdf
+	pdf.SetTitle(r.Title, true)
+	pdf.SetCreator("goConvertIS2", true)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 6, p.tr(fmt.Sprintf("%s - page %d/{nb}", r.Title, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	p.cover(r)
+	p.summary(r)
+	for i := range r.Entries {
+		p.entry(i, &r.Entries[i])
+	}
+	return pdf.Output(w)
+}
+
+// cover writes the cover page
+func (p *pdfReport) cover(r *Report) {
+	pdf := p.pdf
+	pdf.AddPage()
+	pdf.SetY(80)
+	pdf.SetFont("Helvetica", "B", 26)
+	pdf.MultiCell(0, 12, p.tr(r.Title), "", "C", false)
+	pdf.Ln(10)
+	pdf.SetFont("Helvetica", "", 13)
+	for _, line := range [][2]string{
+		{"Customer", r.Customer},
+		{"Inspector", r.Inspector},
+		{"Date", r.Date.Format("2006-01-02")},
+		{"Pictures", fmt.Sprint(len(r.Entries))},
+	} {
+		if line[1] == "" {
+			continue
+		}
+		pdf.CellFormat(0, 8, p.tr(line[0]+": "+line[1]), "", 1, "C", false, 0, "")
+	}
+}
+
+// summary writes the table of all files
+func (p *pdfReport) summary(r *Report) {
+	pdf := p.pdf
+	pdf.AddPage()
+	p.heading("Summary")
+	rows := make([][]string, len(r.Entries))
+	for i, e := range r.Entries {
+		rows[i] = []string{
+			fmt.Sprint(i + 1),
+			filepath.Base(e.Info.File),
+			captured(e.Info),
+			fmt.Sprintf("%.1f °C", e.Info.Min.Temperature),
+			fmt.Sprintf("%.1f °C", e.Info.Max.Temperature),
+			deltaT(e.DeltaT, "%.1f K"),
+			fmt.Sprint(len(e.Regions)),
+			severity(&e.Classification),
+		}
+	}
+	p.table([]float64{8, 46, 30, 18, 18, 18, 12, 40}, "RLLRRRRL", []string{"#", "File", "Captured", "Min.", "Max.", "Delta T", "ROIs", "Severity"}, rows)
+	if n := r.Critical(); n > 0 {
+		pdf.Ln(4)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.MultiCell(0, 5, p.tr(fmt.Sprintf("%d of %d pictures have critical findings.", n, len(r.Entries))), "", "L", false)
+	}
+	if r.RuleSet != nil {
+		pdf.Ln(4)
+		p.subheading("Rule set " + r.RuleSet.Name)
+		var rows [][]string
+		for _, rule := range r.RuleSet.Rules {
+			rows = append(rows, []string{rule.Severity, rule.Measure, rule.ROI, fmt.Sprintf("> %.1f", rule.Above)})
+		}
+		p.table([]float64{50, 40, 40, 25}, "LLLR", []string{"Severity", "Measure", "ROI", "Threshold"}, rows)
+	}
+}
+
+// entry writes the page of a file
+func (p *pdfReport) entry(i int, e *ReportEntry) {
+	pdf := p.pdf
+	pdf.AddPage()
+	p.heading(fmt.Sprintf("%d. %s", i+1, filepath.Base(e.Info.File)))
+	// The pictures are side by side in the full width of the page.
+	left, _, right, _ := pdf.GetMargins()
+	pagewidth, _ := pdf.GetPageSize()
+	width := (pagewidth - left - right - 4) / 2
+	y := pdf.GetY()
+	height := p.image(fmt.Sprintf("ir%d", i), e.IR, left, y, width)
+	if e.Visual != nil {
+		height = max(height, p.image(fmt.Sprintf("vis%d", i), e.Visual, left+width+4, y, width))
+	}
+	pdf.SetY(y + height + 6)
+
+	p.subheading("Measurement")
+	camera := strings.TrimSpace(e.Info.Make + " " + e.Info.Model)
+	if e.Info.Serial != "" {
+		camera += " (" + e.Info.Serial + ")"
+	}
+	measurement := [][]string{
+		{"Captured", captured(e.Info)},
+		{"Camera", camera},
+		{"Emission factor", fmt.Sprintf("%.2f", e.Info.Params.Emission)},
+		{"Background temperature", fmt.Sprintf("%.1f °C", e.Info.Params.Background)},
+		{"Palette, scale", fmt.Sprintf("%s, %.1f to %.1f °C", e.Palette, e.ScaleMin, e.ScaleMax)},
+		{"Severity", severity(&e.Classification)},
+	}
+	if e.Info.Asset != "" {
+		measurement = append([][]string{{"Asset", e.Info.Asset}}, measurement...)
+	}
+	p.table([]float64{50, 140}, "LL", nil, measurement)
+	if b := e.Building; b != nil {
+		p.table([]float64{50, 140}, "LL", nil, [][]string{
+			{"Climate", fmt.Sprintf("indoor %.1f °C, humidity %.0f %%, outdoor %.1f °C", b.Climate.Indoor, b.Climate.Humidity, b.Climate.Outdoor)},
+			{"Dew point, mold", fmt.Sprintf("%.1f °C, %.1f °C (surface humidity 80 %%)", b.DewPoint, b.MoldTemperature)},
+			{"Min. margin, fRsi", fmt.Sprintf("%.1f K, %.2f", b.MinMargin, b.MinFRsi)},
+			{"Condensation, mold risk", fmt.Sprintf("%.1f %%, %.1f %% of the picture", b.Condensation, b.MoldRisk)},
+		})
+	}
+	pdf.Ln(4)
+
+	p.subheading("Spots and regions")
+	rows := [][]string{
+		{"Min. spot", fmt.Sprintf("%d,%d", e.Info.Min.X, e.Info.Min.Y), fmt.Sprintf("%.1f", e.Info.Min.Temperature), "", "", "", ""},
+		{"Max. spot", fmt.Sprintf("%d,%d", e.Info.Max.X, e.Info.Max.Y), "", fmt.Sprintf("%.1f", e.Info.Max.Temperature), "", deltaT(e.DeltaT, "%.1f"), ""},
+	}
+	for _, reg := range e.Regions {
+		pos := fmt.Sprintf("%d,%d", reg.X, reg.Y)
+		if reg.Width > 0 && reg.Height > 0 {
+			pos += fmt.Sprintf(" %dx%d", reg.Width, reg.Height)
+		}
+		name := reg.Name
+		if reg.Emission != 0 {
+			name += fmt.Sprintf(", e %.2f", reg.Emission)
+		}
+		rows = append(rows, []string{name, pos, fmt.Sprintf("%.1f", reg.Min.Temperature), fmt.Sprintf("%.1f", reg.Max.Temperature), fmt.Sprintf("%.1f", reg.Mean), deltaT(reg.DeltaT, "%.1f"), reg.Severity})
+	}
+	p.table([]float64{36, 28, 20, 20, 20, 20, 46}, "LLRRRRL", []string{"Name", "Position", "Min. °C", "Max. °C", "Mean °C", "Delta T K", "Severity"}, rows)
+	pdf.SetFont("Helvetica", "", 9)
+	note := "There is no reference, delta T needs a ROI named ref or an ambient temperature."
+	if e.Reference != nil {
+		note = fmt.Sprintf("Delta T is the max. temperature minus the reference %.1f °C (%s).", *e.Reference, e.ReferenceName)
+	}
+	if e.Classification.NoReference {
+		note += " The delta-T rules are skipped."
+	}
+	pdf.MultiCell(0, 5, p.tr(note), "", "L", false)
+	pdf.Ln(4)
+
+	if len(e.Hotspots) > 0 {
+		p.subheading("Hotspots")
+		var rows [][]string
+		for _, h := range e.Hotspots {
+			rows = append(rows, []string{fmt.Sprint(h.Number), h.Pattern, fmt.Sprintf("%d,%d %dx%d", h.X, h.Y, h.Width, h.Height), fmt.Sprint(h.Area), fmt.Sprintf("%.1f", h.Peak.Temperature), fmt.Sprintf("%.1f", h.Surrounding), fmt.Sprintf("%.1f", h.DeltaT)})
+		}
+		p.table([]float64{10, 30, 40, 20, 25, 30, 25}, "RLLRRRR", []string{"#", "Pattern", "Box", "Area px", "Peak °C", "Surround. °C", "Delta T K"}, rows)
+		pdf.Ln(4)
+	}
+
+	if len(e.Clusters) > 0 {
+		p.subheading("Clusters")
+		var rows [][]string
+		for _, c := range e.Clusters {
+			rows = append(rows, []string{c.Kind, fmt.Sprint(c.Rank), fmt.Sprintf("%d,%d", c.Peak.X, c.Peak.Y), fmt.Sprintf("%.1f", c.Peak.Temperature), fmt.Sprintf("%d,%d %dx%d", c.X, c.Y, c.Width, c.Height), fmt.Sprint(c.Area), fmt.Sprintf("%.1f", c.Mean)})
+		}
+		p.table([]float64{20, 10, 30, 25, 45, 25, 25}, "LRLRLRR", []string{"Kind", "#", "Peak at", "Peak °C", "Box", "Area px", "Mean °C"}, rows)
+		pdf.Ln(4)
+	}
+
+	if len(e.Classification.Findings) > 0 {
+		p.subheading("Findings")
+		var rows [][]string
+		for _, f := range e.Classification.Findings {
+			rows = append(rows, []string{f.Rule.Severity, f.Rule.Measure, f.Subject, fmt.Sprintf("%.1f", f.Value), fmt.Sprintf("> %.1f", f.Rule.Above)})
+		}
+		p.table([]float64{50, 35, 40, 25, 25}, "LLLRR", []string{"Severity", "Measure", "ROI", "Value", "Threshold"}, rows)
+		pdf.Ln(4)
+	}
+
+	p.subheading("Notes")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, note := range e.Info.Annotations {
+		pdf.MultiCell(0, 5, p.tr(note), "", "L", false)
+	}
+	// Ruled lines for handwritten notes fill the rest of the page.
+	_, pageheight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	for y := pdf.GetY() + 8; y < pageheight-bottom-5; y += 8 {
+		pdf.Line(left, y, pagewidth-right, y)
+	}
+}
+
+// heading writes the heading of a page
+func (p *pdfReport) heading(s string) {
+	p.pdf.SetFont("Helvetica", "B", 16)
+	p.pdf.CellFormat(0, 10, p.tr(s), "", 1, "L", false, 0, "")
+	p.pdf.Ln(2)
+}
+
+// subheading writes the heading of a section
+func (p *pdfReport) subheading(s string) {
+	p.pdf.SetFont("Helvetica", "B", 12)
+	p.pdf.CellFormat(0, 7, p.tr(s), "", 1, "L", false, 0, "")
+}
+
+// image places the jpeg data at x, y in the given width and returns its
+// height
+func (p *pdfReport) image(name string, data []byte, x float64, y float64, width float64) float64 {
+	opts := gofpdf.ImageOptions{ImageType: "JPG"}
+	info := p.pdf.RegisterImageOptionsReader(name, opts, bytes.NewReader(data))
+	if info == nil {
+		return 0
+	}
+	height := width * info.Height() / info.Width()
+	p.pdf.ImageOptions(name, x, y, width, height, false, opts, 0, "")
+	return height
+}
+
+// table writes a table with the column widths. align has an L or R per
+// column. The header may be nil.
+func (p *pdfReport) table(widths []float64, align string, header []string, rows [][]string) {
+	pdf := p.pdf
+	if header != nil {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetFillColor(220, 220, 220)
+		for i, h := range header {
+			pdf.CellFormat(widths[i], 6, p.tr(h), "1", 0, align[i:i+1], true, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.SetFont("Helvetica", "", 9)
+	for _, row := range rows {
+		for i, c := range row {
+			pdf.CellFormat(widths[i], 6, p.tr(c), "1", 0, align[i:i+1], false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+// severity returns the severity of a classification, marked if critical
+func severity(c *Classification) string {
+	if c.Critical {
+		return c.Severity + " (critical)"
+	}
+	return c.Severity
+}
+
+// captured returns the capture time of a file or an empty string
+func captured(info *Info) string {
+	if info.Captured == nil {
+		return ""
+	}
+	return info.Captured.Format("2006-01-02 15:04")
+}
+
+// deltaT returns a delta T in the format or none without a reference
+func deltaT(d *float64, format string) string {
+	if d == nil {
+		return "none"
+	}
+	return fmt.Sprintf(format, *d)
+}
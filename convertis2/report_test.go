@@ -0,0 +1,93 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"testing"
+)
+
+// testReport returns a report of a file of the old format with the ROIs
+// hot and ref in its sidecar and a file of the new format
+func testReport(tb testing.TB) *Report {
+	old := writeTestFile(tb, "old.IS2", testOldIS2(testRaw(1320, 2093)))
+	sidecar := "asset: TR-1\nrois:\n  - {name: hot, x: 190, y: 80, width: 20, height: 20}\n  - {name: ref, x: 20, y: 20, width: 20, height: 20}\n"
+	if err := os.WriteFile(old+".yaml", []byte(sidecar), 0666); err != nil {
+		tb.Fatal(err)
+	}
+	files := []string{old, writeTestFile(tb, "new.IS2", testNewIS2(tb, testRaw(4716, 7263), nil))}
+	report, err := NewReport(files, Options{Logger: discard, Hotspots: &HotspotOptions{Threshold: 10}, Clusters: []ClusterOptions{{Kind: ClusterHot, Threshold: 45, Top: 1}}}, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	report.Title = "Switchgear Ü1"
+	report.Customer = "Stadtwerke"
+	return report
+}
+
+func TestNewReport(t *testing.T) {
+	report := testReport(t)
+	if len(report.Entries) != 2 || report.RuleSet != DefaultRuleSet {
+		t.Fatalf("%d entries, rule set %v", len(report.Entries), report.RuleSet)
+	}
+	o, n := report.Entries[0], report.Entries[1]
+	if o.Info.Asset != "TR-1" || len(o.Regions) != 2 || o.Regions[0].Name != "hot" {
+		t.Fatalf("asset %q, regions %+v", o.Info.Asset, o.Regions)
+	}
+	if o.ReferenceName != "ref" || o.Reference == nil || *o.Reference != o.Regions[1].Mean {
+		t.Fatalf("reference %s %v, want the mean %.2f of ref", o.ReferenceName, o.Reference, o.Regions[1].Mean)
+	}
+	if d := o.Regions[0].Max.Temperature - *o.Reference; o.Regions[0].DeltaT == nil || *o.Regions[0].DeltaT != d || o.DeltaT == nil || *o.DeltaT < d {
+		t.Errorf("delta T of hot %v, of the picture %v, want %.2f", o.Regions[0].DeltaT, o.DeltaT, d)
+	}
+	if o.Visual == nil || o.Audio == nil || n.Visual != nil || n.Audio != nil {
+		t.Errorf("visual %v %v, audio %v %v", o.Visual != nil, n.Visual != nil, o.Audio != nil, n.Audio != nil)
+	}
+	if !bytes.HasPrefix(o.IR, []byte{0xFF, 0xD8}) || len(o.Hotspots) != 1 || len(o.Clusters) != 1 {
+		t.Errorf("ir %d bytes, hotspots %v, clusters %v", len(o.IR), o.Hotspots, o.Clusters)
+	}
+	if n.Reference != nil || n.ReferenceName != "" || n.DeltaT != nil || o.ScaleMin >= o.ScaleMax {
+		t.Errorf("reference of the new file %s %v, delta T %v, scale %.2f..%.2f", n.ReferenceName, n.Reference, n.DeltaT, o.ScaleMin, o.ScaleMax)
+	}
+	critical := 0
+	for _, e := range report.Entries {
+		if e.Classification.Critical {
+			critical++
+		}
+	}
+	if report.Critical() != critical {
+		t.Errorf("%d critical, want %d", report.Critical(), critical)
+	}
+}
+
+func TestNewReportMissingFile(t *testing.T) {
+	_, err := NewReport([]string{"missing.IS2"}, Options{Logger: discard}, nil)
+	if err == nil {
+		t.Error("report of a missing file")
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	report := testReport(t)
+	var buf bytes.Buffer
+	err := report.WritePDF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.HasSuffix(bytes.TrimSpace(data), []byte("%%EOF")) {
+		t.Fatal("no PDF")
+	}
+	// A cover page, the summary and a page per file
+	pages := len(regexp.MustCompile(`/Type /Page\b[^s]`).FindAll(data, -1))
+	if pages < 2+len(report.Entries) {
+		t.Errorf("%d pages, want at least %d", pages, 2+len(report.Entries))
+	}
+	if n := bytes.Count(data, []byte("/Subtype /Image")); n < 3 {
+		t.Errorf("%d images, want the infrared pictures and the visual picture", n)
+	}
+}
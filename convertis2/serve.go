@@ -0,0 +1,377 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Outputs of the conversion service
+const (
+	OutputIR     = "ir"
+	OutputVisual = "visual"
+	OutputFusion = "fusion"
+	OutputCSV    = "csv"
+	OutputJSON   = "json"
+	OutputWAV    = "wav"
+)
+
+// maxRequestWidth limits the width of the pictures of a request to 4 times
+// the 390 pixels of the infrared picture of a 320x240 camera with its scale
+const maxRequestWidth = 4 * 390
+
+// ServeOptions holds the parameters of the conversion service
+type ServeOptions struct {
+	// Options are the defaults of the conversions. The output files are
+	// ignored, the query of a request overrides the other fields.
+	Options Options
+	// MaxUpload is the maximum size of an uploaded file in bytes. 0 selects
+	// 64 MiB.
+	MaxUpload int64
+}
+
+// Server is the HTTP conversion service. POST /convert takes a file as
+// request body or as file field of a multipart form and answers with the
+// output of the query. POST /decode answers the decoded file for the
+// viewer served at /. GET /healthz and GET /readyz report the state.
+type Server struct {
+	opts  ServeOptions
+	ready atomic.Bool
+	mux   *http.ServeMux
+}
+
+// NewServer returns a ready conversion service
+func NewServer(so ServeOptions) *Server {
+	if so.MaxUpload <= 0 {
+		so.MaxUpload = 64 << 20
+	}
+	s := &Server{opts: so, mux: http.NewServeMux()}
+	s.ready.Store(true)
+	s.mux.Handle("/", viewerHandler())
+	s.mux.HandleFunc("/convert", handle(s.convert))
+	s.mux.HandleFunc("/decode", handle(s.decode))
+	s.mux.HandleFunc("/palettes", handle(palettesJSON))
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+	return s
+}
+
+// SetReady sets the state reported by /readyz. A server is set unready
+// before it shuts down, so the load balancer stops sending requests.
+func (s *Server) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// ServeHTTP answers the requests of the service
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle returns a handler for h. h returns the HTTP status and the error
+// of a failed request. Every request is logged.
+func handle(h func(w http.ResponseWriter, r *http.Request) (int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		status, err := h(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			log.Printf("%s %s %d %s %v\n", r.Method, r.URL.RequestURI(), status, time.Since(start).Round(time.Millisecond), err)
+			return
+		}
+		log.Printf("%s %s %d %s\n", r.Method, r.URL.RequestURI(), status, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// convert answers a conversion request
+func (s *Server) convert(w http.ResponseWriter, r *http.Request) (int, error) {
+	opts, output, err := s.requestOptions(r.URL.Query())
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	frame, status, err := s.decodeUpload(w, r, opts)
+	if err != nil {
+		return status, err
+	}
+	switch {
+	case output == OutputVisual && frame.Visual == nil && frame.VisualJPEG == nil,
+		output == OutputFusion && frame.Visual == nil:
+		return http.StatusNotFound, fmt.Errorf("The file has no visual picture.")
+	case output == OutputWAV && len(frame.Audio) == 0:
+		return http.StatusNotFound, fmt.Errorf("The file has no audio.")
+	}
+	data, contentType, err := encodeOutput(frame, output, opts)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+	return http.StatusOK, nil
+}
+
+// decodeUpload decodes the uploaded file with the parameters of the
+// options. It returns the HTTP status of a failed upload.
+func (s *Server) decodeUpload(w http.ResponseWriter, r *http.Request, opts Options) (*Thermogram, int, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("Upload the file with POST.")
+	}
+	filename, err := s.receive(w, r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("The file exceeds %d bytes.", s.opts.MaxUpload)
+		}
+		return nil, http.StatusBadRequest, err
+	}
+	defer os.Remove(filename)
+	frame, err := decodeOptions(filename, opts)
+	if errors.Is(err, ErrFormat) {
+		return nil, http.StatusUnsupportedMediaType, ErrFormat
+	}
+	if err != nil {
+		return nil, http.StatusUnprocessableEntity, fmt.Errorf("Can't decode the file. %w", uploadError{filename, err})
+	}
+	return frame, http.StatusOK, nil
+}
+
+// uploadError is an error of the upload. Its message names the file
+// "upload" instead of the temporary file.
+type uploadError struct {
+	filename string
+	err      error
+}
+
+func (e uploadError) Error() string {
+	return strings.ReplaceAll(e.err.Error(), e.filename, "upload")
+}
+
+func (e uploadError) Unwrap() error {
+	return e.err
+}
+
+// requestOptions returns the conversion options and the output of the
+// query. The query has the fields output, palette, scale (auto or
+// min,max), e, b, format, width, interp and the building survey fields
+// indoor, outdoor, rh and mode, the hotspot fields hotspots,
+// hotspot_area and hotspot_window and the cluster fields hot, cold, top and marker.
+func (s *Server) requestOptions(q url.Values) (Options, string, error) {
+	opts := s.opts.Options
+	opts.IRFile, opts.VisFile, opts.AudioFile, opts.FusionFile, opts.RadiometricFile = "", "", "", "", ""
+	// The messages of the conversions would flood the log of the service.
+	opts.Logger = log.New(io.Discard, "", 0)
+	output := q.Get("output")
+	switch output {
+	case "":
+		output = OutputIR
+	case OutputIR, OutputVisual, OutputFusion, OutputCSV, OutputJSON, OutputWAV:
+	default:
+		return opts, "", fmt.Errorf("%s: unknown output.", output)
+	}
+	if q.Has("palette") {
+		opts.Palette = q.Get("palette")
+	}
+	if scale := q.Get("scale"); scale == "auto" {
+		opts.MinTemp, opts.MaxTemp = 0, 0
+	} else if scale != "" {
+		lo, hi, ok := strings.Cut(scale, ",")
+		mintemp, err1 := strconv.ParseFloat(lo, 64)
+		maxtemp, err2 := strconv.ParseFloat(hi, 64)
+		if !ok || err1 != nil || err2 != nil || mintemp >= maxtemp {
+			return opts, "", fmt.Errorf("%s: scale must be auto or min,max.", scale)
+		}
+		opts.MinTemp, opts.MaxTemp = mintemp, maxtemp
+	}
+	if q.Has("e") || q.Has("b") {
+		p := DefaultParams
+		for _, f := range []struct {
+			name  string
+			value *float64
+		}{{"e", &p.Emission}, {"b", &p.Background}} {
+			if !q.Has(f.name) {
+				continue
+			}
+			v, err := strconv.ParseFloat(q.Get(f.name), 64)
+			if err != nil {
+				return opts, "", fmt.Errorf("%s: %s must be a number.", q.Get(f.name), f.name)
+			}
+			*f.value = v
+		}
+		if p.Emission <= 0 || p.Emission > 1 {
+			return opts, "", fmt.Errorf("Emission factor must be between 0 and 1.")
+		}
+		opts.Background, opts.Emission = p.Background, p.Emission
+	}
+	if q.Has("format") {
+		opts.Format = q.Get("format")
+	}
+	if q.Has("width") {
+		width, err := strconv.Atoi(q.Get("width"))
+		if err != nil || width < 1 || width > maxRequestWidth {
+			return opts, "", fmt.Errorf("%s: width must be a number up to %d.", q.Get("width"), maxRequestWidth)
+		}
+		opts.Width = width
+	}
+	if q.Has("interp") {
+		opts.Interpolation = q.Get("interp")
+	}
+	if q.Has("indoor") || q.Has("outdoor") || q.Has("rh") {
+		c := DefaultClimate
+		for _, f := range []struct {
+			name  string
+			value *float64
+		}{{"indoor", &c.Indoor}, {"outdoor", &c.Outdoor}, {"rh", &c.Humidity}} {
+			if !q.Has(f.name) {
+				continue
+			}
+			v, err := strconv.ParseFloat(q.Get(f.name), 64)
+			if err != nil {
+				return opts, "", fmt.Errorf("%s: %s must be a number.", q.Get(f.name), f.name)
+			}
+			*f.value = v
+		}
+		opts.Climate = &c
+	}
+	if q.Has("mode") {
+		opts.Mode = q.Get("mode")
+	}
+	if q.Has("hotspots") {
+		threshold, err := strconv.ParseFloat(q.Get("hotspots"), 64)
+		if err != nil {
+			return opts, "", fmt.Errorf("%s: hotspots must be a number.", q.Get("hotspots"))
+		}
+		area, err := strconv.Atoi(q.Get("hotspot_area"))
+		if err != nil && q.Has("hotspot_area") {
+			return opts, "", fmt.Errorf("%s: hotspot_area must be a number.", q.Get("hotspot_area"))
+		}
+		window, err := strconv.Atoi(q.Get("hotspot_window"))
+		if err != nil && q.Has("hotspot_window") {
+			return opts, "", fmt.Errorf("%s: hotspot_window must be a number.", q.Get("hotspot_window"))
+		}
+		opts.Hotspots = &HotspotOptions{Threshold: threshold, MinArea: area, Window: window}
+	}
+	style := MarkerStyle{Labels: true}
+	if q.Has("marker") {
+		var err error
+		style, err = ParseMarkerStyle(q.Get("marker"))
+		if err != nil {
+			return opts, "", err
+		}
+	}
+	top := 5
+	if q.Has("top") {
+		var err error
+		top, err = strconv.Atoi(q.Get("top"))
+		if err != nil {
+			return opts, "", fmt.Errorf("%s: top must be a number.", q.Get("top"))
+		}
+	}
+	for _, kind := range []string{ClusterHot, ClusterCold} {
+		if !q.Has(kind) {
+			continue
+		}
+		threshold, err := strconv.ParseFloat(q.Get(kind), 64)
+		if err != nil {
+			return opts, "", fmt.Errorf("%s: %s must be a temperature.", q.Get(kind), kind)
+		}
+		opts.Clusters = append(opts.Clusters, ClusterOptions{Kind: kind, Threshold: threshold, Radius: 10, Top: top, Style: style})
+	}
+	return opts, output, opts.Validate()
+}
+
+// receive stores the uploaded file in a temporary file and returns its
+// name. The file is the request body or the file field of a multipart form.
+func (s *Server) receive(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.opts.MaxUpload)
+	var src io.Reader = r.Body
+	if mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediatype == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return "", err
+		}
+		for src == r.Body {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return "", fmt.Errorf("The form has no file field.")
+			}
+			if err != nil {
+				return "", err
+			}
+			if part.FormName() == "file" {
+				src = part
+			}
+		}
+	}
+	f, err := os.CreateTemp("", "goconvertis2-*.is2")
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n == 0 {
+		err = fmt.Errorf("The file is empty.")
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// encodeOutput encodes the output of the frame. It returns the data and
+// its content type.
+func encodeOutput(frame *Thermogram, output string, opts Options) ([]byte, string, error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatJPEG
+	}
+	meta := frame.Metadata.measurement(frame, opts)
+	switch output {
+	case OutputVisual:
+		data, err := encodeVisual(frame, format, opts, meta)
+		return data, ContentType(format), err
+	case OutputFusion:
+		data, err := encodeImage(renderFusion(frame, frame.Visual, opts), format, opts, meta)
+		return data, ContentType(format), err
+	case OutputCSV:
+		var buf bytes.Buffer
+		err := frame.WriteCSV(&buf)
+		return buf.Bytes(), "text/csv; charset=utf-8", err
+	case OutputJSON:
+		var buf bytes.Buffer
+		err := frame.WriteJSON(&buf, opts)
+		return buf.Bytes(), "application/json", err
+	case OutputWAV:
+		return wavData(frame.Audio, frame.AudioRate), "audio/wav", nil
+	}
+	img, err := renderIR(frame, frame.Visual, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := encodeImage(img, format, opts, meta)
+	return data, ContentType(format), err
+}
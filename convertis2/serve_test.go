@@ -0,0 +1,96 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerConvert(t *testing.T) {
+	old := testOldIS2(testRaw(1320, 2093))
+	uniform := make([]uint16, 320*240)
+	for i := range uniform {
+		uniform[i] = 1500
+	}
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		body   []byte
+		status int
+		// width of the answered jpeg, 0 skips the check
+		width int
+		// text of the error message
+		text string
+	}{
+		{"default", http.MethodPost, "", old, http.StatusOK, 390, ""},
+		{"width", http.MethodPost, "width=780", old, http.StatusOK, 780, ""},
+		{"max. width", http.MethodPost, "width=1560", old, http.StatusOK, 1560, ""},
+		{"width too large", http.MethodPost, "width=1561", old, http.StatusBadRequest, 0, "up to 1560"},
+		{"width 0", http.MethodPost, "width=0", old, http.StatusBadRequest, 0, "up to 1560"},
+		{"uniform picture", http.MethodPost, "scale=auto", testOldIS2(uniform), http.StatusOK, 390, ""},
+		{"bad scale", http.MethodPost, "scale=50,10", old, http.StatusBadRequest, 0, "scale must be"},
+		{"unknown output", http.MethodPost, "output=gif", old, http.StatusBadRequest, 0, "unknown output"},
+		{"unknown format", http.MethodPost, "", []byte("no picture"), http.StatusUnsupportedMediaType, 0, ""},
+		{"truncated file", http.MethodPost, "", old[:20000], http.StatusUnprocessableEntity, 0, "Can't decode the file. upload: is2-old: Can't decode infrared data."},
+		{"empty file", http.MethodPost, "", nil, http.StatusBadRequest, 0, "empty"},
+		{"GET", http.MethodGet, "", nil, http.StatusMethodNotAllowed, 0, "POST"},
+	}
+	s := NewServer(ServeOptions{Options: Options{Logger: discard}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/convert?"+tt.query, bytes.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			body := rec.Body.String()
+			if strings.Contains(body, "%!") {
+				t.Errorf("bad format of the message %q", body)
+			}
+			if !strings.Contains(body, tt.text) {
+				t.Errorf("message %q, want %q", body, tt.text)
+			}
+			if tt.width == 0 {
+				return
+			}
+			img, err := jpeg.Decode(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != tt.width {
+				t.Errorf("width %d, want %d", img.Bounds().Dx(), tt.width)
+			}
+		})
+	}
+}
+
+func TestServerHealth(t *testing.T) {
+	s := NewServer(ServeOptions{})
+	tests := []struct {
+		path   string
+		ready  bool
+		status int
+	}{
+		{"/healthz", true, http.StatusOK},
+		{"/readyz", true, http.StatusOK},
+		{"/healthz", false, http.StatusOK},
+		{"/readyz", false, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		s.SetReady(tt.ready)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s ready %t: status %d, want %d", tt.path, tt.ready, rec.Code, tt.status)
+		}
+	}
+}
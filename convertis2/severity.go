@@ -0,0 +1,240 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Measures of the rules
+const (
+	// MeasureMax is the max temperature of the picture
+	MeasureMax = "max"
+	// MeasureDeltaT is the max temperature of the picture minus the
+	// reference
+	MeasureDeltaT = "delta_t"
+	// MeasureROIDeltaT is the max temperature of a ROI minus the reference
+	MeasureROIDeltaT = "roi_delta_t"
+	// MeasureSpotDeltaT is the temperature of a spot minus the reference. A
+	// spot is a ROI without a size.
+	MeasureSpotDeltaT = "spot_delta_t"
+)
+
+// SeverityNone is the severity of a picture without findings
+const SeverityNone = "none"
+
+// referenceMean is the name of the mean of the picture as reference
+const referenceMean = "mean"
+
+// Rule assigns a severity to the pictures with a measure above a threshold
+type Rule struct {
+	Severity string `json:"severity"`
+	// Measure is one of max, delta_t, roi_delta_t and spot_delta_t
+	Measure string `json:"measure"`
+	// ROI limits the roi and spot measures to the ROIs of this name. Empty
+	// selects all ROIs.
+	ROI string `json:"roi,omitempty"`
+	// Above is the threshold in °C or K
+	Above float64 `json:"above"`
+}
+
+// RuleSet is a set of rules with its severities
+type RuleSet struct {
+	Name string `json:"name"`
+	// Severities from the lowest to the highest
+	Severities []string `json:"severities"`
+	// Critical is the lowest critical severity
+	Critical string `json:"critical"`
+	Rules    []Rule `json:"rules"`
+}
+
+// DefaultRuleSet classifies the delta T after the NETA classes for similar
+// components under similar load. The delta T needs a reference, see
+// Classify.
+var DefaultRuleSet = &RuleSet{
+	Name:       "NETA",
+	Severities: []string{"possible deficiency", "probable deficiency", "major discrepancy"},
+	Critical:   "major discrepancy",
+	Rules: []Rule{
+		{Severity: "possible deficiency", Measure: MeasureDeltaT, Above: 1},
+		{Severity: "probable deficiency", Measure: MeasureDeltaT, Above: 3},
+		{Severity: "major discrepancy", Measure: MeasureDeltaT, Above: 15},
+		{Severity: "possible deficiency", Measure: MeasureROIDeltaT, Above: 1},
+		{Severity: "probable deficiency", Measure: MeasureROIDeltaT, Above: 3},
+		{Severity: "major discrepancy", Measure: MeasureROIDeltaT, Above: 15},
+		{Severity: "possible deficiency", Measure: MeasureSpotDeltaT, Above: 1},
+		{Severity: "probable deficiency", Measure: MeasureSpotDeltaT, Above: 3},
+		{Severity: "major discrepancy", Measure: MeasureSpotDeltaT, Above: 15},
+	},
+}
+
+// ReadRuleSet reads a JSON rule set
+func ReadRuleSet(filename string) (*RuleSet, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rs RuleSet
+	err = json.Unmarshal(data, &rs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad rule set. %w", filename, err)
+	}
+	err = rs.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &rs, nil
+}
+
+// Validate checks the rule set
+func (rs *RuleSet) Validate() error {
+	if rs.Critical != "" && rs.level(rs.Critical) == 0 {
+		return fmt.Errorf("%s: unknown critical severity.", rs.Critical)
+	}
+	for _, r := range rs.Rules {
+		if rs.level(r.Severity) == 0 {
+			return fmt.Errorf("%s: unknown severity of a rule.", r.Severity)
+		}
+		switch r.Measure {
+		case MeasureMax, MeasureDeltaT, MeasureROIDeltaT, MeasureSpotDeltaT:
+		default:
+			return fmt.Errorf("%s: unknown measure of a rule.", r.Measure)
+		}
+	}
+	return nil
+}
+
+// level returns the rank of a severity, 1 for the lowest and 0 for an
+// unknown severity
+func (rs *RuleSet) level(severity string) int {
+	for i, s := range rs.Severities {
+		if strings.EqualFold(s, severity) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Finding is a measure above the threshold of a rule
+type Finding struct {
+	Rule Rule `json:"rule"`
+	// Subject is the ROI of the measure, empty for the picture
+	Subject string  `json:"subject,omitempty"`
+	Value   float64 `json:"value"`
+}
+
+// Classification is the severity of a picture
+type Classification struct {
+	RuleSet  string `json:"rule_set"`
+	Severity string `json:"severity"`
+	// Level is the rank of the severity in the rule set, 0 for none
+	Level    int       `json:"level"`
+	Critical bool      `json:"critical"`
+	Findings []Finding `json:"findings,omitempty"`
+	// Reference is the name of the reference of the delta-T rules.
+	// NoReference reports delta-T rules skipped without a reference.
+	Reference   string `json:"reference,omitempty"`
+	NoReference bool   `json:"no_reference,omitempty"`
+}
+
+// Reference returns the temperature the delta-T measures refer to and its
+// name. It is the mean of the ROI named ref, the ambient temperature or
+// the mean of the picture. A nil ambient has none.
+func (t *Thermogram) Reference(ambient *float64) (float64, string) {
+	for _, roi := range t.ROIs {
+		if strings.EqualFold(roi.Name, "ref") {
+			return t.Region(roi).Mean, roi.Name
+		}
+	}
+	if ambient != nil {
+		return *ambient, "ambient"
+	}
+	return t.Mean(), referenceMean
+}
+
+// Classify evaluates the rules for the picture. Of every measure only the
+// rule with the highest severity is a finding. The severity of the picture
+// is the highest severity of the findings. The delta-T rules need a ROI
+// named ref or an ambient temperature. The hottest pixel minus the mean of
+// the picture is no reference, so without both they are skipped.
+func (rs *RuleSet) Classify(t *Thermogram, ambient *float64) Classification {
+	c := Classification{RuleSet: rs.Name, Severity: SeverityNone}
+	reference, name := t.Reference(ambient)
+	if name != referenceMean {
+		c.Reference = name
+	}
+	for _, r := range rs.Rules {
+		if r.Measure != MeasureMax && c.Reference == "" {
+			c.NoReference = true
+			continue
+		}
+		for _, m := range measures(t, r, reference) {
+			if m.Value <= r.Above {
+				continue
+			}
+			c.add(rs, Finding{Rule: r, Subject: m.Subject, Value: m.Value})
+		}
+	}
+	for _, f := range c.Findings {
+		if level := rs.level(f.Rule.Severity); level > c.Level {
+			c.Level, c.Severity = level, f.Rule.Severity
+		}
+	}
+	c.Critical = rs.Critical != "" && c.Level >= rs.level(rs.Critical)
+	return c
+}
+
+// add adds the finding f. A finding of the same measure and subject with
+// a lower severity is replaced.
+func (c *Classification) add(rs *RuleSet, f Finding) {
+	for i, g := range c.Findings {
+		if g.Rule.Measure == f.Rule.Measure && g.Subject == f.Subject {
+			if rs.level(g.Rule.Severity) < rs.level(f.Rule.Severity) {
+				c.Findings[i] = f
+			}
+			return
+		}
+	}
+	c.Findings = append(c.Findings, f)
+}
+
+// SubjectLevel returns the highest severity of the findings of a ROI
+func (c *Classification) SubjectLevel(rs *RuleSet, subject string) (string, int) {
+	severity, level := SeverityNone, 0
+	for _, f := range c.Findings {
+		if l := rs.level(f.Rule.Severity); f.Subject == subject && l > level {
+			severity, level = f.Rule.Severity, l
+		}
+	}
+	return severity, level
+}
+
+// measure is a value of a rule measure
+type measure struct {
+	Subject string
+	Value   float64
+}
+
+// measures returns the values of the measure of r
+func measures(t *Thermogram, r Rule, reference float64) []measure {
+	switch r.Measure {
+	case MeasureMax:
+		return []measure{{Value: t.Max()}}
+	case MeasureDeltaT:
+		return []measure{{Value: t.Max() - reference}}
+	}
+	var ms []measure
+	for _, roi := range t.ROIs {
+		spot := roi.Width == 0 || roi.Height == 0
+		if (r.Measure == MeasureSpotDeltaT) != spot || (r.ROI != "" && !strings.EqualFold(r.ROI, roi.Name)) {
+			continue
+		}
+		ms = append(ms, measure{Subject: roi.Name, Value: t.Region(roi).Max.Temperature - reference})
+	}
+	return ms
+}
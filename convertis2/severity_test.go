@@ -0,0 +1,96 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	// The picture is 30 °C with a 40 °C block at 10,10 of 5x5 pixels.
+	frame := func(rois ...ROI) *Thermogram {
+		f := testTemperatures(40, 30, func(x, y int) float64 {
+			if x >= 10 && x < 15 && y >= 10 && y < 15 {
+				return 40
+			}
+			return 30
+		})
+		f.ROIs = rois
+		return f
+	}
+	ambient := func(v float64) *float64 {
+		return &v
+	}
+	maxRules := &RuleSet{
+		Name:       "max",
+		Severities: []string{"watch", "alarm"},
+		Critical:   "alarm",
+		Rules: []Rule{
+			{Severity: "watch", Measure: MeasureMax, Above: 35},
+			{Severity: "alarm", Measure: MeasureMax, Above: 45},
+			{Severity: "alarm", Measure: MeasureDeltaT, Above: 5},
+		},
+	}
+	tests := []struct {
+		name        string
+		rules       *RuleSet
+		frame       *Thermogram
+		ambient     *float64
+		severity    string
+		critical    bool
+		reference   string
+		noReference bool
+		findings    int
+	}{
+		{"default without reference", DefaultRuleSet, frame(), nil, SeverityNone, false, "", true, 0},
+		{"default with ambient", DefaultRuleSet, frame(), ambient(20), "major discrepancy", true, "ambient", false, 1},
+		{"default with low ambient difference", DefaultRuleSet, frame(), ambient(38), "possible deficiency", false, "ambient", false, 1},
+		{"default with ref ROI", DefaultRuleSet, frame(ROI{Name: "ref", X: 20, Y: 20, Width: 5, Height: 5}), nil, "probable deficiency", false, "ref", false, 1},
+		{"ref ROI before ambient", DefaultRuleSet, frame(ROI{Name: "Ref", X: 20, Y: 20, Width: 5, Height: 5}), ambient(39), "probable deficiency", false, "Ref", false, 1},
+		{"ROI and spot", DefaultRuleSet, frame(
+			ROI{Name: "ref", X: 20, Y: 20, Width: 5, Height: 5},
+			ROI{Name: "busbar", X: 8, Y: 8, Width: 4, Height: 4},
+			ROI{Name: "screw", X: 0, Y: 0},
+		), nil, "probable deficiency", false, "ref", false, 2},
+		{"max rules without reference", maxRules, frame(), nil, "watch", false, "", true, 1},
+		{"max rules with ambient", maxRules, frame(), ambient(30), "alarm", true, "ambient", false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.rules.Classify(tt.frame, tt.ambient)
+			if c.Severity != tt.severity || c.Critical != tt.critical {
+				t.Errorf("severity %s critical %t, want %s %t", c.Severity, c.Critical, tt.severity, tt.critical)
+			}
+			if c.Reference != tt.reference || c.NoReference != tt.noReference {
+				t.Errorf("reference %q %t, want %q %t", c.Reference, c.NoReference, tt.reference, tt.noReference)
+			}
+			if len(c.Findings) != tt.findings {
+				t.Errorf("%d findings, want %d: %+v", len(c.Findings), tt.findings, c.Findings)
+			}
+		})
+	}
+}
+
+func TestRuleSetValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rs   RuleSet
+		ok   bool
+	}{
+		{"default", *DefaultRuleSet, true},
+		{"unknown critical", RuleSet{Severities: []string{"a"}, Critical: "b"}, false},
+		{"unknown severity", RuleSet{Severities: []string{"a"}, Rules: []Rule{{Severity: "b", Measure: MeasureMax}}}, false},
+		{"unknown measure", RuleSet{Severities: []string{"a"}, Rules: []Rule{{Severity: "a", Measure: "min"}}}, false},
+		{"case of the severity", RuleSet{Severities: []string{"Alarm"}, Critical: "alarm", Rules: []Rule{{Severity: "ALARM", Measure: MeasureDeltaT}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rs.Validate()
+			if (err == nil) != tt.ok {
+				t.Errorf("error %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
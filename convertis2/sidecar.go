@@ -0,0 +1,234 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sidecarExtensions are appended to the file name of a picture to find its
+// sidecar, e.g. IR00012.IS2.json. The first existing sidecar is read.
+var sidecarExtensions = []string{".json", ".yaml", ".yml"}
+
+// Sidecar is the description of a picture in a json or yaml file next to
+// it. Decode applies the sidecar of a file.
+type Sidecar struct {
+	// Asset is the ID of the inspected asset
+	Asset string `json:"asset,omitempty" yaml:"asset,omitempty"`
+	// Emission and Background override the parameters stored in the file.
+	// An emission of 0 and a nil background keep them.
+	Emission   float64  `json:"emission,omitempty" yaml:"emission,omitempty"`
+	Background *float64 `json:"background,omitempty" yaml:"background,omitempty"`
+	// Alignment of the infrared picture in the visual picture, nil selects
+	// the default alignment
+	Alignment *Alignment `json:"alignment,omitempty" yaml:"alignment,omitempty"`
+	// ROIs replace the stored ROIs of the same name, the others are added.
+	// A ROI without a size is a named spot.
+	ROIs []ROI `json:"rois,omitempty" yaml:"rois,omitempty"`
+	// EmissionMask is a grayscale mask of the emission factors, see
+	// ReadEmissionMask. A relative path starts at the sidecar.
+	EmissionMask string `json:"emission_mask,omitempty" yaml:"emission_mask,omitempty"`
+	// Notes are added to the stored annotations
+	Notes []string `json:"notes,omitempty" yaml:"notes,omitempty"`
+	// dir is the directory of the sidecar
+	dir string
+}
+
+// SidecarPath returns the path of the sidecar of filename. Without a
+// sidecar it returns the path of a new json sidecar.
+func SidecarPath(filename string) string {
+	for _, ext := range sidecarExtensions {
+		if _, err := os.Stat(filename + ext); err == nil {
+			return filename + ext
+		}
+	}
+	return filename + sidecarExtensions[0]
+}
+
+// ReadSidecar reads the sidecar of filename. It returns nil without a
+// sidecar.
+func ReadSidecar(filename string) (*Sidecar, error) {
+	path := SidecarPath(filename)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &Sidecar{dir: filepath.Dir(path)}
+	if isYAML(path) {
+		err = yaml.Unmarshal(data, s)
+	} else {
+		err = json.Unmarshal(data, s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad sidecar. %w", path, err)
+	}
+	err = s.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// WriteSidecar writes the sidecar of filename. An existing sidecar is
+// replaced in its format, a new sidecar is json.
+func WriteSidecar(filename string, s *Sidecar) error {
+	path := SidecarPath(filename)
+	var data []byte
+	var err error
+	if isYAML(path) {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(s)
+		data = buf.Bytes()
+	} else {
+		data, err = json.MarshalIndent(s, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0666)
+}
+
+// isYAML reports whether path has the extension of yaml files
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Validate checks the sidecar
+func (s *Sidecar) Validate() error {
+	if s.Emission < 0 || s.Emission > 1 {
+		return fmt.Errorf("Emission must be between 0 and 1.")
+	}
+	for _, roi := range s.ROIs {
+		if roi.Name == "" {
+			return fmt.Errorf("ROI at %d,%d has no name.", roi.X, roi.Y)
+		}
+		if roi.Width < 0 || roi.Height < 0 {
+			return fmt.Errorf("%s: ROI size must not be negative.", roi.Name)
+		}
+		if roi.Emission < 0 || roi.Emission > 1 {
+			return fmt.Errorf("%s: ROI emission must be between 0 and 1.", roi.Name)
+		}
+	}
+	return nil
+}
+
+// Update sets the asset, the parameters and the alignment and adds the ROIs
+// and the notes to the sidecar. An empty asset, nil params and a nil
+// alignment keep them. ROIs replace the ROIs of the same name, notes already
+// in the sidecar are skipped.
+func (s *Sidecar) Update(asset string, params *Params, align *Alignment, rois []ROI, notes []string) {
+	if asset != "" {
+		s.Asset = asset
+	}
+	if params != nil {
+		background := params.Background
+		s.Emission, s.Background = params.Emission, &background
+	}
+	if align != nil {
+		s.Alignment = align
+	}
+	s.ROIs = mergeROIs(s.ROIs, rois)
+	for _, note := range notes {
+		if !slices.Contains(s.Notes, note) {
+			s.Notes = append(s.Notes, note)
+		}
+	}
+}
+
+// overridesParams reports whether the sidecar overrides the parameters
+func (s *Sidecar) overridesParams() bool {
+	return s.Emission != 0 || s.Background != nil
+}
+
+// apply applies the sidecar to the decoded picture. The parameters are
+// overridden only if the conversion has no explicit parameters p.
+func (s *Sidecar) apply(t *Thermogram, p Params) {
+	t.Sidecar = s
+	if p.Emission == 0 && s.overridesParams() {
+		params := t.Params
+		if s.Emission != 0 {
+			params.Emission = s.Emission
+		}
+		if s.Background != nil {
+			params.Background = *s.Background
+		}
+		t.SetParams(params)
+	}
+	t.Asset = s.Asset
+	if s.Alignment != nil {
+		t.Alignment = s.Alignment
+	}
+	t.ROIs = mergeROIs(t.ROIs, s.ROIs)
+	for _, note := range s.Notes {
+		if !slices.Contains(t.Annotations, note) {
+			t.Annotations = append(t.Annotations, note)
+		}
+	}
+}
+
+// Relocate keeps the relative path of the emission mask valid for a copy
+// of the sidecar in dir
+func (s *Sidecar) Relocate(dir string) {
+	if s.EmissionMask != "" && !filepath.IsAbs(s.EmissionMask) {
+		path := filepath.Join(s.dir, s.EmissionMask)
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			path = rel
+		} else if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		s.EmissionMask = path
+	}
+	s.dir = dir
+}
+
+// mask reads the emission mask of the sidecar. It returns nil without a
+// mask.
+func (s *Sidecar) mask() (image.Image, error) {
+	if s.EmissionMask == "" {
+		return nil, nil
+	}
+	path := s.EmissionMask
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.dir, path)
+	}
+	return ReadEmissionMask(path)
+}
+
+// mergeROIs returns the ROIs with the added ROIs. An added ROI replaces
+// the ROI of the same name.
+func mergeROIs(rois []ROI, added []ROI) []ROI {
+	merged := append([]ROI(nil), rois...)
+	for _, a := range added {
+		replaced := false
+		for i, roi := range merged {
+			if roi.Name == a.Name {
+				merged[i], replaced = a, true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, a)
+		}
+	}
+	return merged
+}
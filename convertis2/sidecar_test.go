@@ -0,0 +1,259 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSidecar(t *testing.T) {
+	background := 15.0
+	tests := []struct {
+		ext  string
+		data string
+		want *Sidecar
+		err  string
+	}{
+		{"", "", nil, ""},
+		{".json", `{"asset": "TR-1", "emission": 0.8, "rois": [{"name": "L1", "x": 1, "y": 2, "width": 3, "height": 4}], "notes": ["loose"]}`,
+			&Sidecar{Asset: "TR-1", Emission: 0.8, ROIs: []ROI{{Name: "L1", X: 1, Y: 2, Width: 3, Height: 4}}, Notes: []string{"loose"}}, ""},
+		{".yaml", "asset: TR-1\nbackground: 15\nalignment: {offset_x: 10, offset_y: 20, scale: 0.5}\nemission_mask: mask.png\n",
+			&Sidecar{Asset: "TR-1", Background: &background, Alignment: &Alignment{OffsetX: 10, OffsetY: 20, Scale: 0.5}, EmissionMask: "mask.png"}, ""},
+		{".yml", "rois:\n  - {name: spot, x: 5, y: 6}\n", &Sidecar{ROIs: []ROI{{Name: "spot", X: 5, Y: 6}}}, ""},
+		{".json", `{"asset": `, nil, "bad sidecar"},
+		{".yaml", "rois: 12\n", nil, "bad sidecar"},
+		{".json", `{"emission": 1.5}`, nil, "Emission must be between 0 and 1."},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(t.TempDir(), "IR00012.IS2")
+		if tt.ext != "" {
+			if err := os.WriteFile(filename+tt.ext, []byte(tt.data), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s, err := ReadSidecar(filename)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), filename+tt.ext) {
+				t.Errorf("%q: error %v, want %q", tt.data, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.data, err)
+			continue
+		}
+		if tt.want != nil {
+			tt.want.dir = filepath.Dir(filename)
+		}
+		if !reflect.DeepEqual(s, tt.want) {
+			t.Errorf("%q: %+v, want %+v", tt.data, s, tt.want)
+		}
+	}
+}
+
+func TestSidecarPath(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "IR00012.IS2")
+	if p := SidecarPath(filename); p != filename+".json" {
+		t.Errorf("path without a sidecar %s", p)
+	}
+	for _, ext := range []string{".yml", ".yaml", ".json"} {
+		if err := os.WriteFile(filename+ext, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if p := SidecarPath(filename); p != filename+ext {
+			t.Errorf("path %s, want %s", p, filename+ext)
+		}
+	}
+}
+
+func TestSidecarValidate(t *testing.T) {
+	tests := []struct {
+		sidecar Sidecar
+		err     string
+	}{
+		{Sidecar{}, ""},
+		{Sidecar{Emission: 1, ROIs: []ROI{{Name: "L1", Width: 2, Height: 2, Emission: 0.9}, {Name: "spot"}}}, ""},
+		{Sidecar{Emission: -0.1}, "Emission must be between 0 and 1."},
+		{Sidecar{ROIs: []ROI{{X: 3, Y: 4}}}, "ROI at 3,4 has no name."},
+		{Sidecar{ROIs: []ROI{{Name: "L1", Width: -1}}}, "L1: ROI size must not be negative."},
+		{Sidecar{ROIs: []ROI{{Name: "L1", Emission: 1.1}}}, "L1: ROI emission must be between 0 and 1."},
+	}
+	for _, tt := range tests {
+		err := tt.sidecar.Validate()
+		if (err == nil) != (tt.err == "") || err != nil && err.Error() != tt.err {
+			t.Errorf("%+v: error %v, want %q", tt.sidecar, err, tt.err)
+		}
+	}
+}
+
+func TestMergeROIs(t *testing.T) {
+	a := ROI{Name: "a", X: 1}
+	b := ROI{Name: "b", X: 2}
+	b2 := ROI{Name: "b", X: 20, Width: 5, Height: 5}
+	c := ROI{Name: "c", X: 3}
+	tests := []struct {
+		name  string
+		rois  []ROI
+		added []ROI
+		want  []ROI
+	}{
+		{"nothing", nil, nil, nil},
+		{"added", []ROI{a}, []ROI{c}, []ROI{a, c}},
+		{"replaced in place", []ROI{a, b}, []ROI{b2}, []ROI{a, b2}},
+		{"replaced and added", []ROI{b}, []ROI{c, b2}, []ROI{b2, c}},
+	}
+	for _, tt := range tests {
+		rois := append([]ROI(nil), tt.rois...)
+		got := mergeROIs(rois, tt.added)
+		if len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(rois, tt.rois) {
+			t.Errorf("%s: ROIs changed to %v", tt.name, rois)
+		}
+	}
+}
+
+func TestSidecarUpdate(t *testing.T) {
+	background := 10.0
+	s := Sidecar{
+		Asset:      "TR-1",
+		Emission:   0.8,
+		Background: &background,
+		ROIs:       []ROI{{Name: "L1", X: 1}},
+		Notes:      []string{"loose"},
+	}
+	s.Update("", nil, nil, nil, []string{"loose"})
+	if s.Asset != "TR-1" || s.Emission != 0.8 || *s.Background != 10 || s.Alignment != nil || len(s.ROIs) != 1 || len(s.Notes) != 1 {
+		t.Errorf("empty update changed the sidecar to %+v", s)
+	}
+	align := &Alignment{OffsetX: 5, OffsetY: 6, Scale: 0.7}
+	s.Update("TR-2", &Params{Emission: 0.9, Background: 0}, align, []ROI{{Name: "L1", X: 2}, {Name: "L2"}}, []string{"hot", "loose", "hot"})
+	want := Sidecar{
+		Asset:     "TR-2",
+		Emission:  0.9,
+		Alignment: align,
+		ROIs:      []ROI{{Name: "L1", X: 2}, {Name: "L2"}},
+		Notes:     []string{"loose", "hot"},
+	}
+	if s.Background == nil || *s.Background != 0 {
+		t.Errorf("background %v, want 0", s.Background)
+	}
+	s.Background = nil
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("%+v, want %+v", s, want)
+	}
+}
+
+func TestSidecarApply(t *testing.T) {
+	filename := writeTestFile(t, "old.IS2", testOldIS2(testRaw(1320, 2093)))
+	stored, err := DecodeLog(filename, Params{}, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidecar := "asset: TR-1\nemission: 0.8\nalignment: {offset_x: 1, offset_y: 2, scale: 0.5}\nrois:\n  - {name: L1, x: 190, y: 80, width: 20, height: 20}\nnotes: [loose terminal]\n"
+	if err := os.WriteFile(filename+".yaml", []byte(sidecar), 0666); err != nil {
+		t.Fatal(err)
+	}
+	explicit := Params{Emission: 0.9, Background: 30}
+	tests := []struct {
+		name   string
+		params Params
+		want   Params
+	}{
+		{"sidecar parameters", Params{}, Params{Emission: 0.8, Background: stored.Params.Background}},
+		{"explicit parameters", explicit, explicit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := DecodeLog(filename, tt.params, discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame.Params != tt.want {
+				t.Errorf("params %+v, want %+v", frame.Params, tt.want)
+			}
+			if frame.Sidecar == nil || frame.Asset != "TR-1" || frame.Alignment == nil || frame.Alignment.OffsetX != 1 {
+				t.Errorf("sidecar %v, asset %q, alignment %v", frame.Sidecar != nil, frame.Asset, frame.Alignment)
+			}
+			if n := len(frame.ROIs); n != len(stored.ROIs)+1 || frame.ROIs[n-1].Name != "L1" {
+				t.Errorf("ROIs %v", frame.ROIs)
+			}
+			if n := len(frame.Annotations); n == 0 || frame.Annotations[n-1] != "loose terminal" {
+				t.Errorf("annotations %v", frame.Annotations)
+			}
+		})
+	}
+}
+
+func TestWriteSidecar(t *testing.T) {
+	s := &Sidecar{Asset: "TR-1", Emission: 0.8, Notes: []string{"loose"}}
+	tests := []struct {
+		name     string
+		existing string
+		path     string
+		prefix   string
+	}{
+		{"new sidecar", "", ".json", "{\n  \"asset\": \"TR-1\""},
+		{"yaml sidecar", ".yaml", ".yaml", "asset: TR-1\nemission: 0.8\nnotes:\n  - loose\n"},
+		{"yml sidecar", ".yml", ".yml", "asset: TR-1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "IR00012.IS2")
+			if tt.existing != "" {
+				if err := os.WriteFile(filename+tt.existing, []byte("asset: old\n"), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := WriteSidecar(filename, s); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filename + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), tt.prefix) {
+				t.Errorf("%q, want the prefix %q", data, tt.prefix)
+			}
+			read, err := ReadSidecar(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read.dir = ""
+			if !reflect.DeepEqual(read, s) {
+				t.Errorf("read %+v, want %+v", read, s)
+			}
+		})
+	}
+}
+
+func TestSidecarRelocate(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(dir, "masks", "abs.png")
+	tests := []struct {
+		mask string
+		to   string
+		want string
+	}{
+		{"", "done", ""},
+		{"mask.png", "done", filepath.Join("..", "mask.png")},
+		{"masks/m.png", "masks", "m.png"},
+		{"mask.png", ".", "mask.png"},
+		{abs, "done", abs},
+	}
+	for _, tt := range tests {
+		s := &Sidecar{EmissionMask: tt.mask, dir: dir}
+		to := filepath.Join(dir, tt.to)
+		s.Relocate(to)
+		if s.EmissionMask != tt.want || s.dir != to {
+			t.Errorf("%q to %s: %q in %s, want %q", tt.mask, tt.to, s.EmissionMask, s.dir, tt.want)
+		}
+	}
+}
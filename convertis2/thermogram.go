@@ -0,0 +1,295 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+)
+
+// ErrFormat is returned by a decoder for files of another format
+var ErrFormat = errors.New("Unknown file format.")
+
+// Params are the parameters of the temperature conversion
+type Params struct {
+	// Background temperature in degree celsius
+	Background float64 `json:"background"`
+	// Emission factor of the object
+	Emission float64 `json:"emission"`
+}
+
+// DefaultParams are the parameters of files without stored parameters
+var DefaultParams = Params{Background: 20, Emission: 0.95}
+
+// resolve returns p. Params without an emission factor select the stored
+// parameters of the file or the default parameters.
+func (p Params) resolve(stored *Params) Params {
+	if p.Emission != 0 {
+		return p
+	}
+	if stored != nil {
+		return *stored
+	}
+	return DefaultParams
+}
+
+// Thermogram is a decoded infrared picture. Every decoder produces a
+// Thermogram, so rendering and analysis work the same for all formats.
+type Thermogram struct {
+	// Format is the name of the decoder
+	Format string
+	Width  int
+	Height int
+	// Temperatures in degree celsius, row by row
+	Temperatures []float64
+	// Raw values of the camera, row by row
+	Raw []uint16
+	// Position of the coldest and the hottest pixel
+	MinX, MinY int
+	MaxX, MaxY int
+	// Parameters of the temperature conversion
+	Params Params
+	// EmissionMap is the emission factor of every pixel, row by row. A nil
+	// map and pixels of 0 select the emission factor of Params.
+	EmissionMap []float64
+	// StoredParams are the parameters stored in the file, nil if it has
+	// none
+	StoredParams *Params
+	// Visual picture of the camera, nil if the file has none
+	Visual image.Image
+	// VisualJPEG is the visual picture as stored by the camera, nil if the
+	// file stores no jpeg
+	VisualJPEG []byte
+	// Audio is the voice annotation as 16 bit little endian mono samples
+	Audio     []byte
+	AudioRate int
+	// Metadata of the capture
+	Metadata *Metadata
+	// Alignment of the infrared picture in the visual picture stored in the
+	// sidecar, nil if it has none
+	Alignment *Alignment
+	// Regions of interest and text annotations of the sidecar
+	ROIs        []ROI
+	Annotations []string
+	// Asset is the ID of the inspected asset of the sidecar
+	Asset string
+	// Sidecar is the applied sidecar of the file, nil without one
+	Sidecar *Sidecar
+	// convert returns the temperature of a raw value
+	convert func(raw uint16, p Params) float64
+}
+
+// Decoder decodes a file format into a Thermogram
+type Decoder interface {
+	// Name returns the name of the format
+	Name() string
+	// Decode decodes the file. It returns ErrFormat if the file has
+	// another format. Problems that don't stop the decoding go to logger.
+	Decode(filename string, p Params, logger *log.Logger) (*Thermogram, error)
+}
+
+// Decoders are the known file formats in the order they are tried
+var Decoders = []Decoder{
+	newIS2Decoder{},
+	flirDecoder{},
+	oldIS2Decoder{},
+}
+
+// Decode decodes filename with the first decoder that knows the format
+// and applies the sidecar of the file. Params without an emission factor
+// select the parameters of the sidecar or stored in the file. The messages
+// of the decoders go to the standard logger.
+func Decode(filename string, p Params) (*Thermogram, error) {
+	return DecodeLog(filename, p, log.Default())
+}
+
+// DecodeLog decodes filename like Decode. The messages of the decoders go
+// to logger, e.g. the logger of a file of a batch.
+func DecodeLog(filename string, p Params, logger *log.Logger) (*Thermogram, error) {
+	sidecar, err := ReadSidecar(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range Decoders {
+		t, err := d.Decode(filename, p, logger)
+		if err == nil {
+			var mask image.Image
+			if sidecar != nil {
+				sidecar.apply(t, p)
+				mask, err = sidecar.mask()
+				if err != nil {
+					return nil, err
+				}
+			}
+			t.SetEmissionMask(mask)
+			return t, nil
+		}
+		if !errors.Is(err, ErrFormat) {
+			return nil, fmt.Errorf("%s: %s: %w", filename, d.Name(), err)
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", filename, ErrFormat)
+}
+
+// newThermogram converts the raw values with convert into a Thermogram
+func newThermogram(format string, width int, height int, raw []uint16, p Params, convert func(uint16, Params) float64) *Thermogram {
+	t := &Thermogram{
+		Format:       format,
+		Width:        width,
+		Height:       height,
+		Raw:          raw,
+		Temperatures: make([]float64, len(raw)),
+		convert:      convert,
+	}
+	t.SetParams(p)
+	return t
+}
+
+// SetParams converts the raw values again with the parameters p and the
+// emission map. Every raw value between the coldest and the hottest pixel
+// is converted once into a lookup table per emission factor.
+func (t *Thermogram) SetParams(p Params) {
+	t.Params = p
+	t.findExtremes()
+	if len(t.Raw) == 0 {
+		return
+	}
+	lo := t.Raw[t.MinY*t.Width+t.MinX]
+	hi := t.Raw[t.MaxY*t.Width+t.MaxX]
+	newLUT := func(e float64) []float64 {
+		lut := make([]float64, int(hi)-int(lo)+1)
+		for i := range lut {
+			lut[i] = t.convert(lo+uint16(i), Params{Background: p.Background, Emission: e})
+		}
+		return lut
+	}
+	lut := newLUT(p.Emission)
+	if t.EmissionMap == nil {
+		for i, v := range t.Raw {
+			t.Temperatures[i] = lut[v-lo]
+		}
+		return
+	}
+	luts := map[float64][]float64{p.Emission: lut}
+	for i, v := range t.Raw {
+		e := t.emission(i)
+		if luts[e] == nil {
+			luts[e] = newLUT(e)
+		}
+		t.Temperatures[i] = luts[e][v-lo]
+	}
+	// With several emission factors the hottest raw value is not always
+	// the hottest temperature.
+	t.findTemperatureExtremes()
+}
+
+// findExtremes finds the first coldest and the first hottest raw value, or
+// temperature without raw values
+func (t *Thermogram) findExtremes() {
+	if len(t.Raw) == 0 {
+		// Thermograms without raw values, e.g. differences, have only
+		// the temperatures.
+		t.findTemperatureExtremes()
+		return
+	}
+	minvalue := uint16(65535)
+	maxvalue := uint16(0)
+	for i, w := range t.Raw {
+		if minvalue > w {
+			minvalue = w
+			t.MinX, t.MinY = i%t.Width, i/t.Width
+		}
+		if maxvalue < w {
+			maxvalue = w
+			t.MaxX, t.MaxY = i%t.Width, i/t.Width
+		}
+	}
+}
+
+// findTemperatureExtremes finds the first coldest and the first hottest
+// temperature
+func (t *Thermogram) findTemperatureExtremes() {
+	t.MinX, t.MinY, t.MaxX, t.MaxY = 0, 0, 0, 0
+	for i, v := range t.Temperatures {
+		if v < t.Temperatures[t.MinY*t.Width+t.MinX] {
+			t.MinX, t.MinY = i%t.Width, i/t.Width
+		}
+		if v > t.Temperatures[t.MaxY*t.Width+t.MaxX] {
+			t.MaxX, t.MaxY = i%t.Width, i/t.Width
+		}
+	}
+}
+
+// apparent returns the temperature of the raw value at index i without
+// the correction of the emission factor
+func (t *Thermogram) apparent(i int) float64 {
+	return t.convert(t.Raw[i], Params{Background: t.Params.Background, Emission: 1})
+}
+
+// At returns the temperature at x, y. Positions outside of the picture are
+// clamped to the border.
+func (t *Thermogram) At(x int, y int) float64 {
+	x = min(max(x, 0), t.Width-1)
+	y = min(max(y, 0), t.Height-1)
+	return t.Temperatures[y*t.Width+x]
+}
+
+// Min returns the lowest temperature
+func (t *Thermogram) Min() float64 {
+	return t.At(t.MinX, t.MinY)
+}
+
+// Max returns the highest temperature
+func (t *Thermogram) Max() float64 {
+	return t.At(t.MaxX, t.MaxY)
+}
+
+// Mean returns the mean temperature
+func (t *Thermogram) Mean() float64 {
+	var sum float64
+	for _, v := range t.Temperatures {
+		sum += v
+	}
+	return sum / float64(len(t.Temperatures))
+}
+
+// RegionStats are the temperatures of a region of interest
+type RegionStats struct {
+	ROI
+	Min  Spot    `json:"min"`
+	Max  Spot    `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// Region returns the temperatures inside roi. A ROI without a size is the
+// spot at its position. The region is clipped to the picture.
+func (t *Thermogram) Region(roi ROI) RegionStats {
+	x0 := min(max(roi.X, 0), t.Width-1)
+	y0 := min(max(roi.Y, 0), t.Height-1)
+	x1 := min(max(roi.X+max(roi.Width, 1), x0+1), t.Width)
+	y1 := min(max(roi.Y+max(roi.Height, 1), y0+1), t.Height)
+	stats := RegionStats{
+		ROI: roi,
+		Min: Spot{Name: "min", X: x0, Y: y0, Temperature: t.At(x0, y0)},
+		Max: Spot{Name: "max", X: x0, Y: y0, Temperature: t.At(x0, y0)},
+	}
+	var sum float64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			v := t.At(x, y)
+			sum += v
+			if v < stats.Min.Temperature {
+				stats.Min.X, stats.Min.Y, stats.Min.Temperature = x, y, v
+			}
+			if v > stats.Max.Temperature {
+				stats.Max.X, stats.Max.Y, stats.Max.Temperature = x, y, v
+			}
+		}
+	}
+	stats.Mean = sum / float64((x1-x0)*(y1-y0))
+	return stats
+}
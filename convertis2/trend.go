@@ -0,0 +1,300 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAssetPattern takes the asset tag from the file name up to the
+// first underscore, e.g. SG01 of SG01_2024-03.IS2
+const DefaultAssetPattern = `^([^_]+)_`
+
+// TrendRecord is the result of a file in the trend store
+type TrendRecord struct {
+	Asset string `json:"asset"`
+	File  string `json:"file"`
+	// SHA256 is the checksum of the file, it identifies copies of a file
+	SHA256   string    `json:"sha256,omitempty"`
+	Captured time.Time `json:"captured"`
+	// Max temperature of the picture, the reference of the delta-T results
+	// and the max temperature minus the reference. Without a ROI named ref
+	// or an ambient temperature there is no reference and no delta T.
+	Max       float64    `json:"max"`
+	Reference *float64   `json:"reference,omitempty"`
+	DeltaT    *float64   `json:"delta_t,omitempty"`
+	ROIs      []TrendROI `json:"rois,omitempty"`
+}
+
+// TrendROI is the result of a ROI in the trend store
+type TrendROI struct {
+	Name   string   `json:"name"`
+	Max    float64  `json:"max"`
+	DeltaT *float64 `json:"delta_t,omitempty"`
+}
+
+// AssetTag returns the asset tag of filename. pattern is a regular
+// expression on the base name of the file, the first group is the tag.
+func AssetTag(filename string, pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("%s: bad asset pattern. %w", pattern, err)
+	}
+	m := re.FindStringSubmatch(filepath.Base(filename))
+	if len(m) < 2 || m[1] == "" {
+		return "", fmt.Errorf("%s: the file name has no asset tag.", filename)
+	}
+	return m[1], nil
+}
+
+// NewTrendRecord returns the trend record of the decoded file. The capture
+// time is the time of the file if the file has none, e.g. in the old IS2
+// format. The delta-T values are recorded against a ROI named ref or the
+// ambient temperature, without both they are left out.
+func NewTrendRecord(filename string, frame *Thermogram, asset string, ambient *float64) (*TrendRecord, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	reference, name := frame.Reference(ambient)
+	// delta returns the rounded delta T of t, nil without a reference
+	delta := func(t float64) *float64 {
+		if name == referenceMean {
+			return nil
+		}
+		d := round2(t - reference)
+		return &d
+	}
+	r := &TrendRecord{
+		Asset:  asset,
+		File:   filepath.Base(filename),
+		SHA256: fmt.Sprintf("%x", sha256.Sum256(data)),
+		Max:    round2(frame.Max()),
+		DeltaT: delta(frame.Max()),
+	}
+	if r.DeltaT != nil {
+		ref := round2(reference)
+		r.Reference = &ref
+	}
+	if frame.Metadata != nil {
+		r.Captured = frame.Metadata.DateTimeOriginal
+	}
+	if r.Captured.IsZero() {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		r.Captured = fi.ModTime()
+	}
+	for _, roi := range frame.ROIs {
+		stats := frame.Region(roi)
+		r.ROIs = append(r.ROIs, TrendROI{Name: roi.Name, Max: round2(stats.Max.Temperature), DeltaT: delta(stats.Max.Temperature)})
+	}
+	return r, nil
+}
+
+// ReadTrend reads the records of a JSON-lines trend store. A missing
+// store has no records.
+func ReadTrend(store string) ([]TrendRecord, error) {
+	f, err := os.Open(store)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []TrendRecord
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var r TrendRecord
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad record. %w", store, n, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// AppendTrend appends the records to the trend store. A record of a file
+// already in the store is skipped. Files are the same by their checksum,
+// records without one by the file name and the capture time. It returns
+// the number of records appended.
+func AppendTrend(store string, records ...TrendRecord) (int, error) {
+	old, err := ReadTrend(store)
+	if err != nil {
+		return 0, err
+	}
+	key := func(r TrendRecord) string {
+		if r.SHA256 != "" {
+			return r.SHA256
+		}
+		return r.File + "\x00" + r.Captured.UTC().Format(time.RFC3339Nano)
+	}
+	known := map[string]bool{}
+	for _, r := range old {
+		known[key(r)] = true
+	}
+	f, err := os.OpenFile(store, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	enc := json.NewEncoder(f)
+	for _, r := range records {
+		if known[key(r)] {
+			continue
+		}
+		known[key(r)] = true
+		err = enc.Encode(r)
+		if err != nil {
+			break
+		}
+		n++
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// TrendPoint is a value of a series at the capture time
+type TrendPoint struct {
+	Time  time.Time
+	Value float64
+	File  string
+}
+
+// TrendSeries is a measure of an asset over time
+type TrendSeries struct {
+	Asset string
+	// Name is max or delta_t of the picture or of a ROI, e.g. busbar max
+	Name string
+	// DeltaT reports a delta-T series, the others are temperatures
+	DeltaT bool
+	Points []TrendPoint
+	// Slope of the linear regression in K per year
+	Slope float64
+	// Rising is set for a series of three or more points with a slope
+	// above the limit
+	Rising bool
+}
+
+// Trends groups the records into the series of every asset ordered by the
+// capture time. Series with a slope above rise K per year are rising.
+func Trends(records []TrendRecord, rise float64) []TrendSeries {
+	records = append([]TrendRecord(nil), records...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Captured.Before(records[j].Captured)
+	})
+	index := map[string]int{}
+	var series []TrendSeries
+	add := func(asset string, name string, deltaT bool, p TrendPoint) {
+		k := asset + "\x00" + name
+		i, ok := index[k]
+		if !ok {
+			i = len(series)
+			index[k] = i
+			series = append(series, TrendSeries{Asset: asset, Name: name, DeltaT: deltaT})
+		}
+		series[i].Points = append(series[i].Points, p)
+	}
+	for _, r := range records {
+		add(r.Asset, "max", false, TrendPoint{r.Captured, r.Max, r.File})
+		if r.DeltaT != nil {
+			add(r.Asset, "delta_t", true, TrendPoint{r.Captured, *r.DeltaT, r.File})
+		}
+		for _, roi := range r.ROIs {
+			add(r.Asset, roi.Name+" max", false, TrendPoint{r.Captured, roi.Max, r.File})
+			if roi.DeltaT != nil {
+				add(r.Asset, roi.Name+" delta_t", true, TrendPoint{r.Captured, *roi.DeltaT, r.File})
+			}
+		}
+	}
+	for i := range series {
+		s := &series[i]
+		s.Slope = slope(s.Points)
+		s.Rising = len(s.Points) >= 3 && s.Slope > rise
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i].Asset < series[j].Asset
+	})
+	return series
+}
+
+// slope returns the slope of the linear regression of the points in K per
+// year
+func slope(points []TrendPoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	const year = 365.25 * 24
+	var sx, sy, sxx, sxy float64
+	t0 := points[0].Time
+	for _, p := range points {
+		x := p.Time.Sub(t0).Hours() / year
+		sx += x
+		sy += p.Value
+		sxx += x * x
+		sxy += x * p.Value
+	}
+	n := float64(len(points))
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0
+	}
+	// + 0 turns a rounded -0 into 0
+	return round2((n*sxy-sx*sy)/d) + 0
+}
+
+// String returns the summary of the series as text
+func (s TrendSeries) String() string {
+	first, last := s.Points[0], s.Points[len(s.Points)-1]
+	text := fmt.Sprintf("%s %s: %d points, %.1f to %.1f, %+.1f K/year", s.Asset, s.Name, len(s.Points), first.Value, last.Value, s.Slope)
+	if s.Rising {
+		text += ", rising"
+	}
+	return text
+}
+
+// WriteTrendCSV writes the points of the series as comma separated values
+// with a header, one point per line
+func WriteTrendCSV(w io.Writer, series []TrendSeries) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"asset", "series", "captured", "file", "value", "slope_per_year", "rising"})
+	for _, s := range series {
+		for _, p := range s.Points {
+			cw.Write([]string{
+				s.Asset,
+				s.Name,
+				p.Time.Format(time.RFC3339),
+				p.File,
+				strconv.FormatFloat(p.Value, 'f', 2, 64),
+				strconv.FormatFloat(s.Slope, 'f', 2, 64),
+				strconv.FormatBool(s.Rising),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"time"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// trendColors are the colors of the series of a chart
+var trendColors = []string{"#d62728", "#1f77b4", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"}
+
+// RenderTrend charts the series of an asset over the capture time, the
+// temperatures in the upper and the delta-T series in the lower panel.
+// Rising series are drawn bold and marked in the legend. width is the
+// width of the chart in pixels, 0 selects 900.
+func RenderTrend(asset string, series []TrendSeries, width int) (image.Image, error) {
+	if width <= 0 {
+		width = 900
+	}
+	s := float64(width) / 900
+	font, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	fontbold, err := truetype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	var temperatures, deltas []TrendSeries
+	t0, t1 := time.Time{}, time.Time{}
+	for _, ts := range series {
+		if ts.Asset != asset || len(ts.Points) == 0 {
+			continue
+		}
+		if ts.DeltaT {
+			deltas = append(deltas, ts)
+		} else {
+			temperatures = append(temperatures, ts)
+		}
+		if first := ts.Points[0].Time; t0.IsZero() || first.Before(t0) {
+			t0 = first
+		}
+		if last := ts.Points[len(ts.Points)-1].Time; last.After(t1) {
+			t1 = last
+		}
+	}
+	if t0.IsZero() {
+		return nil, fmt.Errorf("%s: no records of the asset.", asset)
+	}
+	if !t1.After(t0) {
+		t0, t1 = t0.Add(-24*time.Hour), t1.Add(24*time.Hour)
+	}
+	height := int(math.Round(640 * s))
+	dc := gg.NewContext(width, height)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetFontFace(truetype.NewFace(fontbold, &truetype.Options{Size: 16 * s}))
+	dc.SetRGB(0, 0, 0)
+	dc.DrawStringAnchored(asset, float64(width)/2, 20*s, 0.5, 0.5)
+	dc.SetFontFace(truetype.NewFace(font, &truetype.Options{Size: 12 * s}))
+	// panel draws the series into a panel, or the note empty without series
+	panel := func(title string, unit string, series []TrendSeries, empty string, top float64) {
+		x0, x1 := 70*s, float64(width)-200*s
+		y0, y1 := top, top+230*s
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, ts := range series {
+			for _, p := range ts.Points {
+				lo, hi = math.Min(lo, p.Value), math.Max(hi, p.Value)
+			}
+		}
+		if len(series) == 0 {
+			lo, hi = 0, 1
+		}
+		if hi-lo < 1 {
+			lo, hi = (lo+hi)/2-0.5, (lo+hi)/2+0.5
+		}
+		pad := (hi - lo) * 0.1
+		lo, hi = lo-pad, hi+pad
+		px := func(t time.Time) float64 {
+			return x0 + (x1-x0)*float64(t.Sub(t0))/float64(t1.Sub(t0))
+		}
+		py := func(v float64) float64 {
+			return y1 - (y1-y0)*(v-lo)/(hi-lo)
+		}
+		// grid and axes
+		dc.SetLineWidth(s)
+		for i := 0; i <= 5; i++ {
+			v := lo + (hi-lo)*float64(i)/5
+			dc.SetRGB(0.85, 0.85, 0.85)
+			dc.DrawLine(x0, py(v), x1, py(v))
+			dc.Stroke()
+			dc.SetRGB(0, 0, 0)
+			dc.DrawStringAnchored(fmt.Sprintf("%.1f", v), x0-6*s, py(v), 1, 0.35)
+		}
+		for i := 0; i <= 4; i++ {
+			t := t0.Add(time.Duration(float64(t1.Sub(t0)) * float64(i) / 4))
+			dc.SetRGB(0.85, 0.85, 0.85)
+			dc.DrawLine(px(t), y0, px(t), y1)
+			dc.Stroke()
+			dc.SetRGB(0, 0, 0)
+			dc.DrawStringAnchored(t.Format("2006-01-02"), px(t), y1+14*s, 0.5, 0.5)
+		}
+		dc.SetRGB(0, 0, 0)
+		dc.DrawRectangle(x0, y0, x1-x0, y1-y0)
+		dc.Stroke()
+		dc.DrawStringAnchored(fmt.Sprintf("%s in %s", title, unit), x0, y0-10*s, 0, 0.5)
+		if len(series) == 0 {
+			dc.DrawStringAnchored(empty, (x0+x1)/2, (y0+y1)/2, 0.5, 0.5)
+		}
+		// series and legend
+		for i, ts := range series {
+			r, g, b := HTMLColorToRGB(trendColors[i%len(trendColors)])
+			dc.SetRGB255(int(r), int(g), int(b))
+			dc.SetLineWidth(1.5 * s)
+			if ts.Rising {
+				dc.SetLineWidth(3 * s)
+			}
+			for j, p := range ts.Points {
+				if j == 0 {
+					dc.MoveTo(px(p.Time), py(p.Value))
+				} else {
+					dc.LineTo(px(p.Time), py(p.Value))
+				}
+			}
+			dc.Stroke()
+			for _, p := range ts.Points {
+				dc.DrawCircle(px(p.Time), py(p.Value), 3*s)
+				dc.Fill()
+			}
+			ly := y0 + 8*s + float64(i)*18*s
+			if ly > y1 {
+				continue
+			}
+			dc.DrawRectangle(x1+12*s, ly-5*s, 14*s, 10*s)
+			dc.Fill()
+			dc.SetRGB(0, 0, 0)
+			label := fmt.Sprintf("%s %+.1f/y", ts.Name, ts.Slope)
+			if ts.Rising {
+				label += " rising"
+			}
+			dc.DrawStringAnchored(label, x1+32*s, ly, 0, 0.35)
+		}
+	}
+	panel("Max. temperature", "°C", temperatures, "", 60*s)
+	panel("Delta T", "K", deltas, "No reference, the files have no ROI named ref and were recorded without -ambient.", 360*s)
+	return dc.Image(), nil
+}
+
+// WriteTrendChart charts the series of an asset like RenderTrend and
+// writes the chart to filename
+func WriteTrendChart(filename string, asset string, series []TrendSeries, width int) error {
+	img, err := RenderTrend(asset, series, width)
+	if err != nil {
+		return err
+	}
+	return writeImage(filename, img, Options{}, nil)
+}
@@ -0,0 +1,214 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssetTag(t *testing.T) {
+	tests := []struct {
+		filename string
+		pattern  string
+		want     string
+		ok       bool
+	}{
+		{"inspections/SG01_2024-03.IS2", DefaultAssetPattern, "SG01", true},
+		{"SG01_2024_03.IS2", DefaultAssetPattern, "SG01", true},
+		{"IR000123.IS2", DefaultAssetPattern, "", false},
+		{"site-TR7-2024.IS2", `-(TR\d+)-`, "TR7", true},
+		{"site.IS2", `(`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := AssetTag(tt.filename, tt.pattern)
+			if (err == nil) != tt.ok || got != tt.want {
+				t.Errorf("%q, %v, want %q ok %t", got, err, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewTrendRecordOldFormat(t *testing.T) {
+	filename := writeTestFile(t, "SG01_a.IS2", testOldIS2(testRaw(1320, 2093)))
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	err := os.Chtimes(filename, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := Decode(filename, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !frame.Metadata.DateTimeOriginal.IsZero() {
+		t.Errorf("old format captured at %v, want no time", frame.Metadata.DateTimeOriginal)
+	}
+	r, err := NewTrendRecord(filename, frame, "SG01", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Captured.Equal(mtime) {
+		t.Errorf("captured %v, want the file time %v", r.Captured, mtime)
+	}
+	if len(r.SHA256) != 64 {
+		t.Errorf("checksum %q", r.SHA256)
+	}
+}
+
+func TestNewTrendRecordReference(t *testing.T) {
+	filename := writeTestFile(t, "SG01_a.IS2", testOldIS2(testRaw(1320, 2093)))
+	frame, err := Decode(filename, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame.ROIs = []ROI{{Name: "busbar", X: 10, Y: 10, Width: 20, Height: 20}}
+	r, err := NewTrendRecord(filename, frame, "SG01", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Reference != nil || r.DeltaT != nil || r.ROIs[0].DeltaT != nil {
+		t.Errorf("delta T %v of the picture, %v of busbar without a reference", r.DeltaT, r.ROIs[0].DeltaT)
+	}
+	if series := Trends([]TrendRecord{*r}, 2); len(series) != 2 {
+		t.Errorf("%d series without a reference, want the max of the picture and of busbar", len(series))
+	}
+	ambient := 20.0
+	r, err = NewTrendRecord(filename, frame, "SG01", &ambient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Reference == nil || *r.Reference != 20 || r.DeltaT == nil || math.Abs(*r.DeltaT-(r.Max-20)) > 0.005 {
+		t.Errorf("reference %v delta T %v, want the ambient temperature", r.Reference, r.DeltaT)
+	}
+	if d := r.ROIs[0].DeltaT; d == nil || math.Abs(*d-(r.ROIs[0].Max-20)) > 0.005 {
+		t.Errorf("delta T of busbar %v, want %.2f", d, r.ROIs[0].Max-20)
+	}
+	frame.ROIs = append(frame.ROIs, ROI{Name: "ref", X: 100, Y: 100, Width: 20, Height: 20})
+	r, err = NewTrendRecord(filename, frame, "SG01", &ambient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref := frame.Region(frame.ROIs[1]).Mean; r.Reference == nil || math.Abs(*r.Reference-ref) > 0.005 {
+		t.Errorf("reference %v, want the mean %.2f of ref", r.Reference, ref)
+	}
+}
+
+func TestAppendTrend(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "trend.jsonl")
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 10, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name    string
+		records []TrendRecord
+		added   int
+		total   int
+	}{
+		{"new store", []TrendRecord{{Asset: "A", File: "a1", SHA256: "1", Captured: day(1)}, {Asset: "A", File: "a2", SHA256: "2", Captured: day(2)}}, 2, 2},
+		{"same file again", []TrendRecord{{Asset: "A", File: "a1", SHA256: "1", Captured: day(1)}}, 0, 2},
+		{"copy with another time", []TrendRecord{{Asset: "A", File: "a1", SHA256: "1", Captured: day(5)}}, 0, 2},
+		{"another file of the same name", []TrendRecord{{Asset: "A", File: "a1", SHA256: "3", Captured: day(3)}}, 1, 3},
+		{"duplicates in one call", []TrendRecord{{Asset: "B", File: "b1", SHA256: "4"}, {Asset: "B", File: "b1", SHA256: "4"}}, 1, 4},
+		{"without checksum", []TrendRecord{{Asset: "C", File: "c1", Captured: day(1)}, {Asset: "C", File: "c1", Captured: day(1)}, {Asset: "C", File: "c1", Captured: day(2)}}, 2, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := AppendTrend(store, tt.records...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.added {
+				t.Errorf("%d records appended, want %d", n, tt.added)
+			}
+			all, err := ReadTrend(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) != tt.total {
+				t.Errorf("%d records in the store, want %d", len(all), tt.total)
+			}
+		})
+	}
+}
+
+func TestReadTrendBadRecord(t *testing.T) {
+	store := writeTestFile(t, "trend.jsonl", []byte("{\"asset\":\"A\"}\n\nno json\n"))
+	_, err := ReadTrend(store)
+	if err == nil || !strings.Contains(err.Error(), ":3:") {
+		t.Errorf("error %v, want a bad record in line 3", err)
+	}
+	records, err := ReadTrend(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil || records != nil {
+		t.Errorf("missing store: %v, %v", records, err)
+	}
+}
+
+func TestTrends(t *testing.T) {
+	at := func(months int) time.Time {
+		return time.Date(2023, time.Month(1+months), 1, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name   string
+		maxes  []float64
+		rise   float64
+		slope  float64
+		rising bool
+	}{
+		{"flat", []float64{40, 40, 40, 40}, 2, 0, false},
+		{"rising 6 K per year", []float64{40, 41.5, 43, 44.5}, 2, 6, true},
+		{"rising below the limit", []float64{40, 40.25, 40.5, 40.75}, 2, 1, false},
+		{"falling", []float64{44.5, 43, 41.5, 40}, 2, -6, false},
+		{"two points", []float64{40, 50}, 2, 40, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var records []TrendRecord
+			// every 3 months, in reverse order to check the sorting
+			for i := len(tt.maxes) - 1; i >= 0; i-- {
+				deltaT := tt.maxes[i] - 30
+				records = append(records, TrendRecord{Asset: "A", File: "f", Captured: at(3 * i), Max: tt.maxes[i], DeltaT: &deltaT})
+			}
+			series := Trends(records, tt.rise)
+			if len(series) != 2 {
+				t.Fatalf("%d series, want max and delta_t", len(series))
+			}
+			for _, s := range series {
+				if len(s.Points) != len(tt.maxes) || !s.Points[0].Time.Equal(at(0)) {
+					t.Errorf("%s: points not in time order", s.Name)
+				}
+				// 3 months are not exactly a quarter of a year.
+				if math.Abs(s.Slope-tt.slope) > 0.02*math.Abs(tt.slope) {
+					t.Errorf("%s: slope %.2f, want %.2f", s.Name, s.Slope, tt.slope)
+				}
+				if s.Rising != tt.rising {
+					t.Errorf("%s: rising %t, want %t", s.Name, s.Rising, tt.rising)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteTrendCSV(t *testing.T) {
+	d1, d2 := 20.0, 15.0
+	series := Trends([]TrendRecord{{Asset: "A", File: "f1", Captured: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Max: 40, DeltaT: &d1, ROIs: []TrendROI{{Name: "busbar", Max: 35, DeltaT: &d2}}}}, 2)
+	var buf bytes.Buffer
+	err := WriteTrendCSV(&buf, series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("%d lines, want the header and 4 points:\n%s", len(lines), buf.String())
+	}
+	if lines[3] != "A,busbar max,2024-01-01T00:00:00Z,f1,35.00,0.00,false" {
+		t.Errorf("line %q", lines[3])
+	}
+}
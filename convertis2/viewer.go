@@ -0,0 +1,84 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// viewerFiles is the single page viewer of the conversion service
+//
+//go:embed viewer
+var viewerFiles embed.FS
+
+// viewerDocument is the decoded file as the viewer reads it
+type viewerDocument struct {
+	temperatureData
+	// Visual is the visual picture as data URL, empty if the file has none
+	Visual      string     `json:"visual,omitempty"`
+	Alignment   *Alignment `json:"alignment,omitempty"`
+	ROIs        []ROI      `json:"rois,omitempty"`
+	Annotations []string   `json:"annotations,omitempty"`
+	Camera      string     `json:"camera,omitempty"`
+	Audio       bool       `json:"audio"`
+}
+
+// viewerHandler serves the files of the viewer
+func viewerHandler() http.Handler {
+	sub, err := fs.Sub(viewerFiles, "viewer")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(sub))
+}
+
+// decode answers the decoded file as viewer document
+func (s *Server) decode(w http.ResponseWriter, r *http.Request) (int, error) {
+	opts, _, err := s.requestOptions(r.URL.Query())
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	frame, status, err := s.decodeUpload(w, r, opts)
+	if err != nil {
+		return status, err
+	}
+	doc := viewerDocument{
+		temperatureData: frame.temperatureData(opts),
+		Alignment:       frame.Alignment,
+		ROIs:            frame.ROIs,
+		Annotations:     frame.Annotations,
+		Audio:           len(frame.Audio) > 0,
+	}
+	if frame.Metadata != nil {
+		doc.Camera = strings.TrimSpace(frame.Metadata.Make + " " + frame.Metadata.Model)
+	}
+	if frame.Visual != nil || frame.VisualJPEG != nil {
+		data, err := encodeVisual(frame, FormatJPEG, opts, nil)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		doc.Visual = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return http.StatusOK, json.NewEncoder(w).Encode(doc)
+}
+
+// palettesJSON answers the colors of the registered palettes as #RRGGBB
+func palettesJSON(w http.ResponseWriter, r *http.Request) (int, error) {
+	colors := map[string][]string{}
+	for _, name := range PaletteNames() {
+		for _, c := range Palette(name) {
+			colors[name] = append(colors[name], fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return http.StatusOK, json.NewEncoder(w).Encode(colors)
+}
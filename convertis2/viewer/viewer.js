@@ -0,0 +1,445 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Viewer of the goConvertIS2 service. The file is decoded by POST /decode,
+// the picture is colored here from the temperatures, so palette and scale
+// change without a round trip.
+"use strict";
+
+// zoom of the displayed picture
+const zoom = 2;
+
+const state = {
+	file: null,
+	doc: null,
+	visual: null,
+	palettes: {},
+	shapes: [],
+	drag: null,
+};
+
+const $ = (id) => document.getElementById(id);
+
+// setStatus shows a message in the header
+function setStatus(msg) {
+	$("status").textContent = msg;
+}
+
+// loadPalettes fills the palette select with the palettes of the service
+async function loadPalettes() {
+	const res = await fetch("palettes");
+	const palettes = await res.json();
+	for (const [name, colors] of Object.entries(palettes)) {
+		state.palettes[name] = colors.map((c) => [parseInt(c.slice(1, 3), 16), parseInt(c.slice(3, 5), 16), parseInt(c.slice(5, 7), 16)]);
+		const option = document.createElement("option");
+		option.value = option.textContent = name;
+		$("palette").appendChild(option);
+	}
+	$("palette").value = "iron" in palettes ? "iron" : $("palette").options[0].value;
+}
+
+// openFile decodes a new file
+function openFile(file) {
+	state.file = file;
+	state.doc = null;
+	$("emission").value = "";
+	$("background").value = "";
+	decode();
+}
+
+// decode decodes the file with the parameters of the inputs. The shapes
+// are taken from the file when it is decoded the first time.
+async function decode() {
+	const q = new URLSearchParams();
+	if ($("emission").value !== "") {
+		q.set("e", $("emission").value);
+	}
+	if ($("background").value !== "") {
+		q.set("b", $("background").value);
+	}
+	setStatus("Decoding " + state.file.name + " ...");
+	const res = await fetch("decode?" + q, { method: "POST", body: state.file });
+	if (!res.ok) {
+		setStatus(state.file.name + ": " + (await res.text()));
+		return;
+	}
+	const doc = await res.json();
+	const first = state.doc === null;
+	state.doc = doc;
+	if (first) {
+		state.shapes = (doc.rois || []).map((r) => ({
+			type: "roi",
+			name: r.name,
+			x0: r.x,
+			y0: r.y,
+			x1: r.x + Math.max(r.width, 1) - 1,
+			y1: r.y + Math.max(r.height, 1) - 1,
+		}));
+		$("emission").value = doc.params.emission;
+		$("background").value = doc.params.background;
+		const list = $("annotations");
+		list.replaceChildren(...(doc.annotations || []).map((a) => {
+			const li = document.createElement("li");
+			li.textContent = a;
+			return li;
+		}));
+	}
+	state.visual = null;
+	$("visual-view").disabled = !doc.visual;
+	if (doc.visual) {
+		const img = new Image();
+		img.onload = () => render();
+		img.src = doc.visual;
+		state.visual = img;
+	} else {
+		document.querySelector("input[name=view][value=ir]").checked = true;
+	}
+	if ($("auto").checked) {
+		$("min").value = doc.min.temperature;
+		$("max").value = doc.max.temperature;
+	}
+	$("report").disabled = false;
+	setStatus(state.file.name + (doc.camera ? " (" + doc.camera + ")" : "") + (doc.audio ? ", with audio" : ""));
+	render();
+}
+
+// scale returns the min and max temperature of the colortable
+function scale() {
+	const doc = state.doc;
+	if ($("auto").checked) {
+		return [doc.min.temperature, doc.max.temperature];
+	}
+	const lo = parseFloat($("min").value);
+	const hi = parseFloat($("max").value);
+	if (isNaN(lo) || isNaN(hi) || lo >= hi) {
+		return [doc.min.temperature, doc.max.temperature];
+	}
+	return [lo, hi];
+}
+
+// color returns the palette color of the temperature t
+function color(t, lo, hi, colors) {
+	const i = Math.floor((t - lo) * colors.length / (hi - lo));
+	return colors[Math.min(Math.max(i, 0), colors.length - 1)];
+}
+
+// field returns the colored temperatures in the camera resolution
+function field() {
+	const doc = state.doc;
+	const [lo, hi] = scale();
+	const colors = state.palettes[$("palette").value];
+	const canvas = document.createElement("canvas");
+	canvas.width = doc.width;
+	canvas.height = doc.height;
+	const ctx = canvas.getContext("2d");
+	const img = ctx.createImageData(doc.width, doc.height);
+	let p = 0;
+	for (const row of doc.temperatures) {
+		for (const t of row) {
+			const c = color(t, lo, hi, colors);
+			img.data[p++] = c[0];
+			img.data[p++] = c[1];
+			img.data[p++] = c[2];
+			img.data[p++] = 255;
+		}
+	}
+	ctx.putImageData(img, 0, 0);
+	return canvas;
+}
+
+// view returns the selected view, ir or visual
+function view() {
+	return document.querySelector("input[name=view]:checked").value;
+}
+
+// render draws the picture, the shapes and the scale
+function render() {
+	const doc = state.doc;
+	if (!doc) {
+		return;
+	}
+	const canvas = $("view");
+	canvas.width = doc.width * zoom;
+	canvas.height = doc.height * zoom;
+	const ctx = canvas.getContext("2d");
+	if (view() === "visual" && state.visual) {
+		ctx.drawImage(state.visual, 0, 0, canvas.width, canvas.height);
+	} else {
+		ctx.imageSmoothingEnabled = false;
+		ctx.drawImage(field(), 0, 0, canvas.width, canvas.height);
+		marker(ctx, doc.min, "#00a0ff");
+		marker(ctx, doc.max, "#ff2020");
+	}
+	for (const s of state.shapes) {
+		drawShape(ctx, s);
+	}
+	drawScale();
+	updateTable();
+}
+
+// marker draws a cross at a spot
+function marker(ctx, spot, c) {
+	const x = (spot.x + 0.5) * zoom;
+	const y = (spot.y + 0.5) * zoom;
+	ctx.strokeStyle = c;
+	ctx.lineWidth = 2;
+	ctx.beginPath();
+	ctx.moveTo(x - 6, y);
+	ctx.lineTo(x + 6, y);
+	ctx.moveTo(x, y - 6);
+	ctx.lineTo(x, y + 6);
+	ctx.stroke();
+}
+
+// drawShape draws a region or a line with its name
+function drawShape(ctx, s) {
+	ctx.save();
+	ctx.lineWidth = 2;
+	ctx.strokeStyle = "#fff";
+	ctx.shadowColor = "#000";
+	ctx.shadowBlur = 2;
+	ctx.beginPath();
+	if (s.type === "roi") {
+		const b = box(s);
+		ctx.rect(b.x0 * zoom, b.y0 * zoom, (b.x1 - b.x0 + 1) * zoom, (b.y1 - b.y0 + 1) * zoom);
+	} else {
+		ctx.moveTo((s.x0 + 0.5) * zoom, (s.y0 + 0.5) * zoom);
+		ctx.lineTo((s.x1 + 0.5) * zoom, (s.y1 + 0.5) * zoom);
+	}
+	ctx.stroke();
+	ctx.fillStyle = "#fff";
+	ctx.font = "12px sans-serif";
+	ctx.fillText(s.name, Math.min(s.x0, s.x1) * zoom + 3, Math.min(s.y0, s.y1) * zoom - 3);
+	ctx.restore();
+}
+
+// drawScale draws the colortable with the min and max temperature
+function drawScale() {
+	const canvas = $("scale");
+	canvas.height = $("view").height;
+	const ctx = canvas.getContext("2d");
+	const colors = state.palettes[$("palette").value];
+	const [lo, hi] = scale();
+	ctx.clearRect(0, 0, canvas.width, canvas.height);
+	const top = 20;
+	const h = canvas.height - 2 * top;
+	for (let y = 0; y < h; y++) {
+		const c = colors[Math.floor((1 - y / h) * (colors.length - 1))];
+		ctx.fillStyle = "rgb(" + c.join(",") + ")";
+		ctx.fillRect(0, top + y, 20, 1);
+	}
+	ctx.fillStyle = "#222";
+	ctx.font = "12px sans-serif";
+	ctx.fillText(hi.toFixed(1) + " °C", 0, 14);
+	ctx.fillText(lo.toFixed(1) + " °C", 0, canvas.height - 4);
+}
+
+// box returns the region of a shape with x0 <= x1 and y0 <= y1
+function box(s) {
+	return {
+		x0: Math.min(s.x0, s.x1),
+		y0: Math.min(s.y0, s.y1),
+		x1: Math.max(s.x0, s.x1),
+		y1: Math.max(s.y0, s.y1),
+	};
+}
+
+// points returns the pixels of a shape
+function points(s) {
+	const pts = [];
+	if (s.type === "roi") {
+		const b = box(s);
+		for (let y = b.y0; y <= b.y1; y++) {
+			for (let x = b.x0; x <= b.x1; x++) {
+				pts.push([x, y]);
+			}
+		}
+		return pts;
+	}
+	const n = Math.max(Math.abs(s.x1 - s.x0), Math.abs(s.y1 - s.y0));
+	for (let i = 0; i <= n; i++) {
+		const f = n === 0 ? 0 : i / n;
+		pts.push([Math.round(s.x0 + (s.x1 - s.x0) * f), Math.round(s.y0 + (s.y1 - s.y0) * f)]);
+	}
+	return pts;
+}
+
+// stats returns the min, max and mean temperature of a shape
+function stats(s) {
+	let lo = Infinity;
+	let hi = -Infinity;
+	let sum = 0;
+	const pts = points(s);
+	for (const [x, y] of pts) {
+		const t = state.doc.temperatures[y][x];
+		lo = Math.min(lo, t);
+		hi = Math.max(hi, t);
+		sum += t;
+	}
+	return { min: lo, max: hi, mean: sum / pts.length };
+}
+
+// updateTable lists the shapes with their temperatures
+function updateTable() {
+	const body = $("shapes").tBodies[0];
+	body.replaceChildren(...state.shapes.map((s, i) => {
+		const st = stats(s);
+		const tr = document.createElement("tr");
+		for (const v of [s.name, s.type === "roi" ? "region" : "line", st.min.toFixed(2), st.max.toFixed(2), st.mean.toFixed(2)]) {
+			const td = document.createElement("td");
+			td.textContent = v;
+			tr.appendChild(td);
+		}
+		const td = document.createElement("td");
+		const del = document.createElement("button");
+		del.textContent = "Delete";
+		del.onclick = () => {
+			state.shapes.splice(i, 1);
+			render();
+		};
+		td.appendChild(del);
+		tr.appendChild(td);
+		return tr;
+	}));
+}
+
+// position returns the pixel of the temperature field under the mouse
+function position(ev) {
+	const doc = state.doc;
+	const r = $("view").getBoundingClientRect();
+	const x = Math.floor((ev.clientX - r.left) * doc.width / r.width);
+	const y = Math.floor((ev.clientY - r.top) * doc.height / r.height);
+	return [Math.min(Math.max(x, 0), doc.width - 1), Math.min(Math.max(y, 0), doc.height - 1)];
+}
+
+// hit returns the topmost shape at the pixel x, y
+function hit(x, y) {
+	for (let i = state.shapes.length - 1; i >= 0; i--) {
+		const s = state.shapes[i];
+		if (s.type === "roi") {
+			const b = box(s);
+			if (x >= b.x0 && x <= b.x1 && y >= b.y0 && y <= b.y1) {
+				return s;
+			}
+		} else if (points(s).some(([px, py]) => Math.abs(px - x) <= 2 && Math.abs(py - y) <= 2)) {
+			return s;
+		}
+	}
+	return null;
+}
+
+// report downloads the picture with the shapes and their temperatures as
+// html file
+function report() {
+	const doc = state.doc;
+	const [lo, hi] = scale();
+	const esc = (s) => String(s).replace(/[&<>"]/g, (c) => ({ "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;" })[c]);
+	const rows = state.shapes.map((s) => {
+		const st = stats(s);
+		return "<tr><td>" + esc(s.name) + "</td><td>" + (s.type === "roi" ? "region" : "line") + "</td><td>" +
+			st.min.toFixed(2) + "</td><td>" + st.max.toFixed(2) + "</td><td>" + st.mean.toFixed(2) + "</td></tr>";
+	}).join("\n");
+	const notes = (doc.annotations || []).map((a) => "<li>" + esc(a) + "</li>").join("");
+	const html = "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>" + esc(state.file.name) + "</title>" +
+		"<style>body{font:14px sans-serif}td,th{padding:2px 8px;border-bottom:1px solid #ccc;text-align:right}td:first-child,th:first-child{text-align:left}table{border-collapse:collapse}</style></head><body>\n" +
+		"<h1>" + esc(state.file.name) + "</h1>\n" +
+		"<p>" + (doc.camera ? esc(doc.camera) + "<br>" : "") +
+		"Emission factor " + doc.params.emission + ", background " + doc.params.background + " °C<br>" +
+		"Min. " + doc.min.temperature.toFixed(2) + " °C at " + doc.min.x + "," + doc.min.y +
+		", max. " + doc.max.temperature.toFixed(2) + " °C at " + doc.max.x + "," + doc.max.y + "<br>" +
+		"Palette " + esc($("palette").value) + ", scale " + lo.toFixed(1) + " to " + hi.toFixed(1) + " °C</p>\n" +
+		"<img src=\"" + $("view").toDataURL("image/png") + "\">\n" +
+		"<table><tr><th>Name</th><th>Type</th><th>Min. °C</th><th>Max. °C</th><th>Mean °C</th></tr>\n" + rows + "</table>\n" +
+		(notes ? "<ul>" + notes + "</ul>\n" : "") + "</body></html>\n";
+	const a = document.createElement("a");
+	a.href = URL.createObjectURL(new Blob([html], { type: "text/html" }));
+	a.download = state.file.name.replace(/\.[^.]*$/, "") + "_report.html";
+	a.click();
+	setTimeout(() => URL.revokeObjectURL(a.href), 1000);
+}
+
+function init() {
+	const canvas = $("view");
+	canvas.addEventListener("mousedown", (ev) => {
+		if (!state.doc) {
+			return;
+		}
+		const [x, y] = position(ev);
+		const tool = document.querySelector("input[name=tool]:checked").value;
+		const s = hit(x, y);
+		if (s) {
+			state.drag = { shape: s, x, y, orig: { x0: s.x0, y0: s.y0, x1: s.x1, y1: s.y1 } };
+		} else if (tool !== "probe") {
+			const count = state.shapes.filter((o) => o.type === tool).length + 1;
+			const shape = { type: tool, name: (tool === "roi" ? "R" : "L") + count, x0: x, y0: y, x1: x, y1: y };
+			state.shapes.push(shape);
+			state.drag = { shape, create: true };
+		}
+	});
+	canvas.addEventListener("mousemove", (ev) => {
+		if (!state.doc) {
+			return;
+		}
+		const [x, y] = position(ev);
+		$("readout").textContent = x + ", " + y + ": " + state.doc.temperatures[y][x].toFixed(2) + " °C";
+		const d = state.drag;
+		if (!d) {
+			return;
+		}
+		const s = d.shape;
+		if (d.create) {
+			s.x1 = x;
+			s.y1 = y;
+		} else {
+			const dx = Math.min(Math.max(x - d.x, -Math.min(d.orig.x0, d.orig.x1)), state.doc.width - 1 - Math.max(d.orig.x0, d.orig.x1));
+			const dy = Math.min(Math.max(y - d.y, -Math.min(d.orig.y0, d.orig.y1)), state.doc.height - 1 - Math.max(d.orig.y0, d.orig.y1));
+			s.x0 = d.orig.x0 + dx;
+			s.x1 = d.orig.x1 + dx;
+			s.y0 = d.orig.y0 + dy;
+			s.y1 = d.orig.y1 + dy;
+		}
+		render();
+	});
+	window.addEventListener("mouseup", () => {
+		state.drag = null;
+	});
+	canvas.addEventListener("mouseleave", () => {
+		$("readout").innerHTML = "&nbsp;";
+	});
+	$("file").addEventListener("change", (ev) => {
+		if (ev.target.files.length > 0) {
+			openFile(ev.target.files[0]);
+		}
+	});
+	const main = document.querySelector("main");
+	main.addEventListener("dragover", (ev) => {
+		ev.preventDefault();
+		main.classList.add("drop");
+	});
+	main.addEventListener("dragleave", () => main.classList.remove("drop"));
+	main.addEventListener("drop", (ev) => {
+		ev.preventDefault();
+		main.classList.remove("drop");
+		if (ev.dataTransfer.files.length > 0) {
+			openFile(ev.dataTransfer.files[0]);
+		}
+	});
+	$("auto").addEventListener("change", () => {
+		$("min").disabled = $("max").disabled = $("auto").checked;
+		render();
+	});
+	for (const id of ["palette", "min", "max"]) {
+		$(id).addEventListener("input", render);
+	}
+	for (const el of document.querySelectorAll("input[name=view]")) {
+		el.addEventListener("change", render);
+	}
+	for (const id of ["emission", "background"]) {
+		$(id).addEventListener("change", () => state.file && decode());
+	}
+	$("report").addEventListener("click", report);
+	loadPalettes().catch((err) => setStatus("Can't load the palettes. " + err));
+}
+
+init();
@@ -0,0 +1,105 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		body   []byte
+		format string
+		visual bool
+		audio  bool
+		params Params
+	}{
+		{"old format", "", testOldIS2(testRaw(1320, 2093)), FormatOldIS2, true, true, DefaultParams},
+		{"new format without visual", "", testNewIS2(t, testRaw(4716, 7263), nil), FormatNewIS2, false, false, DefaultParams},
+		{"parameters", "e=0.8&b=10", testOldIS2(testRaw(1320, 2093)), FormatOldIS2, true, true, Params{Background: 10, Emission: 0.8}},
+	}
+	s := NewServer(ServeOptions{Options: Options{Logger: discard}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/decode?"+tt.query, bytes.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("content type %s", ct)
+			}
+			var doc viewerDocument
+			if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc.Format != tt.format || doc.Width != 320 || doc.Height != 240 {
+				t.Errorf("%s %dx%d, want %s 320x240", doc.Format, doc.Width, doc.Height, tt.format)
+			}
+			if len(doc.Temperatures) != 240 || len(doc.Temperatures[0]) != 320 {
+				t.Errorf("temperatures of %d rows", len(doc.Temperatures))
+			}
+			if doc.Params != tt.params {
+				t.Errorf("params %+v, want %+v", doc.Params, tt.params)
+			}
+			if doc.Max.X != 200 || doc.Max.Y != 90 {
+				t.Errorf("max at %d,%d, want 200,90", doc.Max.X, doc.Max.Y)
+			}
+			if strings.HasPrefix(doc.Visual, "data:image/jpeg;base64,") != tt.visual {
+				t.Errorf("visual %.40q", doc.Visual)
+			}
+			if doc.Audio != tt.audio {
+				t.Errorf("audio %v, want %v", doc.Audio, tt.audio)
+			}
+		})
+	}
+}
+
+func TestServerViewer(t *testing.T) {
+	tests := []struct {
+		path        string
+		contentType string
+		text        string
+	}{
+		{"/", "text/html", "<html"},
+		{"/viewer.js", "javascript", "/decode"},
+		{"/viewer.css", "text/css", ""},
+		{"/palettes", "application/json", `"iron":["#`},
+	}
+	s := NewServer(ServeOptions{Options: Options{Logger: discard}})
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d", tt.path, rec.Code)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+			t.Errorf("%s: content type %s, want %s", tt.path, ct, tt.contentType)
+		}
+		if !strings.Contains(rec.Body.String(), tt.text) {
+			t.Errorf("%s: %.60q, want %q", tt.path, rec.Body.String(), tt.text)
+		}
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/palettes", nil))
+	var colors map[string][]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &colors); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range PaletteNames() {
+		if len(colors[name]) != len(Palette(name)) {
+			t.Errorf("palette %s with %d colors, want %d", name, len(colors[name]), len(Palette(name)))
+		}
+	}
+}
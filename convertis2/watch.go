@@ -0,0 +1,244 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Subfolders of a watched directory for the converted originals
+const (
+	ProcessedDir = "processed"
+	FailedDir    = "failed"
+)
+
+// WatchOptions holds the parameters of Watch
+type WatchOptions struct {
+	// Options of the conversion
+	Options Options
+	// Interval between two scans of the directory. 0 selects 2 seconds.
+	Interval time.Duration
+	// Stable is the time a file must keep its size and modification time
+	// before it is converted. 0 selects 5 seconds.
+	Stable time.Duration
+	// StateFile keeps the converted files across restarts. Empty selects
+	// .goconvertis2-state.json in the watched directory.
+	StateFile string
+	// Workers is the number of files converted in parallel
+	Workers int
+}
+
+// watchEntry is the state of a converted file
+type watchEntry struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Converted time.Time `json:"converted"`
+}
+
+// watchState is the state file of Watch
+type watchState struct {
+	Files map[string]watchEntry `json:"files"`
+}
+
+// seenFile is a file waiting to become stable
+type seenFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// Watch converts new and updated .is2 files of dir until ctx is canceled. A
+// file is converted after it kept its size and modification time for the
+// stable time, so files in the middle of copying are left alone. The
+// original and its sidecars are moved into the processed or the failed
+// subfolder afterwards.
+func Watch(ctx context.Context, dir string, wo WatchOptions) error {
+	if wo.Interval <= 0 {
+		wo.Interval = 2 * time.Second
+	}
+	if wo.Stable <= 0 {
+		wo.Stable = 5 * time.Second
+	}
+	if wo.StateFile == "" {
+		wo.StateFile = filepath.Join(dir, ".goconvertis2-state.json")
+	}
+	for _, sub := range []string{ProcessedDir, FailedDir} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0777)
+		if err != nil {
+			return err
+		}
+	}
+	state, err := readWatchState(wo.StateFile)
+	if err != nil {
+		return err
+	}
+	log.Println("Watching", dir)
+	seen := map[string]seenFile{}
+	ticker := time.NewTicker(wo.Interval)
+	defer ticker.Stop()
+	for {
+		var ready []string
+		ready, err = scanWatchDir(dir, state, seen, wo.Stable)
+		if err != nil {
+			return err
+		}
+		if len(ready) > 0 {
+			ConvertEach(ctx, ready, wo.Options, wo.Workers, func(filename string, err error) {
+				s := seen[filename]
+				delete(seen, filename)
+				entry := watchEntry{Size: s.size, ModTime: s.modTime, Status: ProcessedDir, Converted: time.Now()}
+				if err != nil {
+					log.Println("Failed:", err)
+					entry.Status = FailedDir
+					entry.Error = err.Error()
+				}
+				state.Files[filepath.Base(filename)] = entry
+				err = writeWatchState(wo.StateFile, state)
+				if err != nil {
+					log.Println("Can't write the state file.", err)
+				}
+				moveWatched(dir, filename, entry.Status)
+			})
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanWatchDir returns the stable files of dir. Files of the state with
+// the same size and modification time were converted before and are only
+// moved.
+func scanWatchDir(dir string, state *watchState, seen map[string]seenFile, stable time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var ready []string
+	for _, e := range entries {
+		if e.IsDir() || !isIS2(e.Name()) {
+			continue
+		}
+		filename := filepath.Join(dir, e.Name())
+		fi, err := e.Info()
+		if err != nil {
+			// The file was moved away in the meantime.
+			continue
+		}
+		if done, ok := state.Files[e.Name()]; ok && done.Size == fi.Size() && done.ModTime.Equal(fi.ModTime()) {
+			moveWatched(dir, filename, done.Status)
+			continue
+		}
+		s, ok := seen[filename]
+		if !ok || s.size != fi.Size() || !s.modTime.Equal(fi.ModTime()) {
+			seen[filename] = seenFile{size: fi.Size(), modTime: fi.ModTime(), since: now}
+			continue
+		}
+		if now.Sub(s.since) >= stable {
+			ready = append(ready, filename)
+		}
+	}
+	return ready, nil
+}
+
+// moveWatched moves a converted file and its sidecars into the subfolder
+// of its status. A file of the same name in the subfolder is kept, the
+// moved file gets the first free number, e.g. IR00012-1.IS2. The relative
+// path of the emission mask of the sidecar is kept valid.
+func moveWatched(dir string, filename string, status string) {
+	dst := freeName(filepath.Join(dir, status, filepath.Base(filename)))
+	sidecar, err := ReadSidecar(filename)
+	if err != nil {
+		log.Println(err)
+	}
+	err = os.Rename(filename, dst)
+	if err != nil {
+		log.Println("Can't move file.", err, filename)
+		return
+	}
+	for _, ext := range sidecarExtensions {
+		if _, err := os.Stat(filename + ext); err != nil {
+			continue
+		}
+		err := os.Rename(filename+ext, dst+ext)
+		if err != nil {
+			log.Println("Can't move file.", err, filename+ext)
+		}
+	}
+	if sidecar != nil && sidecar.EmissionMask != "" && !filepath.IsAbs(sidecar.EmissionMask) {
+		sidecar.Relocate(filepath.Dir(dst))
+		err = WriteSidecar(dst, sidecar)
+		if err != nil {
+			log.Println("Can't write the sidecar.", err, dst)
+		}
+	}
+}
+
+// freeName returns path if neither it nor a sidecar of it exists.
+// Otherwise it returns path with the first free number before the
+// extension.
+func freeName(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	taken := func(path string) bool {
+		for _, p := range append([]string{""}, sidecarExtensions...) {
+			if _, err := os.Lstat(path + p); !errors.Is(err, fs.ErrNotExist) {
+				return true
+			}
+		}
+		return false
+	}
+	for n := 1; taken(path); n++ {
+		path = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	return path
+}
+
+// readWatchState reads the state file. A missing file is an empty state.
+func readWatchState(filename string) (*watchState, error) {
+	state := &watchState{Files: map[string]watchEntry{}}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	if state.Files == nil {
+		state.Files = map[string]watchEntry{}
+	}
+	return state, nil
+}
+
+// writeWatchState replaces the state file at once
+func writeWatchState(filename string, state *watchState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filename+".tmp", data, 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
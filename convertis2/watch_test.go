@@ -0,0 +1,98 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package convertis2
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMoveWatched(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		existing []string
+		moved    []string
+	}{
+		{"file", []string{"IR1.IS2"}, nil, []string{"IR1.IS2"}},
+		{"json sidecar", []string{"IR1.IS2", "IR1.IS2.json"}, nil, []string{"IR1.IS2", "IR1.IS2.json"}},
+		{"yaml sidecars", []string{"IR1.IS2", "IR1.IS2.yaml", "IR1.IS2.yml"}, nil, []string{"IR1.IS2", "IR1.IS2.yaml", "IR1.IS2.yml"}},
+		{"existing file", []string{"IR1.IS2", "IR1.IS2.json"}, []string{"IR1.IS2"}, []string{"IR1-1.IS2", "IR1-1.IS2.json"}},
+		{"existing numbers", []string{"IR1.IS2"}, []string{"IR1.IS2", "IR1-1.IS2"}, []string{"IR1-2.IS2"}},
+		{"existing sidecar", []string{"IR1.IS2"}, []string{"IR1.IS2.yaml"}, []string{"IR1-1.IS2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			processed := filepath.Join(dir, ProcessedDir)
+			if err := os.Mkdir(processed, 0777); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(processed, name), []byte("old"), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			moveWatched(dir, filepath.Join(dir, tt.files[0]), ProcessedDir)
+			for _, name := range tt.files {
+				if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+					t.Errorf("%s not moved", name)
+				}
+			}
+			for _, name := range tt.moved {
+				data, err := os.ReadFile(filepath.Join(processed, name))
+				if err != nil || string(data) != "{}" {
+					t.Errorf("%s: %q %v, want the moved file", name, data, err)
+				}
+			}
+			for _, name := range tt.existing {
+				data, err := os.ReadFile(filepath.Join(processed, name))
+				if err != nil || string(data) != "old" {
+					t.Errorf("%s: %q %v, want the existing file", name, data, err)
+				}
+			}
+			entries, err := os.ReadDir(processed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			want := append(slices.Clone(tt.moved), tt.existing...)
+			slices.Sort(want)
+			if !slices.Equal(names, want) {
+				t.Errorf("processed %v, want %v", names, want)
+			}
+		})
+	}
+}
+
+func TestMoveWatchedEmissionMask(t *testing.T) {
+	filename := writeTestFile(t, "IR1.IS2", nil)
+	dir := filepath.Dir(filename)
+	if err := os.Mkdir(filepath.Join(dir, FailedDir), 0777); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filename+".yaml", []byte("asset: PV-1\nemission_mask: mask.png\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moveWatched(dir, filename, FailedDir)
+	s, err := ReadSidecar(filepath.Join(dir, FailedDir, "IR1.IS2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == nil || s.Asset != "PV-1" || s.EmissionMask != filepath.Join("..", "mask.png") {
+		t.Errorf("sidecar %+v, want the asset PV-1 and the mask ../mask.png", s)
+	}
+}
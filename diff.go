@@ -0,0 +1,83 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/weisskopfjens/goconvertis2/convertis2"
+)
+
+// diffMain compares two files, prints the statistics of the changes and
+// writes the difference picture
+func diffMain(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	outPtr := fs.String("o", "diff.png", "A file for the difference picture (.jpg, .png, .tif, .bmp). Empty skips the picture.")
+	offsetPtr := fs.String("offset", "0,0", "Shift of the scene in the second file against the first file in pixels (x,y).")
+	thresholdPtr := fs.Float64("threshold", 1, "Threshold of a changed pixel in K.")
+	areaPtr := fs.Int("area", 4, "Min. area of a changed region in pixels.")
+	limitPtr := fs.Float64("scale", 0, "End of the symmetric scale in K. 0 selects the largest delta.")
+	params := newParamFlags(fs, "both files")
+	palettePtr := fs.String("palette", convertis2.PaletteDiverging, "Palette of the difference picture ("+strings.Join(convertis2.PaletteNames(), ", ")+").")
+	widthPtr := fs.Int("width", 780, "Width of the difference picture in pixels.")
+	jsonPtr := fs.Bool("json", false, "Print the statistics as JSON object.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goconvertis2 diff [flags] <before> <after>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	x, y, ok := strings.Cut(*offsetPtr, ",")
+	dx, err1 := strconv.Atoi(strings.TrimSpace(x))
+	dy, err2 := strconv.Atoi(strings.TrimSpace(y))
+	if !ok || err1 != nil || err2 != nil {
+		log.Fatalln(*offsetPtr + ": offset must be x,y.")
+	}
+	p, _ := params.params()
+	var frames [2]*convertis2.Thermogram
+	for i := range frames {
+		var err error
+		frames[i], err = convertis2.Decode(fs.Arg(i), p)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	d, err := convertis2.Compare(frames[0], frames[1], convertis2.DiffOptions{OffsetX: dx, OffsetY: dy, Threshold: *thresholdPtr, MinArea: *areaPtr})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *jsonPtr {
+		data, err := json.Marshal(d)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Print(d)
+	}
+	if *outPtr == "" {
+		return
+	}
+	opts := convertis2.Options{
+		Width:         *widthPtr,
+		Interpolation: convertis2.InterpolationBilinear,
+		Palette:       *palettePtr,
+		Logger:        log.New(io.Discard, "", 0),
+	}
+	err = d.WriteImage(*outPtr, opts, *limitPtr)
+	if err != nil {
+		log.Fatalln("Can't write the difference picture.", err, *outPtr)
+	}
+}
@@ -6,7 +6,9 @@ require (
 	github.com/cryptix/wav v0.0.0-20180415113528-8bdace674401
 	github.com/fogleman/gg v1.3.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
+	github.com/jung-kurt/gofpdf v1.16.2
 	golang.org/x/image v0.15.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/cheekybits/is v0.0.0-20150225183255-68e9c0620927 // indirect
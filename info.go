@@ -0,0 +1,80 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/weisskopfjens/goconvertis2/convertis2"
+)
+
+// infoMain prints the format, the metadata, the temperatures and the
+// severity of the files without writing any files
+func infoMain(args []string) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	jsonPtr := fs.Bool("json", false, "Print one JSON object per file.")
+	recursivePtr := fs.Bool("r", false, "Search the input directories recursively.")
+	climate := newClimateFlags(fs)
+	hotspots := newHotspotFlags(fs)
+	clusterFlags := newClusterFlags(fs)
+	rulesPtr := fs.String("rules", "", "A JSON rule set classifying the pictures. Default are the NETA delta-T classes.")
+	ambient := newAmbientFlag(fs)
+	emaskPtr := fs.String("emask", "", "A grayscale mask of the emission factors (gray value / 255, below 26 keeps the emission factor of the file). Replaces the mask of the sidecar.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goconvertis2 info [flags] <file|glob|dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	files, err := convertis2.ExpandInputs(fs.Args(), *recursivePtr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	rules := readRules(*rulesPtr)
+	clusters, err := clusterFlags.options()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	opts := convertis2.Options{Climate: climate.climate(), Hotspots: hotspots.options(), Clusters: clusters, EmissionMask: *emaskPtr, Ambient: ambient.ambient()}
+	err = opts.Validate()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	failed, critical := false, false
+	for i, filename := range files {
+		info, err := convertis2.ReadInfo(filename, opts, rules)
+		if err != nil {
+			log.Println(err)
+			failed = true
+			continue
+		}
+		critical = critical || info.Classification.Critical
+		if *jsonPtr {
+			data, err := json.Marshal(info)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			fmt.Println(string(data))
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(info)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	if critical {
+		os.Exit(exitCritical)
+	}
+}
@@ -5,29 +5,468 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/weisskopfjens/goconvertis2/convertis2"
 )
 
+// listFlag collects the values of a flag given several times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// exitCritical is the exit code of info and report if a picture has
+// critical findings
+const exitCritical = 3
+
+// readRules reads the rule set of the -rules flag. An empty filename
+// selects the default rule set.
+func readRules(filename string) *convertis2.RuleSet {
+	if filename == "" {
+		return convertis2.DefaultRuleSet
+	}
+	rules, err := convertis2.ReadRuleSet(filename)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return rules
+}
+
+// climateFlags are the flags of the climate of a building survey
+type climateFlags struct {
+	fs          *flag.FlagSet
+	indoorPtr   *float64
+	outdoorPtr  *float64
+	humidityPtr *float64
+}
+
+// newClimateFlags defines the flags of the climate in fs. The defaults are
+// the standard conditions of DIN 4108-2.
+func newClimateFlags(fs *flag.FlagSet) *climateFlags {
+	c := convertis2.DefaultClimate
+	return &climateFlags{
+		fs:          fs,
+		indoorPtr:   fs.Float64("indoor", c.Indoor, "Indoor air temperature of a building survey. -indoor, -outdoor or -rh enable the survey."),
+		outdoorPtr:  fs.Float64("outdoor", c.Outdoor, "Outdoor air temperature of a building survey."),
+		humidityPtr: fs.Float64("rh", c.Humidity, "Relative humidity of the indoor air in percent."),
+	}
+}
+
+// climate returns the climate of the flags, nil if none of them is given
+func (f *climateFlags) climate() *convertis2.Climate {
+	given := false
+	f.fs.Visit(func(fl *flag.Flag) {
+		given = given || fl.Name == "indoor" || fl.Name == "outdoor" || fl.Name == "rh"
+	})
+	if !given {
+		return nil
+	}
+	return &convertis2.Climate{Indoor: *f.indoorPtr, Outdoor: *f.outdoorPtr, Humidity: *f.humidityPtr}
+}
+
+// ambientFlag is the ambient temperature, the delta-T reference of pictures
+// without a ROI named ref
+type ambientFlag struct {
+	fs         *flag.FlagSet
+	ambientPtr *float64
+}
+
+// newAmbientFlag defines the ambient temperature flag in fs
+func newAmbientFlag(fs *flag.FlagSet) *ambientFlag {
+	return &ambientFlag{
+		fs:         fs,
+		ambientPtr: fs.Float64("ambient", 20, "Ambient temperature, the delta-T reference of pictures without a ROI named ref. Without both there is no delta T and the delta-T rules are skipped."),
+	}
+}
+
+// ambient returns the ambient temperature, nil if the flag is not given
+func (f *ambientFlag) ambient() *float64 {
+	var ambient *float64
+	f.fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "ambient" {
+			ambient = f.ambientPtr
+		}
+	})
+	return ambient
+}
+
+// paramFlags are the background temperature and the emission factor that
+// override the parameters stored in the files
+type paramFlags struct {
+	fs          *flag.FlagSet
+	bgtempPtr   *float64
+	emissionPtr *float64
+}
+
+// newParamFlags defines -b and -e in fs. files names the input files in
+// the help text.
+func newParamFlags(fs *flag.FlagSet, files string) *paramFlags {
+	return &paramFlags{
+		fs:          fs,
+		bgtempPtr:   fs.Float64("b", 20.0, "Background temperature. -b and -e override the values stored in "+files+"."),
+		emissionPtr: fs.Float64("e", 0.95, "Emission factor."),
+	}
+}
+
+// params returns the parameters of -b and -e. Without them the parameters
+// stored in the file are used.
+func (f *paramFlags) params() (convertis2.Params, bool) {
+	set := false
+	f.fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "b" || fl.Name == "e" {
+			set = true
+		}
+	})
+	if set {
+		return convertis2.Params{Background: *f.bgtempPtr, Emission: *f.emissionPtr}, true
+	}
+	return convertis2.Params{}, false
+}
+
+// hotspotFlags are the flags of the hotspot detection
+type hotspotFlags struct {
+	thresholdPtr *float64
+	areaPtr      *int
+	windowPtr    *int
+}
+
+// newHotspotFlags defines the flags of the hotspot detection in fs
+func newHotspotFlags(fs *flag.FlagSet) *hotspotFlags {
+	return &hotspotFlags{
+		thresholdPtr: fs.Float64("hotspots", 0, "Threshold of the hotspots in K above the median of their neighbourhood. 0 disables the hotspot detection."),
+		areaPtr:      fs.Int("hotspot-area", 4, "Min. area of a hotspot in pixels."),
+		windowPtr:    fs.Int("hotspot-window", 160, "Side of the neighbourhood of the hotspots in pixels. At least twice the width of the largest hot area."),
+	}
+}
+
+// options returns the hotspot options, nil if the detection is disabled
+func (f *hotspotFlags) options() *convertis2.HotspotOptions {
+	if *f.thresholdPtr == 0 {
+		return nil
+	}
+	return &convertis2.HotspotOptions{Threshold: *f.thresholdPtr, MinArea: *f.areaPtr, Window: *f.windowPtr}
+}
+
+// clusterFlags are the flags of the hot and cold clusters
+type clusterFlags struct {
+	hotPtr    *string
+	coldPtr   *string
+	topPtr    *int
+	areaPtr   *int
+	radiusPtr *float64
+	markerPtr *string
+}
+
+// newClusterFlags defines the flags of the clusters in fs
+func newClusterFlags(fs *flag.FlagSet) *clusterFlags {
+	return &clusterFlags{
+		hotPtr:    fs.String("hot", "", "Threshold of the hot clusters in °C. Empty disables them."),
+		coldPtr:   fs.String("cold", "", "Threshold of the cold clusters in °C. Empty disables them."),
+		topPtr:    fs.Int("top", 5, "Number of the hot and of the cold clusters marked. 0 marks all."),
+		areaPtr:   fs.Int("cluster-area", 4, "Min. area of a cluster in pixels."),
+		radiusPtr: fs.Float64("cluster-radius", 10, "Radius of the non-maximum suppression of the clusters in pixels."),
+		markerPtr: fs.String("marker", convertis2.MarkerCross, "Style of the cluster markers (shape[,#RRGGBB[,size[,label|nolabel]]], shapes cross, circle, box)."),
+	}
+}
+
+// options returns the options of the clusters of -hot and -cold
+func (f *clusterFlags) options() ([]convertis2.ClusterOptions, error) {
+	var clusters []convertis2.ClusterOptions
+	for _, c := range []struct {
+		kind      string
+		threshold string
+	}{{convertis2.ClusterHot, *f.hotPtr}, {convertis2.ClusterCold, *f.coldPtr}} {
+		if c.threshold == "" {
+			continue
+		}
+		threshold, err := strconv.ParseFloat(c.threshold, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s must be a temperature.", c.threshold, c.kind)
+		}
+		style, err := convertis2.ParseMarkerStyle(*f.markerPtr)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, convertis2.ClusterOptions{
+			Kind:      c.kind,
+			Threshold: threshold,
+			MinArea:   *f.areaPtr,
+			Radius:    *f.radiusPtr,
+			Top:       *f.topPtr,
+			Style:     style,
+		})
+	}
+	return clusters, nil
+}
+
+// convertFlags are the flags of the conversion options
+type convertFlags struct {
+	*paramFlags
+	fs                 *flag.FlagSet
+	workersPtr         *int
+	oIRPtr             *string
+	oVISPtr            *string
+	oAudioPtr          *string
+	emaskPtr           *string
+	mintempPtr         *float64
+	maxtempPtr         *float64
+	scalePtr           *float64
+	widthPtr           *int
+	interpPtr          *string
+	palettePtr         *string
+	oFusionPtr         *string
+	fusionModePtr      *string
+	fusionAlphaPtr     *float64
+	fusionThresholdPtr *float64
+	alignPtr           *string
+	edgePtr            *float64
+	oRadiometricPtr    *string
+	formatPtr          *string
+	qualityPtr         *int
+	modePtr            *string
+	climate            *climateFlags
+	hotspots           *hotspotFlags
+	clusters           *clusterFlags
+}
+
+// newConvertFlags defines the flags of the conversion options in fs
+func newConvertFlags(fs *flag.FlagSet) *convertFlags {
+	return &convertFlags{
+		paramFlags:         newParamFlags(fs, "the file"),
+		fs:                 fs,
+		workersPtr:         fs.Int("j", 0, "Number of files converted in parallel. 0 selects the number of CPUs."),
+		oIRPtr:             fs.String("oi", "ir.jpg", "A file for infrared output (.jpg, .png, .tif, .bmp). All outputs are templates with {dir}, {name} and {ext}."),
+		oVISPtr:            fs.String("ov", "vis.jpg", "A file for visual output (.jpg, .png, .tif, .bmp)."),
+		oAudioPtr:          fs.String("oa", "", "A .wav file for the audio output. Default is the input file with .wav appended."),
+		emaskPtr:           fs.String("emask", "", "A grayscale mask of the emission factors (gray value / 255, below 26 keeps -e). Replaces the mask of the sidecar."),
+		mintempPtr:         fs.Float64("min", 20.0, "Min. temperature."),
+		maxtempPtr:         fs.Float64("max", 70.0, "Max. temperature."),
+		scalePtr:           fs.Float64("scale-factor", 1.0, "Upscale factor of the infrared output."),
+		widthPtr:           fs.Int("width", 0, "Width of the infrared output in pixels. Overrides -scale-factor."),
+		interpPtr:          fs.String("interp", "bilinear", "Interpolation of the upscaled infrared output (nearest, bilinear, bicubic)."),
+		palettePtr:         fs.String("palette", convertis2.PaletteIron, "Palette of the infrared output ("+strings.Join(convertis2.PaletteNames(), ", ")+")."),
+		oFusionPtr:         fs.String("of", "", "A file for fused visual and infrared output (.jpg, .png, .tif, .bmp)."),
+		fusionModePtr:      fs.String("fm", "blend", "Fusion mode (blend, pip, above, below)."),
+		fusionAlphaPtr:     fs.Float64("fa", 0.5, "Opacity of the infrared picture in the blend fusion mode."),
+		fusionThresholdPtr: fs.Float64("ft", 40.0, "Threshold temperature of the above and below fusion modes."),
+		alignPtr:           fs.String("align", "", "Manual alignment of the fused picture (x,y,scale[,parallax]). The alignment of the camera is not read from the IS2 files, without -align the alignment of the sidecar or a picture stretched over the width of the visual picture is used."),
+		edgePtr:            fs.Float64("edge", 0.0, "Strength of the edge enhancement with the visual picture. 0 disables it."),
+		oRadiometricPtr:    fs.String("or", "", "A .jpg file for radiometric output (FLIR compatible)."),
+		formatPtr:          fs.String("fmt", "", "Output format (jpeg, png, tiff, bmp). Default is the format of the file extension."),
+		qualityPtr:         fs.Int("q", 100, "Quality of jpeg outputs (1-100, 0 selects 100)."),
+		modePtr:            fs.String("mode", convertis2.ModeTemperature, "Colors of the infrared output (temperature, dewpoint, frsi). The building modes need -indoor, -outdoor or -rh."),
+		climate:            newClimateFlags(fs),
+		hotspots:           newHotspotFlags(fs),
+		clusters:           newClusterFlags(fs),
+	}
+}
+
+// set returns the names of the flags given on the command line
+func (f *convertFlags) set() map[string]bool {
+	set := map[string]bool{}
+	f.fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	return set
+}
+
+// workers returns the number of parallel conversions
+func (f *convertFlags) workers() int {
+	if *f.workersPtr <= 0 {
+		return runtime.NumCPU()
+	}
+	return *f.workersPtr
+}
+
+// options returns the conversion options. several selects output templates
+// per input file for the infrared and the visual picture.
+func (f *convertFlags) options(several bool) (convertis2.Options, error) {
+	set := f.set()
+	if *f.formatPtr != "" {
+		// The default file names take the extension of the format.
+		ext := map[string]string{"jpeg": ".jpg", "png": ".png", "tiff": ".tif", "bmp": ".bmp"}[*f.formatPtr]
+		if !set["oi"] && ext != "" {
+			*f.oIRPtr = "ir" + ext
+		}
+		if !set["ov"] && ext != "" {
+			*f.oVISPtr = "vis" + ext
+		}
+	}
+	if several {
+		// Several inputs need an output name per file.
+		if !set["oi"] {
+			*f.oIRPtr = "{dir}/{name}_ir.{ext}"
+		}
+		if !set["ov"] {
+			*f.oVISPtr = "{dir}/{name}_vis.{ext}"
+		}
+		for _, path := range []string{*f.oIRPtr, *f.oVISPtr, *f.oFusionPtr, *f.oRadiometricPtr, *f.oAudioPtr} {
+			if fi, err := os.Stat(path); path != "" && !convertis2.IsTemplate(path) && (err != nil || !fi.IsDir()) {
+				return convertis2.Options{}, fmt.Errorf("%s must be a directory or a template with {name} for several input files.", path)
+			}
+		}
+	}
+	var align *convertis2.Alignment
+	if *f.alignPtr != "" {
+		var err error
+		align, err = convertis2.ParseAlignment(*f.alignPtr)
+		if err != nil {
+			return convertis2.Options{}, err
+		}
+	}
+	clusters, err := f.clusters.options()
+	if err != nil {
+		return convertis2.Options{}, err
+	}
+	params, _ := f.params()
+	opts := convertis2.Options{
+		IRFile:          *f.oIRPtr,
+		VisFile:         *f.oVISPtr,
+		AudioFile:       *f.oAudioPtr,
+		Background:      params.Background,
+		Emission:        params.Emission,
+		EmissionMask:    *f.emaskPtr,
+		MinTemp:         *f.mintempPtr,
+		MaxTemp:         *f.maxtempPtr,
+		ScaleFactor:     *f.scalePtr,
+		Width:           *f.widthPtr,
+		Interpolation:   *f.interpPtr,
+		Palette:         *f.palettePtr,
+		FusionFile:      *f.oFusionPtr,
+		FusionMode:      *f.fusionModePtr,
+		FusionAlpha:     *f.fusionAlphaPtr,
+		FusionThreshold: *f.fusionThresholdPtr,
+		Alignment:       align,
+		EdgeStrength:    *f.edgePtr,
+		RadiometricFile: *f.oRadiometricPtr,
+		Format:          *f.formatPtr,
+		Quality:         *f.qualityPtr,
+		Climate:         f.climate.climate(),
+		Mode:            *f.modePtr,
+		Hotspots:        f.hotspots.options(),
+		Clusters:        clusters,
+	}
+	return opts, opts.Validate()
+}
+
 func main() {
+	// The outputs of info and diff are parsed by scripts and have no
+	// banner.
+	if len(os.Args) > 1 && os.Args[1] == "info" {
+		infoMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		diffMain(os.Args[2:])
+		return
+	}
 	fmt.Println("goConvertIS2 by (c)Jens Weißkopf (github.com/weisskopfjens/goconvertis)")
 	fmt.Println("(*) are required parameter.")
 
-	iPtr := flag.String("i", "", "(*) A .is2 File.")
-	oIRPtr := flag.String("oi", "ir.jpg", "A .jpg file for infrared output.")
-	oVISPtr := flag.String("ov", "vis.jpg", "A .jpg file for visual output.")
-	bgtempPtr := flag.Float64("b", 20.0, "Background temperature.")
-	emissionPtr := flag.Float64("e", 0.95, "Emission factor.")
-	mintempPtr := flag.Float64("min", 20.0, "Min. temperature.")
-	maxtempPtr := flag.Float64("max", 70.0, "Max. temperature.")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "watch":
+			watchMain(os.Args[2:])
+			return
+		case "serve":
+			serveMain(os.Args[2:])
+			return
+		case "report":
+			reportMain(os.Args[2:])
+			return
+		case "trend":
+			trendMain(os.Args[2:])
+			return
+		}
+	}
+	convertMain()
+}
+
+// convertMain converts the files of the command line
+func convertMain() {
+	iPtr := flag.String("i", "", "(*) A .is2 File. More files, globs and directories can follow the flags.")
+	recursivePtr := flag.Bool("r", false, "Search the input directories recursively.")
+	cf := newConvertFlags(flag.CommandLine)
+	sidecarPtr := flag.Bool("sidecar", false, "Write the sidecar (<file>.json or an existing .yaml) of every input file with the edited parameters (-b, -e, -align, -asset, -roi, -note).")
+	assetPtr := flag.String("asset", "", "Set the asset ID of the sidecar.")
+	var rois, notes listFlag
+	flag.Var(&rois, "roi", "Add a region of interest (name,x,y[,width,height[,emission]]) to the sidecar. Can be repeated.")
+	flag.Var(&notes, "note", "Add a text annotation to the sidecar. Can be repeated.")
 	flag.Parse()
 
-	if *iPtr == "" {
+	inputs := flag.Args()
+	if *iPtr != "" {
+		inputs = append([]string{*iPtr}, inputs...)
+	}
+	if len(inputs) == 0 {
+		fmt.Println("Commands: watch, serve, info, report, diff, trend. Without a command the input files are converted.")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
-	convertis2.ConvertIS2(*iPtr, *oIRPtr, *oVISPtr, *bgtempPtr, *emissionPtr, *mintempPtr, *maxtempPtr)
+	files, err := convertis2.ExpandInputs(inputs, *recursivePtr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	opts, err := cf.options(len(files) > 1)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var roiList []convertis2.ROI
+	for _, s := range rois {
+		roi, err := convertis2.ParseROI(s)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		roiList = append(roiList, roi)
+	}
+	// IS2 files are never written, the fields of the camera for the edits
+	// are not known. The edits go to the sidecar.
+	if !*sidecarPtr && (*assetPtr != "" || len(roiList) > 0 || len(notes) > 0) {
+		log.Fatalln("-asset, -roi and -note need -sidecar.")
+	}
+	// The sidecars are written first, so the conversion applies them.
+	if *sidecarPtr {
+		var params *convertis2.Params
+		if p, ok := cf.params(); ok {
+			params = &p
+		}
+		for _, filename := range files {
+			sidecar, err := convertis2.ReadSidecar(filename)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			if sidecar == nil {
+				sidecar = &convertis2.Sidecar{}
+			}
+			sidecar.Update(*assetPtr, params, opts.Alignment, roiList, notes)
+			err = convertis2.WriteSidecar(filename, sidecar)
+			if err != nil {
+				log.Fatalln("Can't write the sidecar.", err, convertis2.SidecarPath(filename))
+			}
+			log.Println("Sidecar:", convertis2.SidecarPath(filename))
+		}
+	}
+	// An interrupt stops the conversion after the files in progress.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result := convertis2.ConvertAllContext(ctx, files, opts, cf.workers())
+	log.Println(result)
+	if result.Failed > 0 || result.Canceled > 0 || result.Succeeded == 0 {
+		stop()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,106 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/weisskopfjens/goconvertis2/convertis2"
+)
+
+// reportMain writes an inspection report of the files
+func reportMain(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	outPtr := fs.String("o", "report.pdf", "The report file. A .html file is written as html, other files as PDF.")
+	recursivePtr := fs.Bool("r", false, "Search the input directories recursively.")
+	titlePtr := fs.String("title", "Thermographic inspection", "Title of the report.")
+	customerPtr := fs.String("customer", "", "Customer on the cover page.")
+	inspectorPtr := fs.String("inspector", "", "Inspector on the cover page.")
+	params := newParamFlags(fs, "the files")
+	emaskPtr := fs.String("emask", "", "A grayscale mask of the emission factors (gray value / 255, below 26 keeps -e). Replaces the mask of the sidecar.")
+	mintempPtr := fs.Float64("min", 0, "Min. temperature of the scale. -min and -max 0 select the automatic scale.")
+	maxtempPtr := fs.Float64("max", 0, "Max. temperature of the scale.")
+	var templates listFlag
+	climate := newClimateFlags(fs)
+	hotspots := newHotspotFlags(fs)
+	clusterFlags := newClusterFlags(fs)
+	modePtr := fs.String("mode", convertis2.ModeTemperature, "Colors of the infrared pictures (temperature, dewpoint, frsi).")
+	rulesPtr := fs.String("rules", "", "A JSON rule set classifying the pictures. Default are the NETA delta-T classes.")
+	ambient := newAmbientFlag(fs)
+	fs.Var(&templates, "template", "A html/template file redefining blocks of the html report. Can be repeated.")
+	palettePtr := fs.String("palette", convertis2.PaletteIron, "Palette of the infrared pictures ("+strings.Join(convertis2.PaletteNames(), ", ")+").")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goconvertis2 report [flags] <file|glob|dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	files, err := convertis2.ExpandInputs(fs.Args(), *recursivePtr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	clusters, err := clusterFlags.options()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	opts := convertis2.Options{
+		MinTemp:       *mintempPtr,
+		MaxTemp:       *maxtempPtr,
+		ScaleFactor:   2,
+		Interpolation: convertis2.InterpolationBilinear,
+		Palette:       *palettePtr,
+		Climate:       climate.climate(),
+		Mode:          *modePtr,
+		Hotspots:      hotspots.options(),
+		Clusters:      clusters,
+		EmissionMask:  *emaskPtr,
+		Ambient:       ambient.ambient(),
+	}
+	if p, ok := params.params(); ok {
+		opts.Background, opts.Emission = p.Background, p.Emission
+	}
+	report, err := convertis2.NewReport(files, opts, readRules(*rulesPtr))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	report.Title, report.Customer, report.Inspector = *titlePtr, *customerPtr, *inspectorPtr
+	html := strings.EqualFold(filepath.Ext(*outPtr), ".html") || strings.EqualFold(filepath.Ext(*outPtr), ".htm")
+	var tmpl *template.Template
+	if html {
+		tmpl, err = convertis2.ParseReportTemplate(templates...)
+		if err != nil {
+			log.Fatalln("Can't parse the template.", err)
+		}
+	}
+	out, err := os.Create(*outPtr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if html {
+		err = report.WriteHTML(out, tmpl)
+	} else {
+		err = report.WritePDF(out)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalln("Can't write the report.", err, *outPtr)
+	}
+	log.Println("Report:", *outPtr)
+	if n := report.Critical(); n > 0 {
+		log.Println("Pictures with critical findings:", n)
+		os.Exit(exitCritical)
+	}
+}
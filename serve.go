@@ -0,0 +1,78 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/weisskopfjens/goconvertis2/convertis2"
+)
+
+// serveMain runs the HTTP conversion service until it is interrupted
+func serveMain(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addrPtr := fs.String("addr", ":8080", "Address of the HTTP service.")
+	maxUploadPtr := fs.Int64("max-upload", 64, "Maximum size of an uploaded file in MiB.")
+	timeoutPtr := fs.Duration("timeout", time.Minute, "Maximum duration of a request including the upload.")
+	palettePtr := fs.String("palette", convertis2.PaletteIron, "Default palette ("+strings.Join(convertis2.PaletteNames(), ", ")+").")
+	interpPtr := fs.String("interp", "bilinear", "Default interpolation of upscaled outputs (nearest, bilinear, bicubic).")
+	qualityPtr := fs.Int("q", 100, "Quality of jpeg outputs (1-100).")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goconvertis2 serve [flags]")
+		fmt.Fprintln(fs.Output(), "POST /convert?output=ir|visual|fusion|csv|json|wav&palette=&scale=auto|min,max&e=&b=&format=&width=&interp=")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	opts := convertis2.Options{
+		Palette:       *palettePtr,
+		Interpolation: *interpPtr,
+		Quality:       *qualityPtr,
+	}
+	err := opts.Validate()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	service := convertis2.NewServer(convertis2.ServeOptions{Options: opts, MaxUpload: *maxUploadPtr << 20})
+	server := &http.Server{
+		Addr:              *addrPtr,
+		Handler:           http.TimeoutHandler(service, *timeoutPtr, "Timeout of the conversion."),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       *timeoutPtr,
+		// The timeout handler answers before the connection is closed.
+		WriteTimeout: *timeoutPtr + 5*time.Second,
+		IdleTimeout:  2 * time.Minute,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() {
+		log.Println("Serving on", *addrPtr)
+		errc <- server.ListenAndServe()
+	}()
+	select {
+	case err = <-errc:
+		log.Fatalln(err)
+	case <-ctx.Done():
+	}
+	// Requests in progress are finished, new ones see the service unready.
+	service.SetReady(false)
+	log.Println("Shutting down.")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *timeoutPtr)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/weisskopfjens/goconvertis2/convertis2"
+)
+
+// trendMain records the files in the trend store and charts the trends of
+// the assets
+func trendMain(args []string) {
+	fs := flag.NewFlagSet("trend", flag.ExitOnError)
+	storePtr := fs.String("store", "trend.jsonl", "The JSON-lines trend store. The files are appended to it.")
+	recursivePtr := fs.Bool("r", false, "Search the input directories recursively.")
+	patternPtr := fs.String("pattern", convertis2.DefaultAssetPattern, "Regular expression on the file name. Its first group is the asset tag of files without the asset in the sidecar.")
+	assetPtr := fs.String("asset", "", "Chart only this asset.")
+	outPtr := fs.String("o", "{asset}_trend.png", "The chart of every asset (.jpg, .png, .tif, .bmp). Empty skips the charts.")
+	csvPtr := fs.String("csv", "", "A .csv file for the points of all series.")
+	risePtr := fs.Float64("rise", 2, "Slope in K per year above which a series of 3 or more points is rising.")
+	widthPtr := fs.Int("width", 900, "Width of the charts in pixels.")
+	params := newParamFlags(fs, "the files")
+	ambient := newAmbientFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goconvertis2 trend [flags] [file|glob|dir]...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	p, _ := params.params()
+	files, err := convertis2.ExpandInputs(fs.Args(), *recursivePtr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var records []convertis2.TrendRecord
+	failed := 0
+	for _, filename := range files {
+		frame, err := convertis2.Decode(filename, p)
+		if err != nil {
+			log.Println(filename, err)
+			failed++
+			continue
+		}
+		// The asset of the sidecar takes precedence over the file name.
+		asset := frame.Asset
+		if asset == "" {
+			asset, err = convertis2.AssetTag(filename, *patternPtr)
+			if err != nil {
+				log.Println(err)
+				failed++
+				continue
+			}
+		}
+		r, err := convertis2.NewTrendRecord(filename, frame, asset, ambient.ambient())
+		if err != nil {
+			log.Println(filename, err)
+			failed++
+			continue
+		}
+		records = append(records, *r)
+	}
+	n, err := convertis2.AppendTrend(*storePtr, records...)
+	if err != nil {
+		log.Fatalln("Can't write the trend store.", err, *storePtr)
+	}
+	if len(records) > 0 {
+		log.Println("Recorded", n, "of", len(records), "files in", *storePtr)
+	}
+	all, err := convertis2.ReadTrend(*storePtr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *assetPtr != "" {
+		var kept []convertis2.TrendRecord
+		for _, r := range all {
+			if r.Asset == *assetPtr {
+				kept = append(kept, r)
+			}
+		}
+		all = kept
+	}
+	if len(all) == 0 {
+		log.Fatalln("No records in the trend store.", *storePtr)
+	}
+	series := convertis2.Trends(all, *risePtr)
+	var assets []string
+	rising := 0
+	for _, s := range series {
+		if len(assets) == 0 || assets[len(assets)-1] != s.Asset {
+			assets = append(assets, s.Asset)
+		}
+		if s.Rising {
+			rising++
+		}
+		fmt.Println(s)
+	}
+	if *outPtr != "" {
+		for _, asset := range assets {
+			filename := strings.ReplaceAll(*outPtr, "{asset}", asset)
+			err := convertis2.WriteTrendChart(filename, asset, series, *widthPtr)
+			if err != nil {
+				log.Println("Can't write the trend chart.", err, filename)
+				failed++
+				continue
+			}
+			log.Println("Written", filename)
+		}
+	}
+	if *csvPtr != "" {
+		f, err := os.Create(*csvPtr)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = convertis2.WriteTrendCSV(f, series)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			log.Fatalln("Can't write the csv file.", err, *csvPtr)
+		}
+		log.Println("Written", *csvPtr)
+	}
+	if rising > 0 {
+		log.Println("Rising series:", rising)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
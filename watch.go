@@ -0,0 +1,63 @@
+// Copyright 2023 Jens Weißkopf. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/weisskopfjens/goconvertis2/convertis2"
+)
+
+// watchMain converts the new .is2 files of a directory until it is
+// interrupted
+func watchMain(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	cf := newConvertFlags(fs)
+	intervalPtr := fs.Duration("interval", 2*time.Second, "Interval between two scans of the directory.")
+	stablePtr := fs.Duration("stable", 5*time.Second, "Time a file must stay unchanged before it is converted.")
+	statePtr := fs.String("state", "", "State file of the converted files. Default is .goconvertis2-state.json in the directory.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goconvertis2 watch [flags] <dir>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	dir := fs.Arg(0)
+	// The outputs go next to the processed originals by default.
+	set := cf.set()
+	processed := filepath.Join(dir, convertis2.ProcessedDir)
+	for name, template := range map[string]string{"oi": "{name}_ir.{ext}", "ov": "{name}_vis.{ext}", "oa": "{name}.wav"} {
+		if !set[name] {
+			fs.Set(name, filepath.Join(processed, template))
+		}
+	}
+	opts, err := cf.options(true)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = convertis2.Watch(ctx, dir, convertis2.WatchOptions{
+		Options:   opts,
+		Interval:  *intervalPtr,
+		Stable:    *stablePtr,
+		StateFile: *statePtr,
+		Workers:   cf.workers(),
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+}